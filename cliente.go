@@ -33,9 +33,20 @@ var (
 	currentBalance    int
 	deckDefinido      bool // Flag para verificar se o deck foi montado
 	currentHand       []protocolo.Carta // Mão do jogador no round atual
+	currentRound      int               // Round atual, pra saber se o tempo acabou durante a escolha
+	currentRounds     int               // Rounds da partida atual, pela modalidade da sala
+	currentClassico   bool              // Partida no modo clássico (quem ganha o round leva as cartas)
+	currentInvertidos []string          // Atributos em que o menor valor ganha no round atual
 	currentState      GameState
+	currentToken      string // token da sessão, usado pra reconectar se a conexão cair
+	currentPacotes    []protocolo.PacoteInfo // Pacotes à venda, recebidos no LIST_PACKS
+	currentTroca      *protocolo.TradeUpdate // Troca aberta com outro jogador (uma por vez)
+	currentAnuncios   []protocolo.AnuncioInfo // Última lista do mercado, pra escolher pelo número
+	revancheAte       int64                   // Prazo pra pedir revanche da última partida em sala privada (Unix, em ms)
 )
 
+const serverAddress = "servidor:8080" //ALTERAR O IP DO SERVIDOR PRA TESTAR
+
 // FUNCOES IMPORTANTES PRO FUNCIONAMENTO DO PROGRAMA
 // envia qualquer struct em JSON pelo writer
 func sendJSON(writer *bufio.Writer, msg protocolo.Message) {
@@ -54,6 +65,27 @@ func mapToStruct(input interface{}, target interface{}) error {
 }
 // ------------------------------------
 
+// reconectar abre uma conexão nova e pede pro servidor retomar a sessão.
+// Os bufio são reaproveitados com Reset, então quem já usa o writer continua funcionando.
+func reconectar(reader *bufio.Reader, writer *bufio.Writer) bool {
+	for tentativa := 1; tentativa <= 10; tentativa++ {
+		conn, err := net.Dial("tcp", serverAddress)
+		if err != nil {
+			fmt.Printf("Tentativa %d de reconexão falhou.\n", tentativa)
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		reader.Reset(conn)
+		writer.Reset(conn)
+		sendJSON(writer, protocolo.Message{
+			Type: "RESUME",
+			Data: protocolo.ResumeRequest{Token: currentToken},
+		})
+		return true
+	}
+	return false
+}
+
 // Funcao pra ajudar na leitura de entradas
 func readLine(reader *bufio.Reader) string {
 	line, _ := reader.ReadString('\n')
@@ -71,6 +103,14 @@ func showMainMenu() {
 	fmt.Println("6. Meu Inventário.")
 	fmt.Println("7. Montar meu deck.")
 	fmt.Println("8. Verificar ping.")
+	fmt.Println("9. Trocar cartas.")
+	fmt.Println("10. Mercado.")
+	fmt.Println("11. Oficina (desmontar e criar cartas).")
+	fmt.Println("12. Extrato de moedas.")
+	fmt.Println("13. Estoque de cartas.")
+	if time.Now().UnixMilli() < revancheAte {
+		fmt.Println("14. Pedir revanche.")
+	}
 	fmt.Println("0. Sair")
 	fmt.Printf("> ")
 }
@@ -107,22 +147,281 @@ func showInventory() {
 		fmt.Printf("Velocidade Max.: %d\n", carta.Velocidade)
 		fmt.Printf("Altura Max.: %d\n", carta.Altura)
 		fmt.Printf("Capac. de Passageiros: %d\n", carta.Passageiros)
+		if carta.Adquirida > 0 {
+			fmt.Printf("Obtida em: %s (%s)\n", time.UnixMilli(carta.Adquirida).Format("02/01/2006 15:04"), strings.ToLower(carta.Origem))
+		}
 	}
 	fmt.Println("======================")
 }
+
+// Mostra os pacotes à venda com a chance de cada raridade
+func showPacotes() {
+	fmt.Println("\n=== Pacotes à venda ===")
+	for i, p := range currentPacotes {
+		fmt.Printf("\n%d. %s - %d moedas, %d carta(s)\n", i+1, p.Nome, p.Preco, p.Tamanho)
+		fmt.Printf("Chances: Comum %.0f%%, Rara %.0f%%, Muito Rara %.0f%%\n",
+			p.Chances["Comum"]*100, p.Chances["Rara"]*100, p.Chances["Muito Rara"]*100)
+		if p.Garantia != "" {
+			fmt.Printf("Garante pelo menos uma carta %s\n", p.Garantia)
+		}
+		showPity(p.Pity)
+		if p.Esgotado {
+			fmt.Println("ESGOTADO - aguarde a reposição do estoque")
+		}
+	}
+	fmt.Println("=======================")
+}
+
+// Mostra quantos pacotes faltam pra cada raridade garantida
+func showPity(pity []protocolo.Pity) {
+	for _, p := range pity {
+		if p.Faltam == 1 {
+			fmt.Printf("%s garantida no próximo pacote!\n", p.Raridade)
+		} else {
+			fmt.Printf("%s garantida em até %d pacotes\n", p.Raridade, p.Faltam)
+		}
+	}
+}
+
+// Pede o pacote e envia o COMPRA. Devolve false se o jogador desistiu.
+func escolherPacote(reader *bufio.Reader, writer *bufio.Writer) bool {
+	fmt.Printf("Escolha o pacote (0 para voltar):\n> ")
+	escolha, err := strconv.Atoi(strings.TrimSpace(readLine(reader)))
+	if err != nil || escolha < 1 || escolha > len(currentPacotes) {
+		return false
+	}
+
+	sendJSON(writer, protocolo.Message{
+		Type: "COMPRA",
+		Data: protocolo.OpenPackageRequest{Tipo: currentPacotes[escolha-1].Tipo},
+	})
+	return true
+}
+
+// Mostra o que cada lado colocou na troca
+func showTroca(t *protocolo.TradeUpdate) {
+	fmt.Printf("\n=== Troca %s ===\n", t.Troca)
+	for _, lado := range t.Lados {
+		status := "aguardando"
+		if lado.Confirmado {
+			status = "confirmou"
+		}
+		fmt.Printf("%s (%s) oferece %d moedas e %d carta(s):\n", lado.Login, status, lado.Moedas, len(lado.Cartas))
+		for _, carta := range lado.Cartas {
+			fmt.Printf("  - %s (%s)\n", carta.Nome, carta.Raridade)
+		}
+	}
+	fmt.Println("================")
+}
+
+// Pergunta as cartas e moedas que o jogador quer colocar na troca
+func escolherOferta(reader *bufio.Reader) ([]string, int) {
+	showInventory()
+	fmt.Printf("Números das cartas que quer oferecer, separados por vírgula (vazio para nenhuma):\n> ")
+	var ids []string
+	for _, campo := range strings.Split(readLine(reader), ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(campo))
+		if err != nil || n < 1 || n > len(currentInventario.Cartas) {
+			continue
+		}
+		ids = append(ids, currentInventario.Cartas[n-1].ID)
+	}
+
+	fmt.Printf("Quantas moedas quer oferecer?\n> ")
+	moedas, _ := strconv.Atoi(readLine(reader))
+	return ids, moedas
+}
+
+// Abre uma troca ou responde à troca aberta
+func menuTroca(reader *bufio.Reader, writer *bufio.Writer) {
+	if currentTroca == nil {
+		fmt.Printf("Login do jogador com quem quer trocar (vazio para voltar):\n> ")
+		para := readLine(reader)
+		if para == "" {
+			return
+		}
+		cartas, moedas := escolherOferta(reader)
+		sendJSON(writer, protocolo.Message{
+			Type: "TRADE_OFFER",
+			Data: protocolo.TradeOfferRequest{Para: para, Cartas: cartas, Moedas: moedas},
+		})
+		return
+	}
+
+	showTroca(currentTroca)
+	fmt.Println("1. Mudar minha oferta.")
+	fmt.Println("2. Confirmar a troca.")
+	fmt.Println("3. Cancelar a troca.")
+	fmt.Println("0. Voltar")
+	fmt.Printf("> ")
+
+	switch readLine(reader) {
+	case "1":
+		cartas, moedas := escolherOferta(reader)
+		sendJSON(writer, protocolo.Message{
+			Type: "TRADE_OFFER",
+			Data: protocolo.TradeOfferRequest{Troca: currentTroca.Troca, Cartas: cartas, Moedas: moedas},
+		})
+	case "2":
+		sendJSON(writer, protocolo.Message{
+			Type: "TRADE_ACCEPT",
+			Data: protocolo.TradeAcceptRequest{Troca: currentTroca.Troca},
+		})
+	case "3":
+		sendJSON(writer, protocolo.Message{
+			Type: "TRADE_CANCEL",
+			Data: protocolo.TradeCancelRequest{Troca: currentTroca.Troca},
+		})
+	}
+}
+
+// Mostra os anúncios da última busca no mercado
+func showAnuncios() {
+	if len(currentAnuncios) == 0 {
+		fmt.Println("Nenhum anúncio encontrado.")
+		return
+	}
+	fmt.Println("\n=== Mercado ===")
+	for i, a := range currentAnuncios {
+		fmt.Printf("%d. %s (%s) de %s - ", i+1, a.Carta.Nome, a.Carta.Raridade, a.Vendedor)
+		if a.Tipo == protocolo.AnuncioVenda {
+			fmt.Printf("compre já por %d moedas\n", a.Preco)
+		} else if a.Licitante != "" {
+			fmt.Printf("leilão, maior lance %d (%s), termina %s\n", a.Lance, a.Licitante, time.UnixMilli(a.Fim).Format("15:04:05"))
+		} else {
+			fmt.Printf("leilão, lance mínimo %d, termina %s\n", a.Preco, time.UnixMilli(a.Fim).Format("15:04:05"))
+		}
+	}
+	fmt.Println("===============")
+}
+
+// Pede o número de um anúncio da última busca
+func escolherAnuncio(reader *bufio.Reader) (protocolo.AnuncioInfo, bool) {
+	showAnuncios()
+	fmt.Printf("Número do anúncio:\n> ")
+	n, err := strconv.Atoi(readLine(reader))
+	if err != nil || n < 1 || n > len(currentAnuncios) {
+		fmt.Println("Anúncio inválido.")
+		return protocolo.AnuncioInfo{}, false
+	}
+	return currentAnuncios[n-1], true
+}
+
+func menuMercado(reader *bufio.Reader, writer *bufio.Writer) {
+	fmt.Println("1. Ver anúncios.")
+	fmt.Println("2. Anunciar uma carta.")
+	fmt.Println("3. Comprar (venda direta).")
+	fmt.Println("4. Dar lance em leilão.")
+	fmt.Println("5. Cancelar um anúncio meu.")
+	fmt.Println("0. Voltar")
+	fmt.Printf("> ")
+
+	switch readLine(reader) {
+	case "1":
+		fmt.Printf("Raridade (vazio para todas):\n> ")
+		raridade := readLine(reader)
+		fmt.Printf("Parte do nome (vazio para todos):\n> ")
+		nome := readLine(reader)
+		sendJSON(writer, protocolo.Message{
+			Type: "MARKET_BROWSE",
+			Data: protocolo.MarketBrowseRequest{Raridade: raridade, Nome: nome},
+		})
+
+	case "2":
+		showInventory()
+		fmt.Printf("Número da carta:\n> ")
+		n, err := strconv.Atoi(readLine(reader))
+		if err != nil || n < 1 || n > len(currentInventario.Cartas) {
+			fmt.Println("Carta inválida.")
+			return
+		}
+		req := protocolo.MarketListRequest{CartaID: currentInventario.Cartas[n-1].ID, Tipo: protocolo.AnuncioVenda}
+		fmt.Printf("1. Venda direta  2. Leilão\n> ")
+		if readLine(reader) == "2" {
+			req.Tipo = protocolo.AnuncioLeilao
+			fmt.Printf("Duração do leilão em minutos:\n> ")
+			minutos, _ := strconv.Atoi(readLine(reader))
+			req.Duracao = minutos * 60
+		}
+		fmt.Printf("Preço (ou lance mínimo) em moedas:\n> ")
+		req.Preco, _ = strconv.Atoi(readLine(reader))
+		sendJSON(writer, protocolo.Message{Type: "MARKET_LIST", Data: req})
+
+	case "3":
+		if a, ok := escolherAnuncio(reader); ok {
+			sendJSON(writer, protocolo.Message{Type: "MARKET_BUY", Data: protocolo.MarketBuyRequest{Anuncio: a.ID}})
+		}
+
+	case "4":
+		if a, ok := escolherAnuncio(reader); ok {
+			fmt.Printf("Valor do lance:\n> ")
+			valor, _ := strconv.Atoi(readLine(reader))
+			sendJSON(writer, protocolo.Message{Type: "MARKET_BID", Data: protocolo.MarketBidRequest{Anuncio: a.ID, Valor: valor}})
+		}
+
+	case "5":
+		if a, ok := escolherAnuncio(reader); ok {
+			sendJSON(writer, protocolo.Message{Type: "MARKET_CANCEL", Data: protocolo.MarketCancelRequest{Anuncio: a.ID}})
+		}
+	}
+}
+
+// Desmonta cartas em fragmentos ou cria uma carta com eles
+func menuOficina(reader *bufio.Reader, writer *bufio.Writer) {
+	fmt.Println("1. Desmontar cartas.")
+	fmt.Println("2. Criar uma carta.")
+	fmt.Println("0. Voltar")
+	fmt.Printf("> ")
+
+	switch readLine(reader) {
+	case "1":
+		showInventory()
+		fmt.Printf("Números das cartas que quer desmontar, separados por vírgula:\n> ")
+		var ids []string
+		for _, campo := range strings.Split(readLine(reader), ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(campo))
+			if err != nil || n < 1 || n > len(currentInventario.Cartas) {
+				continue
+			}
+			ids = append(ids, currentInventario.Cartas[n-1].ID)
+		}
+		if len(ids) == 0 {
+			fmt.Println("Nenhuma carta escolhida.")
+			return
+		}
+		sendJSON(writer, protocolo.Message{Type: "DISMANTLE", Data: protocolo.DismantleRequest{Cartas: ids}})
+
+	case "2":
+		fmt.Printf("Nome da carta que quer criar:\n> ")
+		nome := readLine(reader)
+		if nome == "" {
+			return
+		}
+		sendJSON(writer, protocolo.Message{Type: "CRAFT", Data: protocolo.CraftRequest{Nome: nome}})
+	}
+}
 // ------------------------------------
 
 // FUNCOES PARA FUNCIONAMENTO DE PARTIDA
 func montarDeck(writer *bufio.Writer) {
-	if len(currentInventario.Cartas) < 4 {
-		fmt.Println("Você precisa ter pelo menos 4 cartas no inventário para montar um deck.")
+	// Cada modalidade de partida pede um tamanho de deck (a padrão usa 4)
+	fmt.Printf("Quantas cartas no deck? (Enter para 4): ")
+	tamanho := 4
+	var resposta string
+	fmt.Scanln(&resposta)
+	if n, err := strconv.Atoi(strings.TrimSpace(resposta)); err == nil && n > 0 {
+		tamanho = n
+	}
+
+	if len(currentInventario.Cartas) < tamanho {
+		fmt.Printf("Você precisa ter pelo menos %d cartas no inventário para montar esse deck.\n", tamanho)
 		return
 	}
 
 	showInventory()
 
-	var indices [4]int
-	for i := 0; i < 4; i++ {
+	indices := make([]int, tamanho)
+	for i := 0; i < tamanho; i++ {
 		fmt.Printf("Escolha a carta %d do deck (digite o número correspondente do inventário): ", i+1)
 		var escolha int
 		fmt.Scanln(&escolha)
@@ -136,12 +435,10 @@ func montarDeck(writer *bufio.Writer) {
 		indices[i] = escolha - 1 // ajusta para índice base 0
 	}
 
-	// monta deck local
-	deck := []protocolo.Carta{
-		currentInventario.Cartas[indices[0]],
-		currentInventario.Cartas[indices[1]],
-		currentInventario.Cartas[indices[2]],
-		currentInventario.Cartas[indices[3]],
+	// monta deck local (o servidor só precisa dos IDs, os atributos vêm do catálogo dele)
+	deck := make([]string, tamanho)
+	for i, indice := range indices {
+		deck[i] = currentInventario.Cartas[indice].ID
 	}
 
 	// envia para o servidor
@@ -153,19 +450,30 @@ func montarDeck(writer *bufio.Writer) {
 
 	// mostra deck escolhido
 	fmt.Println("\n=== Seu Deck ===")
-	for i, c := range deck {
-		fmt.Printf("Carta %d: %s\n", i+1, c.Nome)
+	for i := range deck {
+		fmt.Printf("Carta %d: %s\n", i+1, currentInventario.Cartas[indices[i]].Nome)
 	}
 	fmt.Println("================")
 	deckDefinido = true
 }
 
+// polaridade marca os atributos em que o menor valor ganha no round atual.
+func polaridade(atributo string) string {
+	for _, a := range currentInvertidos {
+		if a == atributo {
+			return " - MENOR ganha"
+		}
+	}
+	return ""
+}
+
 func handleGameTurn(reader *bufio.Reader, writer *bufio.Writer) {
 	var cardIndex int
 	var attrIndex int
+	round := currentRound
 
-	// Escolher carta
-	for {
+	// Escolher carta (no modo clássico só tem a carta de cima do monte)
+	for len(currentHand) > 1 {
 		fmt.Printf("Escolha a carta para jogar (1-%d): ", len(currentHand))
 		input := readLine(reader)
 		idx, err := strconv.Atoi(input)
@@ -181,10 +489,10 @@ func handleGameTurn(reader *bufio.Reader, writer *bufio.Writer) {
 	selectedCard := currentHand[cardIndex]
 	for {
 		fmt.Println("\nEscolha a característica para competir:")
-		fmt.Printf("1. Envergadura (%d)\n", selectedCard.Envergadura)
-		fmt.Printf("2. Velocidade (%d)\n", selectedCard.Velocidade)
-		fmt.Printf("3. Altura (%d)\n", selectedCard.Altura)
-		fmt.Printf("4. Passageiros (%d)\n", selectedCard.Passageiros)
+		fmt.Printf("1. Envergadura (%d)%s\n", selectedCard.Envergadura, polaridade("Envergadura"))
+		fmt.Printf("2. Velocidade (%d)%s\n", selectedCard.Velocidade, polaridade("Velocidade"))
+		fmt.Printf("3. Altura (%d)%s\n", selectedCard.Altura, polaridade("Altura"))
+		fmt.Printf("4. Passageiros (%d)%s\n", selectedCard.Passageiros, polaridade("Passageiros"))
 		fmt.Printf("> ")
 		input := readLine(reader)
 		idx, err := strconv.Atoi(input)
@@ -208,6 +516,12 @@ func handleGameTurn(reader *bufio.Reader, writer *bufio.Writer) {
 		attribute = "Passageiros"
 	}
 
+	// Se o tempo acabou enquanto escolhia, o servidor já jogou (ou deu o round como perdido)
+	if currentState != TurnState || currentRound != round {
+		fmt.Println("\nO tempo do round acabou, a jogada não foi enviada.")
+		return
+	}
+
 	req := protocolo.Message{
 		Type: "PLAY_MOVE",
 		Data: protocolo.PlayMoveRequest{
@@ -227,6 +541,13 @@ func interpreter(reader *bufio.Reader, writer *bufio.Writer, gameChannel chan st
 		// Fica lendo o que o servidor envia e caso venha um erro ou EOF sai da funcao.
 		message, err := reader.ReadString('\n')
 		if err != nil {
+			// Se já estava logado tenta voltar pra mesma sessão (e partida)
+			if currentToken != "" {
+				fmt.Println("\nConexão perdida. Tentando reconectar...")
+				if reconectar(reader, writer) {
+					continue
+				}
+			}
 			if err == io.EOF {
 				fmt.Println("Conexão com o servidor encerrada.")
 			} else {
@@ -252,6 +573,41 @@ func interpreter(reader *bufio.Reader, writer *bufio.Writer, gameChannel chan st
 			if data.Status == "LOGADO" {
 				currentBalance = data.Saldo
 				currentInventario = data.Inventario
+				currentToken = data.Token
+				// Primeiro login do dia: resgata a recompensa diária
+				if data.Diario != nil && data.Diario.Disponivel {
+					sendJSON(writer, protocolo.Message{
+						Type: "CLAIM_DAILY",
+						Data: protocolo.ClaimDailyRequest{},
+					})
+				}
+			}
+
+		case "CLAIM_DAILY_RESPONSE":
+			var data protocolo.ClaimDailyResponse
+			_ = mapToStruct(msg.Data, &data)
+			if data.Status == "RESGATADO" {
+				fmt.Printf("Recompensa diária: +%d moedas (%dº dia seguido). Saldo: %d\n", data.Recompensa, data.Sequencia, data.Saldo)
+				currentBalance = data.Saldo
+			} else {
+				fmt.Println("Você já resgatou a recompensa de hoje.")
+			}
+
+		case "RESUME":
+			var data protocolo.ResumeResponse
+			_ = mapToStruct(msg.Data, &data)
+			if data.Status == "RETOMADO" {
+				fmt.Println("Reconectado!")
+				currentBalance = data.Saldo
+				currentInventario = data.Inventario
+				// Se a partida acabou enquanto estava fora, volta pro menu
+				if !data.EmPartida && (currentState == InGameState || currentState == TurnState) {
+					currentState = MenuState
+				}
+			} else {
+				fmt.Println("Não foi possível retomar a sessão. Faça login novamente.")
+				currentToken = ""
+				currentState = LoginState
 			}
 
 		case "PAREADO":
@@ -267,19 +623,154 @@ func interpreter(reader *bufio.Reader, writer *bufio.Writer, gameChannel chan st
 			_ = mapToStruct(msg.Data, &data)
 			fmt.Println("[INFO] " + data.Content)
 
+		case "ERRO":
+			var data protocolo.ErrorMessage
+			_ = mapToStruct(msg.Data, &data)
+			fmt.Println("[ERRO] " + data.Mensagem)
+			// Jogada recusada mas o round continua: deixa escolher de novo
+			if data.Codigo == protocolo.ErroCartaInvalida || data.Codigo == protocolo.ErroAtributoInvalido {
+				currentState = TurnState
+			}
+			if (data.Codigo == protocolo.ErroRegrasInvalidas || data.Codigo == protocolo.ErroSerieInvalida) && currentState == WaitingState {
+				currentState = MenuState
+			}
+			// Nada mudou no servidor: quem esperava a resposta volta pro menu
+			if data.Codigo == protocolo.ErroGravacao && currentState == StopState {
+				currentState = MenuState
+			}
+			if data.Codigo == protocolo.ErroPartidaCancelada {
+				currentState = MenuState
+			}
+			if data.Codigo == protocolo.ErroSemRevanche {
+				revancheAte = 0
+				if currentState == StopState {
+					currentState = MenuState
+				}
+			}
+			if data.Codigo == protocolo.ErroDeckInvalido {
+				deckDefinido = false
+				if currentState == WaitingState {
+					currentState = MenuState
+				}
+			}
+
 		case "COMPRA_RESPONSE":
 			var data protocolo.CompraResponse
 			_ = mapToStruct(msg.Data, &data)
 			gameChannel <- data.Status // Envia FALHA_COMPRA ou COMPRA_APROVADA pro channel.
 			if data.Status == "COMPRA_APROVADA" {
-				fmt.Printf("Voce ganhou uma carta " + data.CartaNova.Raridade + ": " + data.CartaNova.Nome + "\n") // Atualizar o inventario do player.
-				currentInventario = data.Inventario
+				for _, carta := range data.Cartas {
+					fmt.Printf("Voce ganhou uma carta %s: %s\n", carta.Raridade, carta.Nome)
+				}
+				showPity(data.Pity)
+				currentInventario = data.Inventario // Atualizar o inventario do player.
+			}
+
+		case "LIST_PACKS_RESPONSE":
+			var data protocolo.ListPacksResponse
+			_ = mapToStruct(msg.Data, &data)
+			currentPacotes = data.Pacotes
+			showPacotes()
+			gameChannel <- "PACOTES" // o loop principal pergunta qual comprar
+
+		case "TRADE_UPDATE":
+			var data protocolo.TradeUpdate
+			_ = mapToStruct(msg.Data, &data)
+			switch data.Status {
+			case protocolo.TrocaAberta:
+				currentTroca = &data
+				showTroca(&data)
+				fmt.Println("Use a opção 9 do menu para responder à troca.")
+			case protocolo.TrocaConcluida:
+				currentTroca = nil
+				fmt.Println("Troca concluída!")
+				if data.Inventario != nil {
+					currentInventario = *data.Inventario
+				}
+			case protocolo.TrocaCancelada:
+				currentTroca = nil
+				fmt.Println("Troca cancelada: " + data.Motivo)
+			}
+
+		case "MARKET_BROWSE_RESPONSE":
+			var data protocolo.MarketBrowseResponse
+			_ = mapToStruct(msg.Data, &data)
+			currentAnuncios = data.Anuncios
+			showAnuncios()
+
+		case "MARKET_UPDATE":
+			var data protocolo.MarketUpdate
+			_ = mapToStruct(msg.Data, &data)
+			carta := data.Anuncio.Carta.Nome
+			switch data.Status {
+			case protocolo.MercadoAnunciado:
+				fmt.Println("[Mercado] " + carta + " anunciada.")
+			case protocolo.MercadoLance:
+				fmt.Printf("[Mercado] Lance de %d moedas de %s em %s.\n", data.Anuncio.Lance, data.Anuncio.Licitante, carta)
+			case protocolo.MercadoSuperado:
+				fmt.Printf("[Mercado] Seu lance em %s foi superado (%d moedas).\n", carta, data.Anuncio.Lance)
+			case protocolo.MercadoVendido:
+				fmt.Println("[Mercado] Você vendeu " + carta + "!")
+			case protocolo.MercadoComprado:
+				fmt.Println("[Mercado] Você comprou " + carta + "!")
+			case protocolo.MercadoExpirado:
+				fmt.Println("[Mercado] O leilão de " + carta + " acabou sem lances.")
+			case protocolo.MercadoCancelado:
+				fmt.Println("[Mercado] Anúncio de " + carta + " cancelado.")
+			}
+			currentBalance = data.Saldo
+			if data.Inventario != nil {
+				currentInventario = *data.Inventario
+			}
+
+		case "DISMANTLE_RESPONSE", "CRAFT_RESPONSE":
+			var data protocolo.OficinaResponse
+			_ = mapToStruct(msg.Data, &data)
+			for _, carta := range data.Cartas {
+				if msg.Type == "CRAFT_RESPONSE" {
+					fmt.Printf("Carta criada: %s (%s)\n", carta.Nome, carta.Raridade)
+				} else {
+					fmt.Printf("Carta desmontada: %s (%s)\n", carta.Nome, carta.Raridade)
+				}
+			}
+			fmt.Printf("Seus fragmentos: %d\n", data.Fragmentos)
+			currentInventario = data.Inventario
+
+		case "COIN_HISTORY_RESPONSE":
+			var data protocolo.CoinHistoryResponse
+			_ = mapToStruct(msg.Data, &data)
+			fmt.Printf("\n=== Extrato (últimos %d de %d) ===\n", len(data.Lancamentos), data.Total)
+			for _, l := range data.Lancamentos {
+				fmt.Printf("%s  %-15s %+5d  saldo %d", time.UnixMilli(l.Hora).Format("02/01 15:04"), l.Motivo, l.Valor, l.Saldo)
+				if l.Referencia != "" {
+					fmt.Printf("  (%s)", l.Referencia)
+				}
+				fmt.Println()
+			}
+			fmt.Printf("Saldo atual: %d\n", data.Saldo)
+			currentBalance = data.Saldo
+
+		case "STORAGE_STATUS_RESPONSE":
+			var data protocolo.StorageStatusResponse
+			_ = mapToStruct(msg.Data, &data)
+			fmt.Println("\n=== Estoque de cartas ===")
+			for _, c := range data.Cartas {
+				fmt.Printf("%-25s %-11s %4d / %d\n", c.Nome, c.Raridade, c.Quantidade, c.Maximo)
+			}
+			for _, p := range data.Pacotes {
+				if p.Esgotado {
+					fmt.Printf("Pacote %s esgotado\n", p.Tipo)
+				}
+			}
+			if data.ProximaReposicao != 0 {
+				fmt.Printf("Próxima reposição: %s\n", time.UnixMilli(data.ProximaReposicao).Format("02/01 15:04"))
 			}
 
 		case "BALANCE_RESPONSE":
 			var data protocolo.BalanceResponse
 			_ = mapToStruct(msg.Data, &data)
 			fmt.Printf("Seu saldo atual de moedas: %d\n", data.Saldo)
+			fmt.Printf("Seus fragmentos: %d\n", data.Fragmentos)
 			currentBalance = data.Saldo
 
 		case "PING":
@@ -302,13 +793,52 @@ func interpreter(reader *bufio.Reader, writer *bufio.Writer, gameChannel chan st
 			var data protocolo.GameStartMessage
 			_ = mapToStruct(msg.Data, &data)
 			fmt.Printf("\n--- PARTIDA INICIADA! ---\nVocê está jogando contra: %s\n", data.Opponent)
+			fmt.Printf("Modalidade %s, %d round(s).\n", data.Modalidade, data.Rounds)
+			if data.Classico {
+				fmt.Println("Modo clássico: quem tem a vez escolhe o atributo da carta de cima do monte, e quem ganha leva as duas cartas.")
+				fmt.Printf("Vence quem ficar com todas as cartas (ou com mais cartas depois de %d rounds).\n", data.Rounds)
+				if data.SuperTrunfo != "" {
+					fmt.Printf("Super Trunfo: %s, ganha de qualquer carta menos das %s.\n", data.SuperTrunfo, data.ContraTrunfo)
+				}
+			}
+			if len(data.Invertidos) > 0 {
+				fmt.Printf("Nesta modalidade o MENOR valor ganha em: %s.\n", strings.Join(data.Invertidos, ", "))
+			}
+			if data.ChanceInversao > 0 {
+				fmt.Printf("Cada round tem %d%% de chance de inverter mais um atributo.\n", data.ChanceInversao)
+			}
+			if data.Serie != nil {
+				fmt.Printf("Partida %d da série melhor de %d (placar da série: %d x %d).\n", data.Serie.Partidas+1, data.Serie.Serie, data.Serie.VitoriasP1, data.Serie.VitoriasP2)
+			}
+			revancheAte = 0
+			currentRounds = data.Rounds
+			currentClassico = data.Classico
 			currentState = InGameState // Jogo começou, pode usar o chat
 
 		case "ROUND_START":
 			var data protocolo.RoundStartMessage
 			_ = mapToStruct(msg.Data, &data)
 			currentHand = data.Hand
-			fmt.Printf("\n--- ROUND %d ---\n", data.Round)
+			currentRound = data.Round
+			currentInvertidos = data.Invertidos
+			fmt.Printf("\n--- ROUND %d de %d ---\n", data.Round, currentRounds)
+			if len(data.Invertidos) > 0 {
+				fmt.Printf("Neste round o MENOR valor ganha em: %s.\n", strings.Join(data.Invertidos, ", "))
+			}
+			if data.TempoJogada > 0 {
+				fmt.Printf("Você tem %d segundos para jogar.\n", data.TempoJogada)
+			}
+			if data.Vez != "" {
+				fmt.Printf("Carta de cima do seu monte: %s\n", currentHand[0].Nome)
+				if data.Vez != currentUser {
+					fmt.Printf("Vez de %s escolher o atributo. Aguardando...\n", data.Vez)
+					currentState = InGameState
+					break
+				}
+				fmt.Println("Sua vez de escolher o atributo!")
+				currentState = TurnState
+				break
+			}
 			fmt.Println("Sua mão:")
 			for i, carta := range currentHand {
 				fmt.Printf("%d. %s\n", i+1, carta.Nome)
@@ -319,8 +849,32 @@ func interpreter(reader *bufio.Reader, writer *bufio.Writer, gameChannel chan st
 			var data protocolo.RoundResultMessage
 			_ = mapToStruct(msg.Data, &data)
 			fmt.Println("\n--- RESULTADO DO ROUND ---")
-			fmt.Printf("%s jogou %s (Atributo: %s - Valor: %d)\n", data.Player1Move.PlayerName, data.Player1Move.CardName, data.Player1Move.Attribute, data.Player1Move.AttributeValue)
-			fmt.Printf("%s jogou %s (Atributo: %s - Valor: %d)\n", data.Player2Move.PlayerName, data.Player2Move.CardName, data.Player2Move.Attribute, data.Player2Move.AttributeValue)
+			for _, jogada := range []protocolo.PlayerMoveInfo{data.Player1Move, data.Player2Move} {
+				if jogada.SemJogada {
+					fmt.Printf("%s não jogou a tempo e perdeu o round\n", jogada.PlayerName)
+					continue
+				}
+				fmt.Printf("%s jogou %s (Atributo: %s - Valor: %d)\n", jogada.PlayerName, jogada.CardName, jogada.Attribute, jogada.AttributeValue)
+				if jogada.MenorGanha {
+					fmt.Println("  (neste atributo o menor valor ganhou)")
+				}
+				if jogada.Automatica {
+					fmt.Println("  (jogada automática, o tempo acabou)")
+				}
+			}
+			if currentClassico {
+				if data.SuperTrunfo {
+					fmt.Println("O SUPER TRUNFO decidiu o round!")
+				}
+				if data.Vencedor == "" {
+					fmt.Printf("Empate! %d cartas ficam na mesa para quem ganhar o próximo round.\n", data.Mesa)
+				} else {
+					fmt.Printf("%s levou %d cartas.\n", data.Vencedor, data.RoundPointsP1+data.RoundPointsP2)
+				}
+				fmt.Printf("\nCartas nos montes: %s %d x %d %s\n", data.Player1Move.PlayerName, data.TotalScoreP1, data.TotalScoreP2, data.Player2Move.PlayerName)
+				currentState = InGameState
+				break
+			}
 			fmt.Printf("Pontos de %s no round: %d\n", data.Player1Move.PlayerName, data.RoundPointsP1)
 			fmt.Printf("Pontos de %s no round: %d\n", data.Player2Move.PlayerName, data.RoundPointsP2)
 			fmt.Printf("\nPlacar Total: %s %d x %d %s\n", data.Player1Move.PlayerName, data.TotalScoreP1, data.TotalScoreP2, data.Player2Move.PlayerName)
@@ -331,6 +885,9 @@ func interpreter(reader *bufio.Reader, writer *bufio.Writer, gameChannel chan st
             var data protocolo.GameOverMessage
             _ = mapToStruct(msg.Data, &data)
             fmt.Println("\n\n--- FIM DE JOGO ---")
+            if data.Abandono != "" {
+                fmt.Printf("%s abandonou a partida.\n", data.Abandono)
+            }
             if data.Winner == "EMPATE" {
                 fmt.Println("A partida terminou em EMPATE!")
             } else {
@@ -345,9 +902,67 @@ func interpreter(reader *bufio.Reader, writer *bufio.Writer, gameChannel chan st
             }
 
             fmt.Printf("Placar Final: %d x %d\n", data.FinalScoreP1, data.FinalScoreP2)
+            if data.Serie != nil {
+                fmt.Printf("Placar da série (melhor de %d): %d x %d\n", data.Serie.Serie, data.Serie.VitoriasP1, data.Serie.VitoriasP2)
+            }
+            if data.Continua {
+                fmt.Println("A próxima partida da série começa em instantes...")
+                break
+            }
+            revancheAte = data.Revanche
+            if revancheAte != 0 {
+                fmt.Printf("Quer revanche? Escolha a opção 14 do menu em até %d segundos.\n", time.Until(time.UnixMilli(revancheAte)).Round(time.Second)/time.Second)
+            }
+            if data.Serie != nil {
+                break // o SERIES_OVER vem em seguida e leva pro menu
+            }
             fmt.Println("Voltando para o menu principal...")
             time.Sleep(5 * time.Second)
             currentState = MenuState
+
+		case "SERIES_OVER":
+			var data protocolo.SeriesOverMessage
+			_ = mapToStruct(msg.Data, &data)
+			fmt.Println("\n--- FIM DA SÉRIE ---")
+			if data.Motivo != "" {
+				fmt.Println(data.Motivo)
+			}
+			if data.Abandono != "" {
+				fmt.Printf("%s abandonou a série.\n", data.Abandono)
+			}
+			if data.Winner == "EMPATE" {
+				fmt.Println("A série terminou empatada!")
+			} else if data.Winner != "" {
+				fmt.Printf("%s venceu a série!\n", data.Winner)
+			}
+			fmt.Printf("%s %d x %d %s em %d partida(s)", data.Jogador1, data.VitoriasP1, data.VitoriasP2, data.Jogador2, data.Partidas)
+			if data.Empates > 0 {
+				fmt.Printf(", %d empate(s)", data.Empates)
+			}
+			fmt.Println(".")
+			fmt.Println("Voltando para o menu principal...")
+			time.Sleep(5 * time.Second)
+			currentState = MenuState
+
+		case "REMATCH_STATUS":
+			var data protocolo.RematchStatus
+			_ = mapToStruct(msg.Data, &data)
+			switch data.Status {
+			case protocolo.RevancheAguardando:
+				fmt.Printf("Revanche pedida. Aguardando %s...\n", data.Oponente)
+			case protocolo.RevanchePedida:
+				fmt.Printf("[INFO] %s pediu revanche! Escolha a opção 14 do menu para aceitar.\n", data.Oponente)
+			case protocolo.RevancheAceita:
+				fmt.Printf("Revanche aceita! Aguardando o início do jogo contra %s...\n", data.Oponente)
+				revancheAte = 0
+				currentState = InGameState
+			default: // EXPIRADA ou CANCELADA
+				fmt.Println("[INFO] Sem revanche: " + data.Motivo)
+				revancheAte = 0
+				if currentState == StopState {
+					currentState = MenuState
+				}
+			}
 		}
 	}
 }
@@ -358,7 +973,7 @@ func main() {
 
 	// Loop pra abrir conexão com o servidor.
 	for {
-		conn, err = net.Dial("tcp", "servidor:8080") //ALTERAR O IP DO SERVIDOR PRA TESTAR
+		conn, err = net.Dial("tcp", serverAddress)
 		if err == nil {
 			break
 		}
@@ -398,14 +1013,24 @@ func main() {
 			} else if msg == "N_EXIST" {
 				fmt.Println("O usuario nao existe.")
 				currentState = LoginState
+			} else if msg == "SENHA_INVALIDA" {
+				fmt.Println("Senha incorreta.")
+				currentState = LoginState
 			} else if msg == "COMPRA_APROVADA" {
 				currentState = MenuState
-			} else if msg == "EMPTY_STORAGE" {
-				fmt.Println("Erro, armazem geral vazio!")
+			} else if msg == "PACOTES" {
+				if !escolherPacote(userInputReader, writer) {
+					currentState = MenuState
+				}
+			} else if msg == "PACOTE_INVALIDO" {
+				fmt.Println("Esse pacote não está mais à venda.")
 				currentState = MenuState
 			} else if msg == "NO_BALANCE" {
 				fmt.Println("Você não tem saldo suficiente.")
 				currentState = MenuState
+			} else if msg == "EMPTY_STORAGE" {
+				fmt.Println("Esse pacote está esgotado. Aguarde a reposição do estoque.")
+				currentState = MenuState
 			}
 		default:
 		}
@@ -478,10 +1103,12 @@ func main() {
 					fmt.Println("Você precisa montar um deck primeiro! (Opção 7)")
 					continue
 				}
+				fmt.Printf("Modalidade (Enter para a padrão):\n> ")
+				modalidade := strings.ToUpper(strings.TrimSpace(readLine(userInputReader)))
 				fmt.Println("Buscando sala pública...")
 				req := protocolo.Message{
 					Type: "FIND_ROOM",
-					Data: protocolo.RoomRequest{Mode: "PUBLIC"},
+					Data: protocolo.RoomRequest{Mode: "PUBLIC", Modalidade: modalidade},
 				}
 				sendJSON(writer, req)
 				currentState = WaitingState
@@ -506,9 +1133,13 @@ func main() {
 					fmt.Println("Você precisa montar um deck primeiro! (Opção 7)")
 					continue
 				}
+				fmt.Printf("Modalidade (Enter para a padrão):\n> ")
+				modalidade := strings.ToUpper(strings.TrimSpace(readLine(userInputReader)))
+				fmt.Printf("Melhor de quantas partidas? (1, 3 ou 5; Enter para 1):\n> ")
+				serie, _ := strconv.Atoi(strings.TrimSpace(readLine(userInputReader)))
 				req := protocolo.Message{
 					Type: "CREATE_ROOM",
-					Data: nil,
+					Data: protocolo.RoomRequest{Modalidade: modalidade, Serie: serie},
 				}
 				sendJSON(writer, req)
 				currentState = WaitingState
@@ -522,10 +1153,10 @@ func main() {
 				sendJSON(writer, req)
 				
 			case "5":
-				// Abrir pacote de cartas.
+				// Abrir pacote de cartas: primeiro busca os pacotes à venda.
 				req := protocolo.Message{
-					Type: "COMPRA",
-					Data: protocolo.OpenPackageRequest{},
+					Type: "LIST_PACKS",
+					Data: protocolo.ListPacksRequest{},
 				}
 				sendJSON(writer, req)
 				currentState = StopState
@@ -546,6 +1177,37 @@ func main() {
 				}
 				sendJSON(writer, req)
 
+			case "9":
+				// Trocar cartas com outro jogador
+				menuTroca(userInputReader, writer)
+
+			case "10":
+				// Comprar e vender no mercado
+				menuMercado(userInputReader, writer)
+
+			case "11":
+				// Desmontar e criar cartas
+				menuOficina(userInputReader, writer)
+
+			case "12":
+				// Últimas movimentações de moedas
+				sendJSON(writer, protocolo.Message{
+					Type: "COIN_HISTORY",
+					Data: protocolo.CoinHistoryRequest{},
+				})
+
+			case "13":
+				// Cópias de cada carta que ainda podem sair nos pacotes
+				sendJSON(writer, protocolo.Message{
+					Type: "STORAGE_STATUS",
+					Data: protocolo.StorageStatusRequest{},
+				})
+
+			case "14":
+				// Revanche contra o oponente da última sala privada
+				sendJSON(writer, protocolo.Message{Type: "REMATCH", Data: nil})
+				currentState = StopState
+
 			case "0":
 				req := protocolo.Message{
 					Type: "QUIT",
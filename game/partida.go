@@ -0,0 +1,439 @@
+package game
+
+import (
+	"card_game/protocolo"
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+// Atributos que podem ser escolhidos numa jogada.
+var Atributos = []string{"Envergadura", "Velocidade", "Altura", "Passageiros"}
+
+func AtributoValido(atributo string) bool {
+	for _, a := range Atributos {
+		if a == atributo {
+			return true
+		}
+	}
+	return false
+}
+
+// Valor da carta no atributo (0 se o atributo não existe).
+func Valor(c protocolo.Carta, atributo string) int {
+	switch atributo {
+	case "Envergadura":
+		return c.Envergadura
+	case "Velocidade":
+		return c.Velocidade
+	case "Altura":
+		return c.Altura
+	case "Passageiros":
+		return c.Passageiros
+	}
+	return 0
+}
+
+// Outcome é o resultado de um round para os dois jogadores, A e B.
+type Outcome struct {
+	ValorA int // carta de A no atributo que A escolheu
+	ValorB int // carta de B no atributo que B escolheu
+
+	// Resultado de A no atributo que A escolheu e no que B escolheu (o de B
+	// é o Inverso de cada um)
+	NoAtributoA Resultado
+	NoAtributoB Resultado
+
+	PontosA int
+	PontosB int
+}
+
+// ResolveRound compara as duas cartas no atributo escolhido por cada
+// jogador, com a polaridade das regras, e pontua os dois.
+func ResolveRound(cardA, cardB protocolo.Carta, attrA, attrB string, rules MatchRules) Outcome {
+	noA := rules.CompararNo(attrA, Valor(cardA, attrA), Valor(cardB, attrA))
+	noB := rules.CompararNo(attrB, Valor(cardA, attrB), Valor(cardB, attrB))
+	return Outcome{
+		ValorA:      Valor(cardA, attrA),
+		ValorB:      Valor(cardB, attrB),
+		NoAtributoA: noA,
+		NoAtributoB: noB,
+		PontosA:     rules.Pontos(noA, noB),
+		PontosB:     rules.Pontos(noB.Inverso(), noA.Inverso()),
+	}
+}
+
+// CompararCartas compara a carta a com a b no atributo, como no modo
+// clássico: o Super Trunfo das regras ganha de qualquer carta, menos das
+// da raridade ContraTrunfo. O bool diz se o Super Trunfo decidiu.
+func (r MatchRules) CompararCartas(a, b protocolo.Carta, atributo string) (Resultado, bool) {
+	trunfoA := r.SuperTrunfo != "" && a.Nome == r.SuperTrunfo
+	trunfoB := r.SuperTrunfo != "" && b.Nome == r.SuperTrunfo
+	switch {
+	case trunfoA && !trunfoB:
+		if b.Raridade == r.ContraTrunfo {
+			return Derrota, true
+		}
+		return Vitoria, true
+	case trunfoB && !trunfoA:
+		if a.Raridade == r.ContraTrunfo {
+			return Vitoria, true
+		}
+		return Derrota, true
+	}
+	return r.CompararNo(atributo, Valor(a, atributo), Valor(b, atributo)), false
+}
+
+// Inverso é o mesmo round com os jogadores trocados de lugar.
+func (o Outcome) Inverso() Outcome {
+	return Outcome{
+		ValorA:      o.ValorB,
+		ValorB:      o.ValorA,
+		NoAtributoA: o.NoAtributoB.Inverso(),
+		NoAtributoB: o.NoAtributoA.Inverso(),
+		PontosA:     o.PontosB,
+		PontosB:     o.PontosA,
+	}
+}
+
+// Lados da partida, usados de índice em Placar, Maos e nas jogadas.
+const (
+	Nenhum = -1 // sem vencedor (empate) ou sem abandono
+	LadoA  = 0
+	LadoB  = 1
+)
+
+// Outro é o lado do adversário.
+func Outro(lado int) int {
+	return 1 - lado
+}
+
+// Jogada de um lado no round.
+type Jogada struct {
+	Carta      int // índice na mão
+	Atributo   string
+	Automatica bool // feita pelo servidor quando o tempo acabou
+	SemJogada  bool // o tempo acabou e o jogador perdeu o round
+}
+
+// Estado da partida. Ela vai de EstadoEntreRounds pra EstadoRound a cada
+// IniciarRound e volta com o ResolverRound, até acabar em EstadoEncerrada.
+type Estado int
+
+const (
+	EstadoEntreRounds Estado = iota // antes do primeiro round e enquanto o resultado é mostrado
+	EstadoRound                     // round aberto, recebendo jogadas
+	EstadoEncerrada
+)
+
+// Erros de Jogar.
+var (
+	ErrEncerrada        = errors.New("a partida já terminou")
+	ErrForaDoRound      = errors.New("não há round aberto")
+	ErrJogadaRepetida   = errors.New("o jogador já jogou neste round")
+	ErrForaDaVez        = errors.New("não é a vez do jogador escolher")
+	ErrCartaInvalida    = errors.New("carta fora da mão")
+	ErrAtributoInvalido = errors.New("atributo inválido")
+)
+
+// Partida guarda o andamento de uma partida, sem nada de rede nem de tempo:
+// quem a usa decide quando abrir os rounds e quando o prazo acaba.
+type Partida struct {
+	Regras   MatchRules
+	Round    int // começa em 1; passa de Regras.Rounds quando a partida acaba
+	Estado   Estado
+	Placar   [2]int
+	Maos     [2][]protocolo.Carta // no modo clássico, o monte de cada lado (a de cima é a primeira)
+	Abandono int                  // lado que perdeu por abandono, ou Nenhum
+
+	// Só no modo clássico
+	Vez  int               // lado que escolhe o atributo no round
+	Mesa []protocolo.Carta // cartas dos rounds empatados, pra quem ganhar o próximo
+
+	Invertido string // atributo sorteado em que o menor ganha no round atual (vazio se nenhum)
+
+	jogadas [2]Jogada
+	jogou   [2]bool
+}
+
+// NovaPartida começa uma partida com as mãos já sorteadas (a partida fica
+// com elas). No modo clássico quem começa escolhendo é o LadoA.
+func NovaPartida(regras MatchRules, maoA, maoB []protocolo.Carta) *Partida {
+	p := &Partida{
+		Regras:   regras,
+		Round:    1,
+		Maos:     [2][]protocolo.Carta{maoA, maoB},
+		Abandono: Nenhum,
+		Vez:      LadoA,
+	}
+	if regras.Classico {
+		p.Placar = [2]int{len(maoA), len(maoB)}
+	}
+	return p
+}
+
+func (p *Partida) Encerrada() bool {
+	return p.Estado == EstadoEncerrada
+}
+
+func (p *Partida) RoundAberto() bool {
+	return p.Estado == EstadoRound
+}
+
+// Mao é o que o lado pode jogar no round: a mão inteira, ou no modo
+// clássico só a carta de cima do monte.
+func (p *Partida) Mao(lado int) []protocolo.Carta {
+	if p.Regras.Classico && len(p.Maos[lado]) > 0 {
+		return p.Maos[lado][:1]
+	}
+	return p.Maos[lado]
+}
+
+// IniciarRound abre o round atual para as jogadas e sorteia, com a
+// Regras.ChanceInversao, um atributo em que o menor ganha só neste round.
+func (p *Partida) IniciarRound() error {
+	if p.Estado != EstadoEntreRounds {
+		return fmt.Errorf("round %d não pode começar agora", p.Round)
+	}
+	p.Estado = EstadoRound
+	p.jogadas = [2]Jogada{}
+	p.jogou = [2]bool{}
+
+	p.Invertido = ""
+	if p.Regras.ChanceInversao > 0 && rand.Intn(100) < p.Regras.ChanceInversao {
+		var normais []string
+		for _, atributo := range Atributos {
+			if !p.Regras.MenorGanha(atributo) {
+				normais = append(normais, atributo)
+			}
+		}
+		p.Invertido = normais[rand.Intn(len(normais))]
+	}
+	return nil
+}
+
+// RegrasDoRound são as regras da partida com a inversão sorteada no round.
+func (p *Partida) RegrasDoRound() MatchRules {
+	return p.Regras.ComInversao(p.Invertido)
+}
+
+// Jogar registra a jogada de um lado no round aberto.
+func (p *Partida) Jogar(lado int, j Jogada) error {
+	if p.Encerrada() {
+		return ErrEncerrada
+	}
+	if !p.RoundAberto() {
+		return ErrForaDoRound
+	}
+	if p.jogou[lado] {
+		return ErrJogadaRepetida
+	}
+	if p.Regras.Classico && lado != p.Vez {
+		return ErrForaDaVez
+	}
+	if !j.SemJogada {
+		if j.Carta < 0 || j.Carta >= len(p.Mao(lado)) {
+			return ErrCartaInvalida
+		}
+		if !AtributoValido(j.Atributo) {
+			return ErrAtributoInvalido
+		}
+	}
+	p.jogadas[lado] = j
+	p.jogou[lado] = true
+	return nil
+}
+
+// Jogou diz se o lado já jogou no round aberto.
+func (p *Partida) Jogou(lado int) bool {
+	return p.jogou[lado]
+}
+
+// Espera diz se o round aberto ainda precisa da jogada do lado (no modo
+// clássico, só de quem tem a vez).
+func (p *Partida) Espera(lado int) bool {
+	if !p.RoundAberto() || p.jogou[lado] {
+		return false
+	}
+	return !p.Regras.Classico || lado == p.Vez
+}
+
+// Completo diz se todas as jogadas do round chegaram e ele pode ser resolvido.
+func (p *Partida) Completo() bool {
+	return p.RoundAberto() && !p.Espera(LadoA) && !p.Espera(LadoB)
+}
+
+// RoundResolvido é o que aconteceu num round, pra montar o resultado. No
+// modo clássico os dois lados aparecem com o atributo de quem tinha a vez,
+// e os pontos do Outcome são as cartas que cada um levou.
+type RoundResolvido struct {
+	Round       int
+	Jogadas     [2]Jogada
+	Cartas      [2]protocolo.Carta // vazia pra quem ficou sem jogada
+	Vencedor    int                // lado que ganhou o round, ou Nenhum
+	SuperTrunfo bool               // o Super Trunfo decidiu o round
+	Regras      MatchRules         // regras do round, com a polaridade de cada atributo
+	Outcome
+}
+
+// ResolverRound pontua o round com as duas jogadas, tira as cartas usadas
+// das mãos e passa para o próximo round (ou encerra a partida, se era o
+// último).
+func (p *Partida) ResolverRound() (RoundResolvido, error) {
+	if !p.Completo() {
+		return RoundResolvido{}, fmt.Errorf("round %d ainda não tem as duas jogadas", p.Round)
+	}
+	if p.Regras.Classico {
+		return p.resolverClassico(), nil
+	}
+
+	r := RoundResolvido{Round: p.Round, Jogadas: p.jogadas, Regras: p.RegrasDoRound()}
+	for lado, j := range p.jogadas {
+		if !j.SemJogada {
+			r.Cartas[lado] = p.Maos[lado][j.Carta]
+		}
+	}
+	r.Outcome = ResolveRound(r.Cartas[LadoA], r.Cartas[LadoB], p.jogadas[LadoA].Atributo, p.jogadas[LadoB].Atributo, r.Regras)
+
+	// Quem ficou sem jogada perde o round, e o outro leva os pontos de quem
+	// ganha nas duas
+	semA, semB := p.jogadas[LadoA].SemJogada, p.jogadas[LadoB].SemJogada
+	if semA || semB {
+		r.PontosA, r.PontosB = 0, 0
+		if !semA {
+			r.PontosA = p.Regras.PontosMaximos()
+		}
+		if !semB {
+			r.PontosB = p.Regras.PontosMaximos()
+		}
+	}
+	p.Placar[LadoA] += r.PontosA
+	p.Placar[LadoB] += r.PontosB
+	r.Vencedor = Nenhum
+	if r.PontosA > r.PontosB {
+		r.Vencedor = LadoA
+	} else if r.PontosB > r.PontosA {
+		r.Vencedor = LadoB
+	}
+
+	// Cada carta é usada uma vez só
+	for lado, j := range p.jogadas {
+		if j.SemJogada {
+			continue
+		}
+		mao := make([]protocolo.Carta, 0, len(p.Maos[lado])-1)
+		mao = append(mao, p.Maos[lado][:j.Carta]...)
+		p.Maos[lado] = append(mao, p.Maos[lado][j.Carta+1:]...)
+	}
+
+	p.Round++
+	p.Estado = EstadoEntreRounds
+	if p.Round > p.Regras.Rounds {
+		p.Estado = EstadoEncerrada
+	}
+	return r, nil
+}
+
+// resolverClassico compara as cartas de cima dos montes no atributo de
+// quem tem a vez. Quem ganha põe as duas (e as da mesa) no fim do monte e
+// fica com a vez; no empate elas vão pra mesa e a vez não muda.
+func (p *Partida) resolverClassico() RoundResolvido {
+	vez, outro := p.Vez, Outro(p.Vez)
+	j := p.jogadas[vez]
+	r := RoundResolvido{Round: p.Round, Vencedor: Nenhum, Regras: p.RegrasDoRound()}
+	r.Jogadas[vez] = j
+	r.Jogadas[outro] = Jogada{Atributo: j.Atributo}
+	for lado := range p.Maos {
+		r.Cartas[lado] = p.Maos[lado][0]
+		p.Maos[lado] = p.Maos[lado][1:]
+	}
+	p.Mesa = append(p.Mesa, r.Cartas[vez], r.Cartas[outro])
+
+	// Quem tem a vez e não escolhe perde o round
+	resultado := Derrota
+	if !j.SemJogada {
+		resultado, r.SuperTrunfo = r.Regras.CompararCartas(r.Cartas[vez], r.Cartas[outro], j.Atributo)
+	}
+	r.Outcome = Outcome{
+		ValorA:      Valor(r.Cartas[LadoA], j.Atributo),
+		ValorB:      Valor(r.Cartas[LadoB], j.Atributo),
+		NoAtributoA: resultado,
+		NoAtributoB: resultado,
+	}
+	if vez == LadoB {
+		r.NoAtributoA = resultado.Inverso()
+		r.NoAtributoB = resultado.Inverso()
+	}
+
+	switch resultado {
+	case Vitoria:
+		r.Vencedor = vez
+	case Derrota:
+		r.Vencedor = outro
+	}
+	if r.Vencedor != Nenhum {
+		if r.Vencedor == LadoA {
+			r.PontosA = len(p.Mesa)
+		} else {
+			r.PontosB = len(p.Mesa)
+		}
+		p.Maos[r.Vencedor] = append(p.Maos[r.Vencedor], p.Mesa...)
+		p.Mesa = nil
+		p.Vez = r.Vencedor
+	}
+	p.Placar = [2]int{len(p.Maos[LadoA]), len(p.Maos[LadoB])}
+
+	p.Round++
+	p.Estado = EstadoEntreRounds
+	if len(p.Maos[LadoA]) == 0 || len(p.Maos[LadoB]) == 0 || p.Round > p.Regras.Rounds {
+		p.Estado = EstadoEncerrada
+	}
+	return r
+}
+
+// Abandonar encerra a partida com derrota do lado que abandonou. O outro
+// leva os rounds que faltavam como vitórias nas duas características (no
+// modo clássico, fica com todas as cartas).
+func (p *Partida) Abandonar(lado int) error {
+	if p.Encerrada() {
+		return ErrEncerrada
+	}
+	if p.Regras.Classico {
+		outro := Outro(lado)
+		p.Maos[outro] = append(append(p.Maos[outro], p.Mesa...), p.Maos[lado]...)
+		p.Maos[lado], p.Mesa = nil, nil
+		p.Placar = [2]int{}
+		p.Placar[outro] = len(p.Maos[outro])
+		p.Abandono = lado
+		p.Estado = EstadoEncerrada
+		return nil
+	}
+	restantes := p.Regras.Rounds - p.Round + 1
+	p.Placar[Outro(lado)] += restantes * p.Regras.PontosMaximos()
+	p.Abandono = lado
+	p.Estado = EstadoEncerrada
+	return nil
+}
+
+// Vencedor é o lado com mais pontos (no clássico, com mais cartas), ou o
+// que não abandonou; Nenhum no empate.
+func (p *Partida) Vencedor() int {
+	if p.Abandono != Nenhum {
+		return Outro(p.Abandono)
+	}
+	switch {
+	case p.Placar[LadoA] > p.Placar[LadoB]:
+		return LadoA
+	case p.Placar[LadoB] > p.Placar[LadoA]:
+		return LadoB
+	}
+	return Nenhum
+}
+
+// Moedas que o lado ganha pela partida; quem abandonou não ganha nada.
+func (p *Partida) Moedas(lado int) int {
+	if p.Abandono == lado {
+		return 0
+	}
+	return p.Regras.Moedas(p.Placar[lado], p.Vencedor() == lado)
+}
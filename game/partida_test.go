@@ -0,0 +1,721 @@
+package game
+
+import (
+	"card_game/protocolo"
+	"testing"
+)
+
+// carta com o mesmo valor em todos os atributos
+func carta(nome string, valor int) protocolo.Carta {
+	return protocolo.Carta{Nome: nome, Envergadura: valor, Velocidade: valor, Altura: valor, Passageiros: valor}
+}
+
+// comValor devolve a carta com outro valor no atributo.
+func comValor(c protocolo.Carta, atributo string, valor int) protocolo.Carta {
+	switch atributo {
+	case "Envergadura":
+		c.Envergadura = valor
+	case "Velocidade":
+		c.Velocidade = valor
+	case "Altura":
+		c.Altura = valor
+	case "Passageiros":
+		c.Passageiros = valor
+	}
+	return c
+}
+
+// valorContra é o valor que a carta de B precisa ter pra A ter o resultado
+// contra uma carta de A com valor 10.
+func valorContra(r Resultado) int {
+	switch r {
+	case Vitoria:
+		return 5
+	case Empate:
+		return 10
+	}
+	return 15
+}
+
+func TestValor(t *testing.T) {
+	c := protocolo.Carta{Envergadura: 1, Velocidade: 2, Altura: 3, Passageiros: 4}
+	for i, atributo := range Atributos {
+		if got := Valor(c, atributo); got != i+1 {
+			t.Errorf("Valor(%s) = %d, esperado %d", atributo, got, i+1)
+		}
+		if !AtributoValido(atributo) {
+			t.Errorf("%s deveria ser válido", atributo)
+		}
+	}
+	if got := Valor(c, "Peso"); got != 0 {
+		t.Errorf("atributo inexistente = %d, esperado 0", got)
+	}
+	if AtributoValido("Peso") || AtributoValido("") || AtributoValido("velocidade") {
+		t.Error("atributo inválido aceito")
+	}
+}
+
+func TestResolveRoundTodasAsCombinacoes(t *testing.T) {
+	for _, regras := range []MatchRules{Padrao(), rapida()} {
+		for _, attrA := range Atributos {
+			for _, attrB := range Atributos {
+				for _, noA := range Resultados {
+					for _, noB := range Resultados {
+						// Com o mesmo atributo os dois resultados são o mesmo
+						if attrA == attrB && noA != noB {
+							continue
+						}
+						cardA := carta("A", 10)
+						cardB := comValor(comValor(carta("B", 10), attrA, valorContra(noA)), attrB, valorContra(noB))
+
+						o := ResolveRound(cardA, cardB, attrA, attrB, regras)
+						caso := attrA + "/" + attrB + " " + noA.String() + "/" + noB.String()
+						if o.NoAtributoA != noA || o.NoAtributoB != noB {
+							t.Errorf("%s: resultados %v/%v", caso, o.NoAtributoA, o.NoAtributoB)
+						}
+						if o.ValorA != 10 || o.ValorB != valorContra(noB) {
+							t.Errorf("%s: valores %d/%d", caso, o.ValorA, o.ValorB)
+						}
+						if want := regras.Pontos(noA, noB); o.PontosA != want {
+							t.Errorf("%s: A fez %d, esperado %d", caso, o.PontosA, want)
+						}
+						if want := regras.Pontos(noB.Inverso(), noA.Inverso()); o.PontosB != want {
+							t.Errorf("%s: B fez %d, esperado %d", caso, o.PontosB, want)
+						}
+
+						// Trocando os jogadores de lugar o round é o mesmo
+						if inv := ResolveRound(cardB, cardA, attrB, attrA, regras); inv != o.Inverso() {
+							t.Errorf("%s: invertido deu %+v, esperado %+v", caso, inv, o.Inverso())
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestResolveRoundPadrao(t *testing.T) {
+	// Pontos dos dois lados na tabela padrão, pelo resultado de A
+	casos := []struct {
+		noA, noB         Resultado
+		pontosA, pontosB int
+	}{
+		{Vitoria, Vitoria, 3, 0},
+		{Vitoria, Empate, 2, 1},
+		{Vitoria, Derrota, 2, 2},
+		{Empate, Vitoria, 2, 1},
+		{Empate, Empate, 2, 2},
+		{Empate, Derrota, 1, 2},
+		{Derrota, Vitoria, 2, 2},
+		{Derrota, Empate, 1, 2},
+		{Derrota, Derrota, 0, 3},
+	}
+	for _, c := range casos {
+		cardB := comValor(comValor(carta("B", 10), "Altura", valorContra(c.noA)), "Velocidade", valorContra(c.noB))
+		o := ResolveRound(carta("A", 10), cardB, "Altura", "Velocidade", Padrao())
+		if o.PontosA != c.pontosA || o.PontosB != c.pontosB {
+			t.Errorf("%v/%v: %d x %d, esperado %d x %d", c.noA, c.noB, o.PontosA, o.PontosB, c.pontosA, c.pontosB)
+		}
+	}
+}
+
+func TestResolveRoundCartasIguais(t *testing.T) {
+	c := carta("X", 7)
+	o := ResolveRound(c, c, "Altura", "Passageiros", Padrao())
+	if o.NoAtributoA != Empate || o.NoAtributoB != Empate || o.PontosA != o.PontosB {
+		t.Errorf("cartas iguais: %+v", o)
+	}
+}
+
+func maos() ([]protocolo.Carta, []protocolo.Carta) {
+	return []protocolo.Carta{carta("A1", 10), carta("A2", 20), carta("A3", 30), carta("A4", 40)},
+		[]protocolo.Carta{carta("B1", 15), carta("B2", 20), carta("B3", 25), carta("B4", 35)}
+}
+
+// jogar abre o round, joga as duas jogadas e resolve.
+func jogar(t *testing.T, p *Partida, a, b Jogada) RoundResolvido {
+	t.Helper()
+	if err := p.IniciarRound(); err != nil {
+		t.Fatalf("IniciarRound: %v", err)
+	}
+	if err := p.Jogar(LadoA, a); err != nil {
+		t.Fatalf("Jogar A: %v", err)
+	}
+	if p.Completo() {
+		t.Fatal("completo com uma jogada só")
+	}
+	if err := p.Jogar(LadoB, b); err != nil {
+		t.Fatalf("Jogar B: %v", err)
+	}
+	r, err := p.ResolverRound()
+	if err != nil {
+		t.Fatalf("ResolverRound: %v", err)
+	}
+	return r
+}
+
+func TestPartidaCompleta(t *testing.T) {
+	maoA, maoB := maos()
+	p := NovaPartida(Padrao(), maoA, maoB)
+	if p.Round != 1 || p.Estado != EstadoEntreRounds || p.Abandono != Nenhum {
+		t.Fatalf("partida nova: %+v", p)
+	}
+
+	// Round 1: A1 (10) perde de B1 (15) nos dois atributos
+	r := jogar(t, p, Jogada{Carta: 0, Atributo: "Altura"}, Jogada{Carta: 0, Atributo: "Velocidade"})
+	if r.Round != 1 || r.Cartas[LadoA].Nome != "A1" || r.Cartas[LadoB].Nome != "B1" || r.PontosA != 0 || r.PontosB != 3 {
+		t.Errorf("round 1: %+v", r)
+	}
+	if p.Round != 2 || p.Estado != EstadoEntreRounds || len(p.Maos[LadoA]) != 3 || len(p.Maos[LadoB]) != 3 {
+		t.Errorf("depois do round 1: round %d, estado %d, mãos %d/%d", p.Round, p.Estado, len(p.Maos[LadoA]), len(p.Maos[LadoB]))
+	}
+	if p.Maos[LadoA][0].Nome != "A2" {
+		t.Errorf("a carta usada continuou na mão: %v", p.Maos[LadoA])
+	}
+
+	// Round 2: A4 (40) contra B2 (20)
+	jogar(t, p, Jogada{Carta: 2, Atributo: "Envergadura"}, Jogada{Carta: 0, Atributo: "Passageiros"})
+	// Round 3: A2 (20) contra B3 (25), já que B2 foi usada
+	r = jogar(t, p, Jogada{Carta: 0, Atributo: "Altura"}, Jogada{Carta: 0, Atributo: "Altura"})
+	if r.Cartas[LadoB].Nome != "B3" {
+		t.Errorf("round 3: B jogou %s", r.Cartas[LadoB].Nome)
+	}
+
+	if !p.Encerrada() || p.Round != 4 {
+		t.Fatalf("a partida não terminou: round %d, estado %d", p.Round, p.Estado)
+	}
+	if p.Placar != [2]int{3, 6} {
+		t.Errorf("placar %v, esperado [3 6]", p.Placar)
+	}
+	if p.Vencedor() != LadoB {
+		t.Errorf("vencedor %d", p.Vencedor())
+	}
+	if p.Moedas(LadoA) != 3 || p.Moedas(LadoB) != 6 {
+		t.Errorf("moedas %d/%d", p.Moedas(LadoA), p.Moedas(LadoB))
+	}
+	if err := p.IniciarRound(); err == nil {
+		t.Error("abriu round depois do fim")
+	}
+	if err := p.Jogar(LadoA, Jogada{Carta: 0, Atributo: "Altura"}); err != ErrEncerrada {
+		t.Errorf("jogada depois do fim: %v", err)
+	}
+}
+
+func TestJogadasRecusadas(t *testing.T) {
+	maoA, maoB := maos()
+	p := NovaPartida(Padrao(), maoA, maoB)
+	valida := Jogada{Carta: 0, Atributo: "Altura"}
+
+	if err := p.Jogar(LadoA, valida); err != ErrForaDoRound {
+		t.Errorf("antes do round: %v", err)
+	}
+	if _, err := p.ResolverRound(); err == nil {
+		t.Error("resolveu sem round aberto")
+	}
+	p.IniciarRound()
+	if err := p.IniciarRound(); err == nil {
+		t.Error("abriu o mesmo round duas vezes")
+	}
+
+	casos := []struct {
+		nome string
+		j    Jogada
+		err  error
+	}{
+		{"carta negativa", Jogada{Carta: -1, Atributo: "Altura"}, ErrCartaInvalida},
+		{"carta fora da mão", Jogada{Carta: 4, Atributo: "Altura"}, ErrCartaInvalida},
+		{"atributo vazio", Jogada{Carta: 0}, ErrAtributoInvalido},
+		{"atributo inexistente", Jogada{Carta: 0, Atributo: "Peso"}, ErrAtributoInvalido},
+	}
+	for _, c := range casos {
+		if err := p.Jogar(LadoA, c.j); err != c.err {
+			t.Errorf("%s: %v, esperado %v", c.nome, err, c.err)
+		}
+	}
+	if p.Jogou(LadoA) {
+		t.Fatal("jogada recusada ficou registrada")
+	}
+
+	if err := p.Jogar(LadoA, valida); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Jogar(LadoA, valida); err != ErrJogadaRepetida {
+		t.Errorf("jogada repetida: %v", err)
+	}
+	if _, err := p.ResolverRound(); err == nil {
+		t.Error("resolveu com uma jogada só")
+	}
+	p.Jogar(LadoB, valida)
+	p.ResolverRound()
+	if err := p.Jogar(LadoA, valida); err != ErrForaDoRound {
+		t.Errorf("entre rounds: %v", err)
+	}
+}
+
+func TestSemJogada(t *testing.T) {
+	casos := []struct {
+		nome             string
+		a, b             Jogada
+		pontosA, pontosB int
+		maoA, maoB       int
+	}{
+		{"A sem jogada", Jogada{SemJogada: true}, Jogada{Carta: 0, Atributo: "Altura"}, 0, 3, 4, 3},
+		{"B sem jogada", Jogada{Carta: 0, Atributo: "Altura"}, Jogada{SemJogada: true}, 3, 0, 3, 4},
+		{"os dois sem jogada", Jogada{SemJogada: true}, Jogada{SemJogada: true}, 0, 0, 4, 4},
+		{"automática conta normal", Jogada{Carta: 3, Atributo: "Altura", Automatica: true}, Jogada{Carta: 0, Atributo: "Altura"}, 3, 0, 3, 3},
+	}
+	for _, c := range casos {
+		maoA, maoB := maos()
+		p := NovaPartida(Padrao(), maoA, maoB)
+		r := jogar(t, p, c.a, c.b)
+		if r.PontosA != c.pontosA || r.PontosB != c.pontosB {
+			t.Errorf("%s: %d x %d, esperado %d x %d", c.nome, r.PontosA, r.PontosB, c.pontosA, c.pontosB)
+		}
+		if len(p.Maos[LadoA]) != c.maoA || len(p.Maos[LadoB]) != c.maoB {
+			t.Errorf("%s: mãos %d/%d, esperado %d/%d", c.nome, len(p.Maos[LadoA]), len(p.Maos[LadoB]), c.maoA, c.maoB)
+		}
+		if c.a.SemJogada && r.Cartas[LadoA].Nome != "" {
+			t.Errorf("%s: A sem jogada com carta %s", c.nome, r.Cartas[LadoA].Nome)
+		}
+	}
+}
+
+func TestAbandono(t *testing.T) {
+	for _, lado := range []int{LadoA, LadoB} {
+		maoA, maoB := maos()
+		p := NovaPartida(Padrao(), maoA, maoB)
+		// Round 1: A4 (40) ganha de B1 (15) nos dois
+		jogar(t, p, Jogada{Carta: 3, Atributo: "Altura"}, Jogada{Carta: 0, Atributo: "Altura"})
+
+		// Abandono com o round 2 aberto: o outro leva os rounds 2 e 3
+		p.IniciarRound()
+		antes := p.Placar
+		if err := p.Abandonar(lado); err != nil {
+			t.Fatal(err)
+		}
+		outro := Outro(lado)
+		if p.Placar[outro] != antes[outro]+6 || p.Placar[lado] != antes[lado] {
+			t.Errorf("abandono de %d: placar %v, antes %v", lado, p.Placar, antes)
+		}
+		if !p.Encerrada() || p.Abandono != lado || p.Vencedor() != outro {
+			t.Errorf("abandono de %d: estado %d, abandono %d, vencedor %d", lado, p.Estado, p.Abandono, p.Vencedor())
+		}
+		if p.Moedas(lado) != 0 || p.Moedas(outro) != p.Placar[outro] {
+			t.Errorf("abandono de %d: moedas %d/%d", lado, p.Moedas(LadoA), p.Moedas(LadoB))
+		}
+		if err := p.Abandonar(outro); err != ErrEncerrada {
+			t.Errorf("abandono depois do fim: %v", err)
+		}
+	}
+
+	// Quem abandona perde mesmo se estiver na frente
+	maoA, maoB := maos()
+	p := NovaPartida(rapida(), maoA, maoB)
+	p.Placar = [2]int{10, 0}
+	p.Abandonar(LadoA)
+	if p.Vencedor() != LadoB || p.Moedas(LadoB) != rapida().Moedas(5, true) {
+		t.Errorf("vencedor %d com placar %v e %d moedas", p.Vencedor(), p.Placar, p.Moedas(LadoB))
+	}
+}
+
+func TestPartidaSimetrica(t *testing.T) {
+	// A mesma partida com os jogadores trocados de lado dá o placar trocado
+	jogadas := [][2]Jogada{
+		{{Carta: 1, Atributo: "Altura"}, {Carta: 3, Atributo: "Velocidade"}},
+		{{Carta: 0, Atributo: "Passageiros"}, {Carta: 0, Atributo: "Envergadura"}},
+		{{SemJogada: true}, {Carta: 1, Atributo: "Altura"}},
+	}
+	maoA, maoB := maos()
+	p := NovaPartida(Padrao(), maoA, maoB)
+	maoA, maoB = maos()
+	q := NovaPartida(Padrao(), maoB, maoA)
+	for i, j := range jogadas {
+		r := jogar(t, p, j[0], j[1])
+		s := jogar(t, q, j[1], j[0])
+		if s.Outcome != r.Outcome.Inverso() || s.Cartas[LadoA] != r.Cartas[LadoB] {
+			t.Errorf("round %d: %+v invertido deu %+v", i+1, r, s)
+		}
+	}
+	if p.Placar[LadoA] != q.Placar[LadoB] || p.Placar[LadoB] != q.Placar[LadoA] {
+		t.Errorf("placares %v e %v", p.Placar, q.Placar)
+	}
+	if p.Vencedor() == Nenhum || q.Vencedor() != Outro(p.Vencedor()) {
+		t.Errorf("vencedores %d e %d", p.Vencedor(), q.Vencedor())
+	}
+	if p.Moedas(LadoA) != q.Moedas(LadoB) || p.Moedas(LadoB) != q.Moedas(LadoA) {
+		t.Error("moedas diferentes")
+	}
+}
+
+func TestEmpate(t *testing.T) {
+	c := []protocolo.Carta{carta("X", 10), carta("Y", 10), carta("Z", 10), carta("W", 10)}
+	p := NovaPartida(rapida(), c, c)
+	jogar(t, p, Jogada{Carta: 0, Atributo: "Altura"}, Jogada{Carta: 1, Atributo: "Velocidade"})
+	if !p.Encerrada() || p.Vencedor() != Nenhum {
+		t.Fatalf("estado %d, vencedor %d", p.Estado, p.Vencedor())
+	}
+	// Sem vencedor, ninguém leva o bônus
+	if p.Moedas(LadoA) != 2 || p.Moedas(LadoB) != 2 {
+		t.Errorf("moedas %d/%d", p.Moedas(LadoA), p.Moedas(LadoB))
+	}
+}
+
+// Modo clássico com o Super Trunfo "ST", que só perde pras cartas comuns
+func classico() MatchRules {
+	return MatchRules{
+		Rounds:         40,
+		TamanhoDeck:    4,
+		TamanhoMao:     2,
+		MoedasPorPonto: 1,
+		MoedasVitoria:  3,
+		Classico:       true,
+		SuperTrunfo:    "ST",
+		ContraTrunfo:   "Comum",
+	}
+}
+
+func nomes(cartas []protocolo.Carta) string {
+	s := ""
+	for _, c := range cartas {
+		s += c.Nome + " "
+	}
+	return s
+}
+
+func TestCompararCartas(t *testing.T) {
+	trunfo := protocolo.Carta{Nome: "ST", Raridade: "Muito Rara", Altura: 1}
+	rara := protocolo.Carta{Nome: "R", Raridade: "Rara", Altura: 50}
+	comum := protocolo.Carta{Nome: "C", Raridade: "Comum", Altura: 1}
+	casos := []struct {
+		nome      string
+		a, b      protocolo.Carta
+		resultado Resultado
+		trunfo    bool
+	}{
+		{"trunfo contra rara", trunfo, rara, Vitoria, true},
+		{"trunfo contra comum", trunfo, comum, Derrota, true},
+		{"rara contra rara", rara, rara, Empate, false},
+		{"rara contra comum", rara, comum, Vitoria, false},
+		{"trunfo contra trunfo", trunfo, trunfo, Empate, false},
+	}
+	for _, c := range casos {
+		r, trunfo := classico().CompararCartas(c.a, c.b, "Altura")
+		if r != c.resultado || trunfo != c.trunfo {
+			t.Errorf("%s: %v (trunfo %v), esperado %v (trunfo %v)", c.nome, r, trunfo, c.resultado, c.trunfo)
+		}
+		// O mesmo duelo visto do outro lado
+		r, trunfo = classico().CompararCartas(c.b, c.a, "Altura")
+		if r != c.resultado.Inverso() || trunfo != c.trunfo {
+			t.Errorf("%s invertido: %v (trunfo %v)", c.nome, r, trunfo)
+		}
+	}
+	// Sem Super Trunfo nas regras a carta vale pelos atributos
+	if r, trunfo := Padrao().CompararCartas(trunfo, rara, "Altura"); r != Derrota || trunfo {
+		t.Errorf("sem Super Trunfo: %v (trunfo %v)", r, trunfo)
+	}
+}
+
+// escolher abre o round e faz a jogada de quem tem a vez.
+func escolher(t *testing.T, p *Partida, j Jogada) RoundResolvido {
+	t.Helper()
+	if err := p.IniciarRound(); err != nil {
+		t.Fatalf("IniciarRound: %v", err)
+	}
+	if err := p.Jogar(Outro(p.Vez), j); err != ErrForaDaVez {
+		t.Errorf("quem não tem a vez jogou: %v", err)
+	}
+	if p.Espera(Outro(p.Vez)) || !p.Espera(p.Vez) {
+		t.Error("esperando o lado errado")
+	}
+	if err := p.Jogar(p.Vez, j); err != nil {
+		t.Fatalf("Jogar: %v", err)
+	}
+	r, err := p.ResolverRound()
+	if err != nil {
+		t.Fatalf("ResolverRound: %v", err)
+	}
+	return r
+}
+
+func TestClassicoCapturaEVez(t *testing.T) {
+	p := NovaPartida(classico(),
+		[]protocolo.Carta{carta("A1", 10), carta("A2", 40)},
+		[]protocolo.Carta{carta("B1", 20), carta("B2", 30)})
+	if p.Placar != [2]int{2, 2} || p.Vez != LadoA {
+		t.Fatalf("início: placar %v, vez %d", p.Placar, p.Vez)
+	}
+	if len(p.Mao(LadoA)) != 1 || p.Mao(LadoA)[0].Nome != "A1" {
+		t.Errorf("mão do clássico: %s", nomes(p.Mao(LadoA)))
+	}
+	if err := p.IniciarRound(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Jogar(LadoA, Jogada{Carta: 1, Atributo: "Altura"}); err != ErrCartaInvalida {
+		t.Errorf("carta de baixo do monte: %v", err)
+	}
+	if err := p.Jogar(LadoB, Jogada{Atributo: "Altura"}); err != ErrForaDaVez {
+		t.Errorf("quem não tem a vez jogou: %v", err)
+	}
+
+	// A1 (10) perde de B1 (20): B leva as duas e a vez
+	if err := p.Jogar(LadoA, Jogada{Atributo: "Altura"}); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Completo() {
+		t.Fatal("no clássico basta a jogada de quem tem a vez")
+	}
+	r, err := p.ResolverRound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Vencedor != LadoB || r.PontosB != 2 || r.PontosA != 0 || r.ValorA != 10 || r.ValorB != 20 {
+		t.Errorf("round 1: %+v", r)
+	}
+	if r.Jogadas[LadoB].Atributo != "Altura" || r.NoAtributoA != Derrota {
+		t.Errorf("round 1: B devia aparecer com o atributo de A: %+v", r)
+	}
+	if p.Vez != LadoB || p.Placar != [2]int{1, 3} || nomes(p.Maos[LadoB]) != "B2 A1 B1 " {
+		t.Errorf("depois do round 1: vez %d, placar %v, monte B %s", p.Vez, p.Placar, nomes(p.Maos[LadoB]))
+	}
+
+	// B2 (30) perde de A2 (40): a vez volta pra A
+	r = escolher(t, p, Jogada{Atributo: "Velocidade"})
+	if r.Vencedor != LadoA || r.PontosA != 2 || r.NoAtributoA != Vitoria || p.Vez != LadoA {
+		t.Errorf("round 2: %+v, vez %d", r, p.Vez)
+	}
+
+	// A ganha os dois últimos e fica com todas
+	escolher(t, p, Jogada{Atributo: "Passageiros"})
+	escolher(t, p, Jogada{Atributo: "Passageiros"})
+	if !p.Encerrada() || p.Placar != [2]int{4, 0} || p.Vencedor() != LadoA {
+		t.Fatalf("fim: estado %d, placar %v, vencedor %d", p.Estado, p.Placar, p.Vencedor())
+	}
+	if p.Moedas(LadoA) != 7 || p.Moedas(LadoB) != 0 {
+		t.Errorf("moedas %d/%d", p.Moedas(LadoA), p.Moedas(LadoB))
+	}
+}
+
+func TestClassicoEmpateVaiPraMesa(t *testing.T) {
+	p := NovaPartida(classico(),
+		[]protocolo.Carta{carta("X", 10), carta("Y", 50)},
+		[]protocolo.Carta{carta("Z", 10), carta("W", 5)})
+	r := escolher(t, p, Jogada{Atributo: "Altura"})
+	if r.Vencedor != Nenhum || r.PontosA != 0 || r.PontosB != 0 {
+		t.Errorf("empate: %+v", r)
+	}
+	if len(p.Mesa) != 2 || p.Vez != LadoA || p.Placar != [2]int{1, 1} {
+		t.Errorf("depois do empate: mesa %d, vez %d, placar %v", len(p.Mesa), p.Vez, p.Placar)
+	}
+
+	// Quem ganha o próximo leva as da mesa também
+	r = escolher(t, p, Jogada{Atributo: "Altura"})
+	if r.PontosA != 4 || len(p.Mesa) != 0 || p.Placar != [2]int{4, 0} || !p.Encerrada() {
+		t.Errorf("depois da mesa: %+v, mesa %d, placar %v", r, len(p.Mesa), p.Placar)
+	}
+}
+
+func TestClassicoSuperTrunfo(t *testing.T) {
+	trunfo := carta("ST", 1)
+	trunfo.Raridade = "Muito Rara"
+	comum := carta("C", 1)
+	comum.Raridade = "Comum"
+
+	// O Super Trunfo ganha mesmo com atributos piores
+	p := NovaPartida(classico(), []protocolo.Carta{trunfo, carta("A2", 1)}, []protocolo.Carta{carta("R", 99), carta("B2", 1)})
+	r := escolher(t, p, Jogada{Atributo: "Altura"})
+	if r.Vencedor != LadoA || !r.SuperTrunfo {
+		t.Errorf("trunfo contra rara: %+v", r)
+	}
+
+	// Mas perde pra comum, mesmo sendo de quem não escolheu
+	p = NovaPartida(classico(), []protocolo.Carta{comum, carta("A2", 1)}, []protocolo.Carta{trunfo, carta("B2", 1)})
+	r = escolher(t, p, Jogada{Atributo: "Altura"})
+	if r.Vencedor != LadoA || !r.SuperTrunfo || p.Vez != LadoA {
+		t.Errorf("comum contra trunfo: %+v", r)
+	}
+}
+
+func TestClassicoSemJogada(t *testing.T) {
+	p := NovaPartida(classico(), []protocolo.Carta{carta("A1", 99), carta("A2", 99)}, []protocolo.Carta{carta("B1", 1), carta("B2", 1)})
+	r := escolher(t, p, Jogada{SemJogada: true})
+	if r.Vencedor != LadoB || r.PontosB != 2 || p.Vez != LadoB || r.Cartas[LadoA].Nome != "A1" {
+		t.Errorf("sem jogada: %+v, vez %d", r, p.Vez)
+	}
+}
+
+func TestClassicoLimiteDeRounds(t *testing.T) {
+	regras := classico()
+	regras.Rounds = 1
+	p := NovaPartida(regras, []protocolo.Carta{carta("A1", 99), carta("A2", 1)}, []protocolo.Carta{carta("B1", 1), carta("B2", 1)})
+	escolher(t, p, Jogada{Atributo: "Altura"})
+	if !p.Encerrada() || p.Placar != [2]int{3, 1} || p.Vencedor() != LadoA {
+		t.Errorf("limite: estado %d, placar %v, vencedor %d", p.Estado, p.Placar, p.Vencedor())
+	}
+}
+
+func TestClassicoAbandono(t *testing.T) {
+	p := NovaPartida(classico(),
+		[]protocolo.Carta{carta("X", 10), carta("Y", 50)},
+		[]protocolo.Carta{carta("Z", 10), carta("W", 5)})
+	escolher(t, p, Jogada{Atributo: "Altura"}) // empate, 2 na mesa
+	p.IniciarRound()
+	if err := p.Abandonar(LadoA); err != nil {
+		t.Fatal(err)
+	}
+	if p.Placar != [2]int{0, 4} || len(p.Maos[LadoB]) != 4 || p.Vencedor() != LadoB || p.Moedas(LadoA) != 0 {
+		t.Errorf("abandono: placar %v, monte B %s, vencedor %d", p.Placar, nomes(p.Maos[LadoB]), p.Vencedor())
+	}
+}
+
+func TestClassicoSimetrico(t *testing.T) {
+	// Mesma partida com os lados trocados (e B começando) dá tudo trocado
+	a := []protocolo.Carta{carta("A1", 10), carta("A2", 40), carta("A3", 25)}
+	b := []protocolo.Carta{carta("B1", 20), carta("B2", 30), carta("B3", 25)}
+	p := NovaPartida(classico(), append([]protocolo.Carta(nil), a...), append([]protocolo.Carta(nil), b...))
+	q := NovaPartida(classico(), append([]protocolo.Carta(nil), b...), append([]protocolo.Carta(nil), a...))
+	q.Vez = LadoB
+	for i := 0; !p.Encerrada(); i++ {
+		r := escolher(t, p, Jogada{Atributo: Atributos[i%len(Atributos)]})
+		s := escolher(t, q, Jogada{Atributo: Atributos[i%len(Atributos)]})
+		vencedor := Nenhum
+		if r.Vencedor != Nenhum {
+			vencedor = Outro(r.Vencedor)
+		}
+		if s.Outcome != r.Outcome.Inverso() || s.Vencedor != vencedor {
+			t.Fatalf("round %d: %+v invertido deu %+v", i+1, r, s)
+		}
+		if q.Placar[LadoA] != p.Placar[LadoB] || q.Placar[LadoB] != p.Placar[LadoA] || q.Vez != Outro(p.Vez) {
+			t.Fatalf("round %d: placares %v e %v", i+1, p.Placar, q.Placar)
+		}
+	}
+	if !q.Encerrada() || q.Vencedor() != Outro(p.Vencedor()) {
+		t.Errorf("vencedores %d e %d", p.Vencedor(), q.Vencedor())
+	}
+}
+
+func TestPolaridadeTodasAsCombinacoes(t *testing.T) {
+	for _, invertido := range Atributos {
+		regras := Padrao().ComInversao(invertido)
+		for _, attrA := range Atributos {
+			for _, attrB := range Atributos {
+				for _, noA := range Resultados {
+					for _, noB := range Resultados {
+						if attrA == attrB && noA != noB {
+							continue
+						}
+						cardA := carta("A", 10)
+						cardB := comValor(comValor(carta("B", 10), attrA, valorContra(noA)), attrB, valorContra(noB))
+
+						// No atributo invertido quem tem o valor maior perde
+						esperadoA, esperadoB := noA, noB
+						if attrA == invertido {
+							esperadoA = noA.Inverso()
+						}
+						if attrB == invertido {
+							esperadoB = noB.Inverso()
+						}
+
+						o := ResolveRound(cardA, cardB, attrA, attrB, regras)
+						caso := "menor " + invertido + ": " + attrA + "/" + attrB + " " + noA.String() + "/" + noB.String()
+						if o.NoAtributoA != esperadoA || o.NoAtributoB != esperadoB {
+							t.Errorf("%s: resultados %v/%v, esperado %v/%v", caso, o.NoAtributoA, o.NoAtributoB, esperadoA, esperadoB)
+						}
+						if o.PontosA != regras.Pontos(esperadoA, esperadoB) || o.PontosB != regras.Pontos(esperadoB.Inverso(), esperadoA.Inverso()) {
+							t.Errorf("%s: pontos %d x %d", caso, o.PontosA, o.PontosB)
+						}
+						if inv := ResolveRound(cardB, cardA, attrB, attrA, regras); inv != o.Inverso() {
+							t.Errorf("%s: invertido deu %+v, esperado %+v", caso, inv, o.Inverso())
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestMenorEnvergaduraGanha(t *testing.T) {
+	// Uma carta fraca passa a valer num round de "menor envergadura ganha"
+	twinOtter := protocolo.Carta{Nome: "De Havilland Canada DHC-6 Twin Otter", Envergadura: 20, Velocidade: 314, Altura: 7600, Passageiros: 19}
+	a380 := protocolo.Carta{Nome: "Airbus A380", Envergadura: 80, Velocidade: 1020, Altura: 13100, Passageiros: 850}
+
+	if o := ResolveRound(twinOtter, a380, "Envergadura", "Envergadura", Padrao()); o.PontosA != 0 {
+		t.Errorf("normal: Twin Otter fez %d", o.PontosA)
+	}
+	regras := Padrao()
+	regras.Invertidos = []string{"Envergadura"}
+	if o := ResolveRound(twinOtter, a380, "Envergadura", "Envergadura", regras); o.PontosA != 3 || o.PontosB != 0 {
+		t.Errorf("menor ganha: %d x %d", o.PontosA, o.PontosB)
+	}
+	// Só o atributo invertido muda
+	if o := ResolveRound(twinOtter, a380, "Envergadura", "Passageiros", regras); o.NoAtributoA != Vitoria || o.NoAtributoB != Derrota {
+		t.Errorf("atributos misturados: %v/%v", o.NoAtributoA, o.NoAtributoB)
+	}
+}
+
+func TestInversaoSorteada(t *testing.T) {
+	regras := Padrao()
+	regras.Rounds, regras.TamanhoMao, regras.TamanhoDeck = 50, 50, 50
+	regras.Invertidos = []string{"Envergadura"}
+	regras.ChanceInversao = 100
+	mao := make([]protocolo.Carta, 50)
+	p := NovaPartida(regras, mao, append([]protocolo.Carta(nil), mao...))
+	sorteados := make(map[string]bool)
+	for !p.Encerrada() {
+		p.IniciarRound()
+		if p.Invertido == "" || p.Invertido == "Envergadura" {
+			t.Fatalf("round %d: sorteou %q", p.Round, p.Invertido)
+		}
+		sorteados[p.Invertido] = true
+		doRound := p.RegrasDoRound()
+		if !doRound.MenorGanha("Envergadura") || !doRound.MenorGanha(p.Invertido) {
+			t.Errorf("round %d: regras do round %v", p.Round, doRound.Invertidos)
+		}
+		p.Jogar(LadoA, Jogada{Carta: 0, Atributo: "Altura"})
+		p.Jogar(LadoB, Jogada{Carta: 0, Atributo: "Altura"})
+		r, _ := p.ResolverRound()
+		if len(r.Regras.Invertidos) != 2 {
+			t.Errorf("round %d: resultado com %v", r.Round, r.Regras.Invertidos)
+		}
+	}
+	// A inversão de um round não fica nas regras da partida
+	if len(p.Regras.Invertidos) != 1 || len(regras.Invertidos) != 1 {
+		t.Errorf("regras alteradas: %v", p.Regras.Invertidos)
+	}
+	if len(sorteados) != 3 {
+		t.Errorf("em 50 rounds só saíram %v", sorteados)
+	}
+
+	regras.ChanceInversao = 0
+	p = NovaPartida(regras, mao, mao)
+	p.IniciarRound()
+	if p.Invertido != "" {
+		t.Errorf("sem chance sorteou %q", p.Invertido)
+	}
+}
+
+func TestPartidaComInversao(t *testing.T) {
+	maoA, maoB := maos()
+	p := NovaPartida(Padrao(), maoA, maoB)
+	p.IniciarRound()
+	p.Invertido = "Altura"
+	// A1 (10) contra B1 (15): perde na Velocidade, mas ganha na Altura invertida
+	p.Jogar(LadoA, Jogada{Carta: 0, Atributo: "Altura"})
+	p.Jogar(LadoB, Jogada{Carta: 0, Atributo: "Velocidade"})
+	r, err := p.ResolverRound()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.NoAtributoA != Vitoria || r.NoAtributoB != Derrota || r.PontosA != 2 || r.PontosB != 2 {
+		t.Errorf("round com Altura invertida: %+v", r)
+	}
+
+	// No clássico vale o mesmo, inclusive contra quem escolheu
+	c := NovaPartida(classico(), []protocolo.Carta{carta("A1", 10), carta("A2", 1)}, []protocolo.Carta{carta("B1", 15), carta("B2", 1)})
+	c.IniciarRound()
+	c.Invertido = "Passageiros"
+	c.Jogar(LadoA, Jogada{Atributo: "Passageiros"})
+	r, _ = c.ResolverRound()
+	if r.Vencedor != LadoA || !r.Regras.MenorGanha("Passageiros") {
+		t.Errorf("clássico com Passageiros invertido: %+v", r)
+	}
+}
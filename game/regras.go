@@ -0,0 +1,198 @@
+// Package game tem as regras das partidas, separadas do servidor pra poderem
+// ser testadas sem sockets.
+package game
+
+import "fmt"
+
+// Resultado de um atributo comparado, do ponto de vista de um jogador.
+// Os valores servem de índice na MatchRules.Pontuacao.
+type Resultado int
+
+const (
+	Vitoria Resultado = iota
+	Empate
+	Derrota
+)
+
+// Resultados em ordem, pra percorrer a tabela de pontuação.
+var Resultados = []Resultado{Vitoria, Empate, Derrota}
+
+func (r Resultado) String() string {
+	switch r {
+	case Vitoria:
+		return "vitória"
+	case Empate:
+		return "empate"
+	case Derrota:
+		return "derrota"
+	}
+	return fmt.Sprintf("Resultado(%d)", int(r))
+}
+
+// Inverso é o mesmo resultado visto pelo adversário.
+func (r Resultado) Inverso() Resultado {
+	return Derrota - r
+}
+
+// Comparar compara o valor de a com o de b no mesmo atributo (maior ganha;
+// a polaridade das regras fica em MatchRules.CompararNo).
+func Comparar(a, b int) Resultado {
+	if a > b {
+		return Vitoria
+	}
+	if a < b {
+		return Derrota
+	}
+	return Empate
+}
+
+// MatchRules é uma modalidade de partida, lida da seção "regras" da
+// configuração e escolhida na criação da sala.
+type MatchRules struct {
+	Rounds      int `json:"rounds"`       // rounds por partida
+	TamanhoDeck int `json:"tamanho_deck"` // cartas que o deck do jogador precisa ter
+	TamanhoMao  int `json:"tamanho_mao"`  // cartas do deck sorteadas pra mão no início (cada round gasta uma)
+
+	// Pontuacao[próprio][adversário]: pontos de um jogador no round pelo
+	// resultado no atributo que ele escolheu e no que o adversário escolheu.
+	Pontuacao [3][3]int `json:"pontuacao"`
+
+	MoedasPorPonto int `json:"moedas_por_ponto"` // moedas que cada ponto da partida rende
+	MoedasVitoria  int `json:"moedas_vitoria"`   // bônus de quem vence (não vale no empate)
+
+	// Modo clássico do Super Trunfo: a mão vira um monte, só quem tem a vez
+	// escolhe o atributo da carta de cima, quem ganha leva as duas cartas e
+	// a vez, e a partida acaba quando um lado fica com todas (ou quando
+	// passa de Rounds, que aqui é só um limite). Os pontos são as cartas de
+	// cada monte, e a Pontuacao não é usada.
+	Classico     bool   `json:"classico,omitempty"`
+	SuperTrunfo  string `json:"super_trunfo,omitempty"`  // nome da carta que ganha de qualquer outra...
+	ContraTrunfo string `json:"contra_trunfo,omitempty"` // ...menos das cartas desta raridade
+
+	// Polaridade: nos atributos Invertidos o menor valor é que ganha, a
+	// partida inteira. Além disso, cada round tem ChanceInversao% de chance
+	// de sortear mais um atributo em que o menor ganha, só naquele round.
+	Invertidos     []string `json:"invertidos,omitempty"`
+	ChanceInversao int      `json:"chance_inversao,omitempty"`
+}
+
+// Padrao é a partida original: 3 rounds com a mão inteira de um deck de 4
+// cartas, e cada ponto vale uma moeda.
+func Padrao() MatchRules {
+	return MatchRules{
+		Rounds:      3,
+		TamanhoDeck: 4,
+		TamanhoMao:  4,
+		Pontuacao: [3][3]int{
+			{3, 2, 2}, // venceu no próprio atributo
+			{2, 2, 1}, // empatou
+			{2, 1, 0}, // perdeu
+		},
+		MoedasPorPonto: 1,
+	}
+}
+
+// Validar confere se dá pra jogar uma partida com as regras.
+func (r MatchRules) Validar() error {
+	if r.Rounds < 1 {
+		return fmt.Errorf("rounds deve ser pelo menos 1")
+	}
+	if r.TamanhoMao < 1 {
+		return fmt.Errorf("a mão precisa ter pelo menos 1 carta")
+	}
+	// No clássico as cartas voltam pro monte, e a mão não precisa dar pra todos os rounds
+	if !r.Classico && r.TamanhoMao < r.Rounds {
+		return fmt.Errorf("a mão (%d cartas) não dá pros %d rounds", r.TamanhoMao, r.Rounds)
+	}
+	if !r.Classico && (r.SuperTrunfo != "" || r.ContraTrunfo != "") {
+		return fmt.Errorf("super_trunfo e contra_trunfo são só do modo clássico")
+	}
+	if r.SuperTrunfo == "" && r.ContraTrunfo != "" {
+		return fmt.Errorf("contra_trunfo sem super_trunfo")
+	}
+	if r.TamanhoDeck < r.TamanhoMao {
+		return fmt.Errorf("o deck (%d cartas) é menor que a mão (%d)", r.TamanhoDeck, r.TamanhoMao)
+	}
+	if r.MoedasPorPonto < 0 || r.MoedasVitoria < 0 {
+		return fmt.Errorf("moedas negativas")
+	}
+	vistos := make(map[string]bool)
+	for _, atributo := range r.Invertidos {
+		if !AtributoValido(atributo) || vistos[atributo] {
+			return fmt.Errorf("atributo invertido inválido ou repetido: %q", atributo)
+		}
+		vistos[atributo] = true
+	}
+	if r.ChanceInversao < 0 || r.ChanceInversao > 100 {
+		return fmt.Errorf("chance_inversao deve ficar entre 0 e 100")
+	}
+	if r.ChanceInversao > 0 && len(r.Invertidos) == len(Atributos) {
+		return fmt.Errorf("chance_inversao sem nenhum atributo normal para inverter")
+	}
+
+	// Um resultado melhor, em qualquer um dos atributos, nunca pode valer menos
+	for _, proprio := range Resultados {
+		for _, adversario := range Resultados {
+			pontos := r.Pontos(proprio, adversario)
+			if pontos < 0 {
+				return fmt.Errorf("pontuação negativa para %v/%v", proprio, adversario)
+			}
+			if proprio > Vitoria && pontos > r.Pontos(proprio-1, adversario) {
+				return fmt.Errorf("%v/%v vale mais que %v/%v", proprio, adversario, proprio-1, adversario)
+			}
+			if adversario > Vitoria && pontos > r.Pontos(proprio, adversario-1) {
+				return fmt.Errorf("%v/%v vale mais que %v/%v", proprio, adversario, proprio, adversario-1)
+			}
+		}
+	}
+	return nil
+}
+
+// MenorGanha diz se no atributo o menor valor é que ganha.
+func (r MatchRules) MenorGanha(atributo string) bool {
+	for _, a := range r.Invertidos {
+		if a == atributo {
+			return true
+		}
+	}
+	return false
+}
+
+// CompararNo compara o valor de a com o de b no atributo, com a polaridade
+// das regras.
+func (r MatchRules) CompararNo(atributo string, a, b int) Resultado {
+	if r.MenorGanha(atributo) {
+		return Comparar(b, a)
+	}
+	return Comparar(a, b)
+}
+
+// ComInversao são as mesmas regras com mais um atributo em que o menor
+// ganha (a inversão sorteada num round).
+func (r MatchRules) ComInversao(atributo string) MatchRules {
+	if atributo == "" || r.MenorGanha(atributo) {
+		return r
+	}
+	r.Invertidos = append(append([]string(nil), r.Invertidos...), atributo)
+	return r
+}
+
+// Pontos de um jogador no round pelos resultados nos dois atributos.
+func (r MatchRules) Pontos(proprio, adversario Resultado) int {
+	return r.Pontuacao[proprio][adversario]
+}
+
+// PontosMaximos é o que vale um round ganho nos dois atributos; é o que
+// leva quem jogou contra alguém que deixou o tempo acabar.
+func (r MatchRules) PontosMaximos() int {
+	return r.Pontos(Vitoria, Vitoria)
+}
+
+// Moedas que o jogador ganha no fim da partida.
+func (r MatchRules) Moedas(pontos int, venceu bool) int {
+	moedas := pontos * r.MoedasPorPonto
+	if venceu {
+		moedas += r.MoedasVitoria
+	}
+	return moedas
+}
@@ -0,0 +1,182 @@
+package game
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Uma modalidade diferente da padrão pra garantir que nada depende da tabela original
+func rapida() MatchRules {
+	return MatchRules{
+		Rounds:      1,
+		TamanhoDeck: 3,
+		TamanhoMao:  2,
+		Pontuacao: [3][3]int{
+			{5, 3, 1},
+			{3, 1, 0},
+			{1, 0, 0},
+		},
+		MoedasPorPonto: 2,
+		MoedasVitoria:  10,
+	}
+}
+
+func TestPontos(t *testing.T) {
+	casos := []struct {
+		modalidade string
+		regras     MatchRules
+		proprio    Resultado
+		adversario Resultado
+		pontos     int
+	}{
+		// A tabela que o processRound usava antes das modalidades
+		{"padrao", Padrao(), Vitoria, Vitoria, 3},
+		{"padrao", Padrao(), Vitoria, Empate, 2},
+		{"padrao", Padrao(), Vitoria, Derrota, 2},
+		{"padrao", Padrao(), Empate, Vitoria, 2},
+		{"padrao", Padrao(), Empate, Empate, 2},
+		{"padrao", Padrao(), Empate, Derrota, 1},
+		{"padrao", Padrao(), Derrota, Vitoria, 2},
+		{"padrao", Padrao(), Derrota, Empate, 1},
+		{"padrao", Padrao(), Derrota, Derrota, 0},
+
+		{"rapida", rapida(), Vitoria, Vitoria, 5},
+		{"rapida", rapida(), Vitoria, Empate, 3},
+		{"rapida", rapida(), Vitoria, Derrota, 1},
+		{"rapida", rapida(), Empate, Vitoria, 3},
+		{"rapida", rapida(), Empate, Empate, 1},
+		{"rapida", rapida(), Empate, Derrota, 0},
+		{"rapida", rapida(), Derrota, Vitoria, 1},
+		{"rapida", rapida(), Derrota, Empate, 0},
+		{"rapida", rapida(), Derrota, Derrota, 0},
+	}
+	for _, c := range casos {
+		if got := c.regras.Pontos(c.proprio, c.adversario); got != c.pontos {
+			t.Errorf("%s: %v/%v = %d pontos, esperado %d", c.modalidade, c.proprio, c.adversario, got, c.pontos)
+		}
+	}
+}
+
+func TestPontosMaximos(t *testing.T) {
+	if got := Padrao().PontosMaximos(); got != 3 {
+		t.Errorf("padrao: %d, esperado 3", got)
+	}
+	if got := rapida().PontosMaximos(); got != 5 {
+		t.Errorf("rapida: %d, esperado 5", got)
+	}
+}
+
+func TestMoedas(t *testing.T) {
+	casos := []struct {
+		modalidade string
+		regras     MatchRules
+		pontos     int
+		venceu     bool
+		moedas     int
+	}{
+		{"padrao", Padrao(), 7, true, 7},
+		{"padrao", Padrao(), 5, false, 5},
+		{"padrao", Padrao(), 0, false, 0},
+		{"rapida", rapida(), 5, true, 20},
+		{"rapida", rapida(), 1, false, 2},
+		{"rapida", rapida(), 0, true, 10},
+	}
+	for _, c := range casos {
+		if got := c.regras.Moedas(c.pontos, c.venceu); got != c.moedas {
+			t.Errorf("%s: %d pontos (venceu=%v) = %d moedas, esperado %d", c.modalidade, c.pontos, c.venceu, got, c.moedas)
+		}
+	}
+}
+
+func TestComparar(t *testing.T) {
+	casos := []struct {
+		a, b int
+		r    Resultado
+	}{
+		{10, 5, Vitoria},
+		{5, 10, Derrota},
+		{7, 7, Empate},
+		{0, 0, Empate},
+	}
+	for _, c := range casos {
+		if got := Comparar(c.a, c.b); got != c.r {
+			t.Errorf("Comparar(%d, %d) = %v, esperado %v", c.a, c.b, got, c.r)
+		}
+		if got := Comparar(c.b, c.a); got != c.r.Inverso() {
+			t.Errorf("Comparar(%d, %d) = %v, esperado %v", c.b, c.a, got, c.r.Inverso())
+		}
+	}
+}
+
+func TestValidar(t *testing.T) {
+	casos := []struct {
+		nome   string
+		mudar  func(r *MatchRules)
+		valido bool
+	}{
+		{"padrao", func(r *MatchRules) {}, true},
+		{"sem rounds", func(r *MatchRules) { r.Rounds = 0 }, false},
+		{"mão menor que os rounds", func(r *MatchRules) { r.TamanhoMao = 2 }, false},
+		{"deck menor que a mão", func(r *MatchRules) { r.TamanhoDeck = 3 }, false},
+		{"mão menor que o deck", func(r *MatchRules) { r.TamanhoDeck = 6 }, true},
+		{"moedas negativas", func(r *MatchRules) { r.MoedasPorPonto = -1 }, false},
+		{"bônus negativo", func(r *MatchRules) { r.MoedasVitoria = -1 }, false},
+		{"pontos negativos", func(r *MatchRules) { r.Pontuacao[2][2] = -1 }, false},
+		{"empate vale mais que vitória", func(r *MatchRules) { r.Pontuacao[1][0] = 4 }, false},
+		{"derrota do adversário vale menos", func(r *MatchRules) { r.Pontuacao[0][2] = 3; r.Pontuacao[0][1] = 1 }, false},
+		{"tudo zero", func(r *MatchRules) { r.Pontuacao = [3][3]int{} }, true},
+		{"clássico com mais rounds que cartas", func(r *MatchRules) { r.Classico = true; r.Rounds = 40 }, true},
+		{"clássico sem mão", func(r *MatchRules) { r.Classico = true; r.TamanhoMao = 0 }, false},
+		{"clássico com Super Trunfo", func(r *MatchRules) { r.Classico = true; r.SuperTrunfo = "X"; r.ContraTrunfo = "Comum" }, true},
+		{"Super Trunfo fora do clássico", func(r *MatchRules) { r.SuperTrunfo = "X" }, false},
+		{"contra trunfo sem Super Trunfo", func(r *MatchRules) { r.Classico = true; r.ContraTrunfo = "Comum" }, false},
+		{"atributo invertido", func(r *MatchRules) { r.Invertidos = []string{"Envergadura"}; r.ChanceInversao = 50 }, true},
+		{"invertido que não existe", func(r *MatchRules) { r.Invertidos = []string{"Peso"} }, false},
+		{"invertido repetido", func(r *MatchRules) { r.Invertidos = []string{"Altura", "Altura"} }, false},
+		{"chance acima de 100", func(r *MatchRules) { r.ChanceInversao = 101 }, false},
+		{"chance negativa", func(r *MatchRules) { r.ChanceInversao = -1 }, false},
+		{"todos invertidos", func(r *MatchRules) { r.Invertidos = Atributos }, true},
+		{"todos invertidos com chance", func(r *MatchRules) { r.Invertidos = Atributos; r.ChanceInversao = 10 }, false},
+	}
+	for _, c := range casos {
+		r := Padrao()
+		c.mudar(&r)
+		err := r.Validar()
+		if c.valido && err != nil {
+			t.Errorf("%s: recusada: %v", c.nome, err)
+		}
+		if !c.valido && err == nil {
+			t.Errorf("%s: aceita", c.nome)
+		}
+	}
+	if err := rapida().Validar(); err != nil {
+		t.Errorf("rapida: %v", err)
+	}
+}
+
+func TestModalidadesDaConfiguracao(t *testing.T) {
+	// Toda modalidade do arquivo que vai junto com o servidor tem que ser válida
+	data, err := os.ReadFile(filepath.Join("..", "data", "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config struct {
+		Regras struct {
+			Padrao      string                `json:"padrao"`
+			Modalidades map[string]MatchRules `json:"modalidades"`
+		} `json:"regras"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := config.Regras.Modalidades[config.Regras.Padrao]; !ok {
+		t.Errorf("a modalidade padrão %q não está nas modalidades", config.Regras.Padrao)
+	}
+	for nome, regras := range config.Regras.Modalidades {
+		if err := regras.Validar(); err != nil {
+			t.Errorf("%s: %v", nome, err)
+		}
+	}
+}
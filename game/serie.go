@@ -0,0 +1,63 @@
+package game
+
+import "fmt"
+
+// Tamanhos de série que uma sala privada aceita: partida avulsa, melhor de
+// 3 e melhor de 5.
+var TamanhosSerie = []int{1, 3, 5}
+
+// Serie é uma disputa em melhor de N partidas entre os mesmos dois
+// jogadores. Quem ganha mais da metade leva; empates contam como partida
+// jogada, e depois de N partidas sem ninguém chegar lá a série empata.
+type Serie struct {
+	Partidas int    // N (1 = partida avulsa)
+	Vitorias [2]int // partidas ganhas por cada lado
+	Empates  int
+	Jogadas  int // partidas já encerradas
+	Abandono int // lado que abandonou uma partida (encerra a série), ou Nenhum
+}
+
+// NovaSerie começa uma série melhor de n.
+func NovaSerie(n int) (*Serie, error) {
+	for _, valido := range TamanhosSerie {
+		if n == valido {
+			return &Serie{Partidas: n, Abandono: Nenhum}, nil
+		}
+	}
+	return nil, fmt.Errorf("a série deve ser melhor de %d, %d ou %d", TamanhosSerie[0], TamanhosSerie[1], TamanhosSerie[2])
+}
+
+// Registrar conta o resultado de uma partida encerrada.
+func (s *Serie) Registrar(p *Partida) {
+	s.Jogadas++
+	if v := p.Vencedor(); v != Nenhum {
+		s.Vitorias[v]++
+	} else {
+		s.Empates++
+	}
+	if p.Abandono != Nenhum {
+		s.Abandono = p.Abandono
+	}
+}
+
+// Encerrada diz se a série já tem vencedor, se chegou às N partidas ou se
+// alguém abandonou.
+func (s *Serie) Encerrada() bool {
+	return s.Abandono != Nenhum || s.Jogadas >= s.Partidas ||
+		s.Vitorias[LadoA] > s.Partidas/2 || s.Vitorias[LadoB] > s.Partidas/2
+}
+
+// Vencedor é o lado com mais partidas ganhas (Nenhum no empate). Quem
+// abandona perde a série.
+func (s *Serie) Vencedor() int {
+	if s.Abandono != Nenhum {
+		return Outro(s.Abandono)
+	}
+	switch {
+	case s.Vitorias[LadoA] > s.Vitorias[LadoB]:
+		return LadoA
+	case s.Vitorias[LadoB] > s.Vitorias[LadoA]:
+		return LadoB
+	}
+	return Nenhum
+}
@@ -0,0 +1,85 @@
+package game
+
+import "testing"
+
+// encerrada é uma partida já terminada com o placar dado.
+func encerrada(placarA, placarB int) *Partida {
+	return &Partida{Estado: EstadoEncerrada, Placar: [2]int{placarA, placarB}, Abandono: Nenhum}
+}
+
+func TestNovaSerie(t *testing.T) {
+	for _, n := range []int{1, 3, 5} {
+		s, err := NovaSerie(n)
+		if err != nil {
+			t.Fatalf("melhor de %d recusada: %v", n, err)
+		}
+		if s.Encerrada() || s.Vencedor() != Nenhum {
+			t.Errorf("melhor de %d já começou decidida", n)
+		}
+	}
+	for _, n := range []int{0, 2, 4, 7, -1} {
+		if _, err := NovaSerie(n); err == nil {
+			t.Errorf("melhor de %d aceita", n)
+		}
+	}
+}
+
+func TestSerie(t *testing.T) {
+	casos := []struct {
+		nome     string
+		serie    int
+		partidas []*Partida
+		jogadas  int // partidas até a série acabar
+		vencedor int
+	}{
+		{"avulsa", 1, []*Partida{encerrada(7, 5)}, 1, LadoA},
+		{"avulsa empatada", 1, []*Partida{encerrada(6, 6)}, 1, Nenhum},
+		{"2 a 0", 3, []*Partida{encerrada(1, 9), encerrada(2, 8)}, 2, LadoB},
+		{"2 a 1", 3, []*Partida{encerrada(9, 1), encerrada(1, 9), encerrada(9, 1)}, 3, LadoA},
+		{"empate no meio", 3, []*Partida{encerrada(5, 5), encerrada(9, 1), encerrada(9, 1)}, 3, LadoA},
+		{"1 a 1 e um empate", 3, []*Partida{encerrada(9, 1), encerrada(5, 5), encerrada(1, 9)}, 3, Nenhum},
+		{"3 a 0 na melhor de 5", 5, []*Partida{encerrada(9, 1), encerrada(9, 1), encerrada(9, 1)}, 3, LadoA},
+		{"3 a 2 na melhor de 5", 5, []*Partida{encerrada(9, 1), encerrada(1, 9), encerrada(1, 9), encerrada(9, 1), encerrada(1, 9)}, 5, LadoB},
+	}
+	for _, c := range casos {
+		s, _ := NovaSerie(c.serie)
+		for i, p := range c.partidas {
+			if s.Encerrada() {
+				t.Fatalf("%s: encerrada depois de %d partidas", c.nome, i)
+			}
+			s.Registrar(p)
+		}
+		if !s.Encerrada() {
+			t.Errorf("%s: não encerrou", c.nome)
+		}
+		if s.Jogadas != c.jogadas {
+			t.Errorf("%s: %d partidas jogadas, esperado %d", c.nome, s.Jogadas, c.jogadas)
+		}
+		if got := s.Vencedor(); got != c.vencedor {
+			t.Errorf("%s: vencedor %d, esperado %d", c.nome, got, c.vencedor)
+		}
+		if s.Vitorias[LadoA]+s.Vitorias[LadoB]+s.Empates != s.Jogadas {
+			t.Errorf("%s: %v vitórias e %d empates em %d partidas", c.nome, s.Vitorias, s.Empates, s.Jogadas)
+		}
+	}
+}
+
+func TestSerieAbandono(t *testing.T) {
+	s, _ := NovaSerie(5)
+	s.Registrar(encerrada(9, 1))
+	s.Registrar(encerrada(9, 1))
+
+	// Quem estava na frente abandona a terceira e perde a série
+	p := encerrada(3, 0)
+	p.Abandono = LadoA
+	s.Registrar(p)
+	if !s.Encerrada() {
+		t.Fatal("a série continuou depois do abandono")
+	}
+	if s.Vencedor() != LadoB {
+		t.Errorf("vencedor %d, esperado o lado B", s.Vencedor())
+	}
+	if s.Vitorias != [2]int{2, 1} {
+		t.Errorf("vitórias %v, esperado [2 1]", s.Vitorias)
+	}
+}
@@ -0,0 +1,207 @@
+package loja
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+)
+
+// Raridades em ordem crescente de valor.
+var Raridades = []string{"Comum", "Rara", "Muito Rara"}
+
+// Pacote é um tipo de pacote vendido na loja, lido de data/pacotes.json.
+type Pacote struct {
+	Tipo    string         `json:"tipo"`    // identificador usado no COMPRA
+	Nome    string         `json:"nome"`    // nome mostrado pro jogador
+	Tamanho int            `json:"tamanho"` // cartas por pacote
+	Preco   int            `json:"preco"`   // em moedas
+	Pesos   map[string]int `json:"pesos"`   // raridade -> peso no sorteio de cada carta
+	// Garantia é a raridade mínima da última carta do pacote ("" = sem garantia).
+	Garantia string `json:"garantia,omitempty"`
+	// Pity: raridade -> em quantos pacotes seguidos sem ela (ou melhor) a
+	// última carta passa a ser garantida dessa raridade.
+	Pity map[string]int `json:"pity,omitempty"`
+}
+
+// Contadores de pity de um jogador: raridade -> pacotes abertos seguidos
+// sem nenhuma carta dessa raridade ou melhor. Fica salvo junto com o jogador.
+type Contadores map[string]int
+
+// Carregar lê e valida os tipos de pacote do arquivo.
+func Carregar(caminho string) ([]Pacote, error) {
+	data, err := os.ReadFile(caminho)
+	if err != nil {
+		return nil, err
+	}
+
+	var pacotes []Pacote
+	if err := json.Unmarshal(data, &pacotes); err != nil {
+		return nil, fmt.Errorf("decodificando %s: %w", caminho, err)
+	}
+	if len(pacotes) == 0 {
+		return nil, fmt.Errorf("%s não tem nenhum pacote", caminho)
+	}
+
+	tipos := make(map[string]bool)
+	for _, p := range pacotes {
+		if err := p.Validar(); err != nil {
+			return nil, err
+		}
+		if tipos[p.Tipo] {
+			return nil, fmt.Errorf("pacote %s repetido", p.Tipo)
+		}
+		tipos[p.Tipo] = true
+	}
+	return pacotes, nil
+}
+
+// Validar confere se o pacote pode ser sorteado.
+func (p Pacote) Validar() error {
+	if p.Tipo == "" {
+		return fmt.Errorf("pacote sem tipo")
+	}
+	if p.Tamanho < 1 {
+		return fmt.Errorf("pacote %s: tamanho deve ser pelo menos 1", p.Tipo)
+	}
+	if p.Preco < 0 {
+		return fmt.Errorf("pacote %s: preço negativo", p.Tipo)
+	}
+	for raridade, peso := range p.Pesos {
+		if Nivel(raridade) < 0 {
+			return fmt.Errorf("pacote %s: raridade desconhecida %q", p.Tipo, raridade)
+		}
+		if peso < 0 {
+			return fmt.Errorf("pacote %s: peso negativo para %s", p.Tipo, raridade)
+		}
+	}
+	if total(p.Pesos, 0) == 0 {
+		return fmt.Errorf("pacote %s: nenhuma raridade com peso", p.Tipo)
+	}
+	if p.Garantia != "" {
+		minimo := Nivel(p.Garantia)
+		if minimo < 0 {
+			return fmt.Errorf("pacote %s: garantia com raridade desconhecida %q", p.Tipo, p.Garantia)
+		}
+		if total(p.Pesos, minimo) == 0 {
+			return fmt.Errorf("pacote %s: nenhuma raridade a partir de %s tem peso", p.Tipo, p.Garantia)
+		}
+	}
+	for raridade, limite := range p.Pity {
+		nivel := Nivel(raridade)
+		if nivel < 0 {
+			return fmt.Errorf("pacote %s: pity com raridade desconhecida %q", p.Tipo, raridade)
+		}
+		if limite < 1 {
+			return fmt.Errorf("pacote %s: pity de %s deve ser pelo menos 1", p.Tipo, raridade)
+		}
+		if total(p.Pesos, nivel) == 0 {
+			return fmt.Errorf("pacote %s: nenhuma raridade a partir de %s tem peso", p.Tipo, raridade)
+		}
+	}
+	return nil
+}
+
+// Sortear devolve a raridade de cada carta do pacote. Se o pacote tem
+// garantia, a última carta é sorteada só entre as raridades a partir dela.
+func (p Pacote) Sortear(rng *rand.Rand) []string {
+	return p.sortear(Nivel(p.Garantia), rng)
+}
+
+// Abrir sorteia o pacote levando em conta os contadores de pity do jogador
+// e os atualiza: quem chegou no limite tem a última carta garantida, e
+// cada contador volta a zero quando sai a raridade (ou uma melhor).
+// contadores não pode ser nil.
+func (p Pacote) Abrir(contadores Contadores, rng *rand.Rand) []string {
+	minimo := Nivel(p.Garantia)
+	for raridade, limite := range p.Pity {
+		if contadores[raridade]+1 >= limite && Nivel(raridade) > minimo {
+			minimo = Nivel(raridade)
+		}
+	}
+
+	raridades := p.sortear(minimo, rng)
+	melhor := 0
+	for _, r := range raridades {
+		if Nivel(r) > melhor {
+			melhor = Nivel(r)
+		}
+	}
+
+	for raridade := range contadores {
+		if Nivel(raridade) <= melhor {
+			contadores[raridade] = 0
+		}
+	}
+	for raridade := range p.Pity {
+		if Nivel(raridade) > melhor {
+			contadores[raridade]++
+		}
+	}
+	return raridades
+}
+
+// Faltam diz quantos pacotes (contando o próximo) faltam pra raridade ser
+// garantida, ou 0 se o pacote não tem pity pra ela.
+func (p Pacote) Faltam(contadores Contadores, raridade string) int {
+	limite, ok := p.Pity[raridade]
+	if !ok {
+		return 0
+	}
+	if faltam := limite - contadores[raridade]; faltam > 1 {
+		return faltam
+	}
+	return 1
+}
+
+// sortear sorteia cada carta; a última só entre as raridades de nível >= minimo.
+func (p Pacote) sortear(minimo int, rng *rand.Rand) []string {
+	raridades := make([]string, p.Tamanho)
+	for i := range raridades {
+		nivel := 0
+		if i == p.Tamanho-1 && minimo > 0 {
+			nivel = minimo
+		}
+		raridades[i] = sortearRaridade(p.Pesos, nivel, rng)
+	}
+	return raridades
+}
+
+// Chance devolve a probabilidade de uma carta comum (fora da garantia) sair com a raridade.
+func (p Pacote) Chance(raridade string) float64 {
+	n := Nivel(raridade)
+	if n < 0 {
+		return 0
+	}
+	return float64(p.Pesos[raridade]) / float64(total(p.Pesos, 0))
+}
+
+// Nivel é a posição da raridade em Raridades, ou -1 se não existir.
+func Nivel(raridade string) int {
+	for i, r := range Raridades {
+		if r == raridade {
+			return i
+		}
+	}
+	return -1
+}
+
+// sortearRaridade sorteia pelos pesos, considerando só as raridades de nível >= minimo.
+func sortearRaridade(pesos map[string]int, minimo int, rng *rand.Rand) string {
+	n := rng.Intn(total(pesos, minimo))
+	for _, r := range Raridades[minimo:] {
+		if n < pesos[r] {
+			return r
+		}
+		n -= pesos[r]
+	}
+	panic("loja: sorteio fora dos pesos") // total() garante que não acontece
+}
+
+func total(pesos map[string]int, minimo int) int {
+	soma := 0
+	for _, r := range Raridades[minimo:] {
+		soma += pesos[r]
+	}
+	return soma
+}
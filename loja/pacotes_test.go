@@ -0,0 +1,202 @@
+package loja
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Aberturas simuladas nos testes estatísticos. As seeds são fixas, então os
+// testes são determinísticos; as tolerâncias valem pra qualquer seed.
+const aberturas = 100000
+
+func pacoteTeste() Pacote {
+	return Pacote{
+		Tipo:    "TESTE",
+		Tamanho: 3,
+		Preco:   10,
+		Pesos:   map[string]int{"Comum": 70, "Rara": 25, "Muito Rara": 5},
+	}
+}
+
+func TestSortearSegueOsPesos(t *testing.T) {
+	p := pacoteTeste()
+	rng := rand.New(rand.NewSource(1))
+
+	contagem := make(map[string]int)
+	for i := 0; i < aberturas; i++ {
+		for _, r := range p.Sortear(rng) {
+			contagem[r]++
+		}
+	}
+
+	n := float64(aberturas * p.Tamanho)
+	for _, r := range Raridades {
+		esperado := p.Chance(r)
+		obtido := float64(contagem[r]) / n
+		// 5 desvios padrão da proporção
+		tolerancia := 5 * math.Sqrt(esperado*(1-esperado)/n)
+		if math.Abs(obtido-esperado) > tolerancia {
+			t.Errorf("%s: frequência %.4f, esperado %.4f ± %.4f", r, obtido, esperado, tolerancia)
+		}
+	}
+}
+
+func TestGarantiaNaUltimaCarta(t *testing.T) {
+	p := pacoteTeste()
+	p.Garantia = "Rara"
+	rng := rand.New(rand.NewSource(2))
+
+	ultimas := make(map[string]int)
+	for i := 0; i < aberturas; i++ {
+		raridades := p.Sortear(rng)
+		if len(raridades) != p.Tamanho {
+			t.Fatalf("pacote com %d cartas, esperado %d", len(raridades), p.Tamanho)
+		}
+		ultima := raridades[len(raridades)-1]
+		if Nivel(ultima) < Nivel("Rara") {
+			t.Fatalf("última carta %s, abaixo da garantia", ultima)
+		}
+		ultimas[ultima]++
+	}
+
+	// Entre as raridades permitidas os pesos continuam valendo: 5/30 de Muito Rara
+	esperado := 5.0 / 30.0
+	obtido := float64(ultimas["Muito Rara"]) / aberturas
+	tolerancia := 5 * math.Sqrt(esperado*(1-esperado)/aberturas)
+	if math.Abs(obtido-esperado) > tolerancia {
+		t.Errorf("Muito Rara na garantia: frequência %.4f, esperado %.4f ± %.4f", obtido, esperado, tolerancia)
+	}
+}
+
+func TestPityNuncaPassaDoLimite(t *testing.T) {
+	for _, limite := range []int{1, 2, 10, 40} {
+		p := pacoteTeste()
+		p.Tamanho = 1
+		p.Pity = map[string]int{"Muito Rara": limite}
+		rng := rand.New(rand.NewSource(int64(limite)))
+
+		contadores := Contadores{}
+		seguidos, pior := 0, 0
+		for i := 0; i < aberturas; i++ {
+			if p.Abrir(contadores, rng)[0] == "Muito Rara" {
+				seguidos = 0
+			} else {
+				seguidos++
+			}
+			if seguidos > pior {
+				pior = seguidos
+			}
+			if contadores["Muito Rara"] != seguidos {
+				t.Fatalf("limite %d: contador %d, mas foram %d pacotes seguidos sem Muito Rara", limite, contadores["Muito Rara"], seguidos)
+			}
+		}
+		if pior >= limite {
+			t.Errorf("limite %d: %d pacotes seguidos sem Muito Rara", limite, pior)
+		}
+	}
+}
+
+func TestPityAumentaAChance(t *testing.T) {
+	p := pacoteTeste()
+	p.Tamanho = 1
+	p.Pity = map[string]int{"Muito Rara": 10}
+	rng := rand.New(rand.NewSource(3))
+
+	contadores := Contadores{}
+	muitoRaras := 0
+	for i := 0; i < aberturas; i++ {
+		if p.Abrir(contadores, rng)[0] == "Muito Rara" {
+			muitoRaras++
+		}
+	}
+
+	// Com chance base q, a cada ciclo de até 10 pacotes sai exatamente uma
+	// Muito Rara. O tamanho médio do ciclo é (1-(1-q)^10)/q.
+	q := p.Chance("Muito Rara")
+	esperado := q / (1 - math.Pow(1-q, 10))
+	obtido := float64(muitoRaras) / aberturas
+	if math.Abs(obtido-esperado) > 0.01 {
+		t.Errorf("frequência de Muito Rara %.4f, esperado %.4f", obtido, esperado)
+	}
+}
+
+func TestPityResetaComRaridadeMelhor(t *testing.T) {
+	p := pacoteTeste()
+	p.Tamanho = 1
+	p.Pesos = map[string]int{"Muito Rara": 1} // sempre sai Muito Rara
+	p.Pity = map[string]int{"Rara": 5}
+
+	contadores := Contadores{"Rara": 3, "Muito Rara": 7}
+	p.Abrir(contadores, rand.New(rand.NewSource(4)))
+	if contadores["Rara"] != 0 || contadores["Muito Rara"] != 0 {
+		t.Errorf("contadores %v depois de uma Muito Rara, esperado tudo zerado", contadores)
+	}
+}
+
+func TestFaltam(t *testing.T) {
+	p := pacoteTeste()
+	p.Pity = map[string]int{"Muito Rara": 10}
+
+	casos := []struct {
+		contador int
+		faltam   int
+	}{
+		{0, 10},
+		{4, 6},
+		{9, 1},
+		{15, 1}, // limite diminuído no arquivo depois que o jogador já tinha contado mais
+	}
+	for _, c := range casos {
+		if got := p.Faltam(Contadores{"Muito Rara": c.contador}, "Muito Rara"); got != c.faltam {
+			t.Errorf("contador %d: faltam %d, esperado %d", c.contador, got, c.faltam)
+		}
+	}
+	if got := p.Faltam(Contadores{}, "Rara"); got != 0 {
+		t.Errorf("raridade sem pity: faltam %d, esperado 0", got)
+	}
+}
+
+func TestValidar(t *testing.T) {
+	casos := []struct {
+		nome   string
+		mudar  func(p *Pacote)
+		valido bool
+	}{
+		{"ok", func(p *Pacote) {}, true},
+		{"sem tipo", func(p *Pacote) { p.Tipo = "" }, false},
+		{"tamanho zero", func(p *Pacote) { p.Tamanho = 0 }, false},
+		{"preço negativo", func(p *Pacote) { p.Preco = -1 }, false},
+		{"raridade desconhecida", func(p *Pacote) { p.Pesos["Lendária"] = 1 }, false},
+		{"sem pesos", func(p *Pacote) { p.Pesos = nil }, false},
+		{"garantia sem peso", func(p *Pacote) { p.Pesos["Muito Rara"] = 0; p.Garantia = "Muito Rara" }, false},
+		{"pity zero", func(p *Pacote) { p.Pity = map[string]int{"Rara": 0} }, false},
+		{"pity sem peso", func(p *Pacote) { p.Pesos["Muito Rara"] = 0; p.Pity = map[string]int{"Muito Rara": 5} }, false},
+		{"pity ok", func(p *Pacote) { p.Pity = map[string]int{"Muito Rara": 5} }, true},
+	}
+	for _, c := range casos {
+		p := pacoteTeste()
+		c.mudar(&p)
+		if err := p.Validar(); (err == nil) != c.valido {
+			t.Errorf("%s: Validar() = %v", c.nome, err)
+		}
+	}
+}
+
+func TestCarregar(t *testing.T) {
+	// O arquivo que vai junto com o servidor tem que ser válido
+	if _, err := Carregar(filepath.Join("..", "data", "pacotes.json")); err != nil {
+		t.Fatalf("data/pacotes.json: %v", err)
+	}
+
+	repetido := filepath.Join(t.TempDir(), "pacotes.json")
+	conteudo := `[{"tipo":"A","tamanho":1,"pesos":{"Comum":1}},{"tipo":"A","tamanho":1,"pesos":{"Comum":1}}]`
+	if err := os.WriteFile(repetido, []byte(conteudo), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Carregar(repetido); err == nil {
+		t.Error("pacote repetido foi aceito")
+	}
+}
@@ -0,0 +1,92 @@
+package persistencia
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucketJogadores = []byte("jogadores")
+
+// BoltStore guarda cada jogador como uma chave no bbolt, um banco
+// chave-valor embutido escrito em Go puro. Cada escrita é um commit
+// próprio, então nada se perde num crash.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// AbrirBolt abre (ou cria) o arquivo do banco e garante o bucket.
+func AbrirBolt(caminho string) (*BoltStore, error) {
+	db, err := bolt.Open(caminho, 0644, &bolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketJogadores)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Get(login string) ([]byte, error) {
+	var out []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v, err := (&boltTx{tx}).Get(login)
+		out = v
+		return err
+	})
+	return out, err
+}
+
+func (s *BoltStore) Put(login string, data []byte) error {
+	return s.Update(func(tx Tx) error {
+		return tx.Put(login, data)
+	})
+}
+
+func (s *BoltStore) Update(fn func(tx Tx) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx})
+	})
+}
+
+func (s *BoltStore) List() (map[string][]byte, error) {
+	out := make(map[string][]byte)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketJogadores).ForEach(func(k, v []byte) error {
+			out[string(k)] = append([]byte(nil), v...)
+			return nil
+		})
+	})
+	return out, err
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (t *boltTx) Get(login string) ([]byte, error) {
+	v := t.tx.Bucket(bucketJogadores).Get([]byte(login))
+	if v == nil {
+		return nil, ErrNaoEncontrado
+	}
+	// O slice do bolt só vale durante a transação
+	return append([]byte(nil), v...), nil
+}
+
+func (t *boltTx) Put(login string, data []byte) error {
+	if !json.Valid(data) {
+		return fmt.Errorf("JSON inválido para o jogador %s", login)
+	}
+	return t.tx.Bucket(bucketJogadores).Put([]byte(login), data)
+}
@@ -0,0 +1,78 @@
+package persistencia
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestBoltStoreUpdate(t *testing.T) {
+	caminho := filepath.Join(t.TempDir(), "jogadores.db")
+	s, err := AbrirBolt(caminho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Put("ana", []byte(`{"Moedas":10}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("bia"); !errors.Is(err, ErrNaoEncontrado) {
+		t.Errorf("Get de quem não existe: %v", err)
+	}
+
+	// Transação com erro não aplica nada
+	falha := errors.New("falha")
+	err = s.Update(func(tx Tx) error {
+		tx.Put("ana", []byte(`{"Moedas":0}`))
+		tx.Put("bia", []byte(`{"Moedas":5}`))
+		return falha
+	})
+	if err != falha {
+		t.Fatalf("Update devolveu %v", err)
+	}
+	if v, _ := s.Get("ana"); string(v) != `{"Moedas":10}` {
+		t.Errorf("ana mudou numa transação desfeita: %s", v)
+	}
+	if _, err := s.Get("bia"); !errors.Is(err, ErrNaoEncontrado) {
+		t.Errorf("bia criada numa transação desfeita")
+	}
+
+	// Dentro da transação as escritas já aparecem
+	err = s.Update(func(tx Tx) error {
+		tx.Put("bia", []byte(`{"Moedas":5}`))
+		v, err := tx.Get("bia")
+		if err != nil || string(v) != `{"Moedas":5}` {
+			t.Errorf("Get dentro da transação = %s, %v", v, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	todos, _ := s.List()
+	if len(todos) != 2 {
+		t.Errorf("List = %d jogadores, esperado 2", len(todos))
+	}
+}
+
+func TestBoltStoreReabrir(t *testing.T) {
+	// Cada escrita é um commit: não precisa de snapshot pra sobreviver ao Close
+	caminho := filepath.Join(t.TempDir(), "jogadores.db")
+	s, err := AbrirBolt(caminho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put("ana", []byte(`{"Moedas":10}`))
+	s.Put("bia", []byte(`{"Moedas":20}`))
+	s.Close()
+
+	s, err = AbrirBolt(caminho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	todos, _ := s.List()
+	if len(todos) != 2 || string(todos["bia"]) != `{"Moedas":20}` {
+		t.Errorf("depois de reaberto: %q", todos)
+	}
+}
@@ -0,0 +1,239 @@
+package persistencia
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Evento é uma linha do journal: o que aconteceu e o estado final de cada
+// jogador afetado. Guardar o estado (e não só a diferença) deixa o replay
+// idempotente: aplicar o mesmo evento duas vezes dá no mesmo resultado.
+type Evento struct {
+	Seq     uint64                     `json:"seq"`
+	Hora    time.Time                  `json:"hora"`
+	Tipo    string                     `json:"tipo"`
+	Detalhe json.RawMessage            `json:"detalhe,omitempty"`
+	Estados map[string]json.RawMessage `json:"estados"`
+}
+
+// Journal é um log só de acréscimo (uma linha JSON por evento). Cada
+// Registrar só retorna depois do fsync, então o evento sobrevive a um crash.
+//
+// Num snapshot o arquivo atual é rotacionado pra um segmento
+// (journal.log.<seq>), que só é apagado depois que o snapshot foi gravado.
+type Journal struct {
+	caminho string
+	arquivo *os.File
+	seq     uint64
+	mu      sync.Mutex
+}
+
+// AbrirJournal abre (ou cria) o journal e continua a numeração de onde parou.
+func AbrirJournal(caminho string) (*Journal, error) {
+	j := &Journal{caminho: caminho}
+
+	segmentos, err := j.segmentos()
+	if err != nil {
+		return nil, err
+	}
+	for _, segmento := range segmentos {
+		_, err := lerJournal(segmento, func(e Evento) error {
+			j.seq = e.Seq
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	validos, err := lerJournal(caminho, func(e Evento) error {
+		j.seq = e.Seq
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	j.arquivo, err = os.OpenFile(caminho, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	// Descarta o resto de uma escrita interrompida pra que o próximo
+	// evento não seja colado nela
+	if info, err := j.arquivo.Stat(); err == nil && info.Size() > validos {
+		if err := j.arquivo.Truncate(validos); err != nil {
+			j.arquivo.Close()
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+// Registrar grava o evento e faz fsync antes de retornar.
+func (j *Journal) Registrar(tipo string, detalhe interface{}, estados map[string][]byte) error {
+	e := Evento{
+		Hora:    time.Now(),
+		Tipo:    tipo,
+		Estados: make(map[string]json.RawMessage, len(estados)),
+	}
+	if detalhe != nil {
+		data, err := json.Marshal(detalhe)
+		if err != nil {
+			return err
+		}
+		e.Detalhe = data
+	}
+	for login, estado := range estados {
+		e.Estados[login] = estado
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	e.Seq = j.seq + 1
+	linha, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	linha = append(linha, '\n')
+
+	if _, err := j.arquivo.Write(linha); err != nil {
+		return err
+	}
+	if err := j.arquivo.Sync(); err != nil {
+		return err
+	}
+	j.seq = e.Seq
+	return nil
+}
+
+// Rotacionar fecha o arquivo atual como um segmento e abre um novo pros
+// próximos eventos. Devolve o segmento criado ("" se não havia eventos),
+// que deve ser passado pra Descartar quando o snapshot estiver gravado.
+func (j *Journal) Rotacionar() (string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	info, err := j.arquivo.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.Size() == 0 {
+		return "", nil
+	}
+
+	if err := j.arquivo.Close(); err != nil {
+		return "", err
+	}
+	segmento := fmt.Sprintf("%s.%020d", j.caminho, j.seq)
+	errRename := os.Rename(j.caminho, segmento)
+
+	// Reabre mesmo se o rename falhou, pra não deixar o journal fechado
+	j.arquivo, err = os.OpenFile(j.caminho, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if errRename != nil {
+		return "", errRename
+	}
+	if err != nil {
+		return "", err
+	}
+	return segmento, nil
+}
+
+// Descartar apaga o segmento informado e todos os anteriores a ele.
+func (j *Journal) Descartar(segmento string) error {
+	if segmento == "" {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	segmentos, err := j.segmentos()
+	if err != nil {
+		return err
+	}
+	for _, s := range segmentos {
+		if s > segmento {
+			break
+		}
+		if err := os.Remove(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// segmentos lista os segmentos rotacionados em ordem (o nome tem o seq com zeros à esquerda).
+func (j *Journal) segmentos() ([]string, error) {
+	segmentos, err := filepath.Glob(j.caminho + ".*")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(segmentos)
+	return segmentos, nil
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.arquivo.Close()
+}
+
+// LerJournal chama fn para cada evento, em ordem, começando pelos
+// segmentos ainda não descartados. Uma última linha incompleta (crash no
+// meio da escrita) é ignorada, já que o evento nunca chegou a ser
+// confirmado pro cliente.
+func LerJournal(caminho string, fn func(Evento) error) error {
+	segmentos, err := (&Journal{caminho: caminho}).segmentos()
+	if err != nil {
+		return err
+	}
+	for _, arquivo := range append(segmentos, caminho) {
+		if _, err := lerJournal(arquivo, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lerJournal também devolve quantos bytes do arquivo são linhas completas.
+func lerJournal(caminho string, fn func(Evento) error) (int64, error) {
+	arquivo, err := os.Open(caminho)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer arquivo.Close()
+
+	var validos int64
+	reader := bufio.NewReader(arquivo)
+	for {
+		linha, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// Se sobrou algo sem '\n' é uma escrita interrompida
+			return validos, nil
+		}
+		if err != nil {
+			return validos, err
+		}
+
+		var e Evento
+		if err := json.Unmarshal(linha, &e); err != nil {
+			return validos, fmt.Errorf("journal %s corrompido: %w", caminho, err)
+		}
+		if err := fn(e); err != nil {
+			return validos, err
+		}
+		validos += int64(len(linha))
+	}
+}
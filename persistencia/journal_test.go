@@ -0,0 +1,232 @@
+package persistencia
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// registrar grava um evento com o estado de um jogador só.
+func registrar(t *testing.T, j *Journal, login string, moedas int) {
+	t.Helper()
+	estado := []byte(fmt.Sprintf(`{"Login":%q,"Moedas":%d}`, login, moedas))
+	if err := j.Registrar("TESTE", map[string]int{"moedas": moedas}, map[string][]byte{login: estado}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// lerTudo devolve os eventos do journal (segmentos e arquivo atual), em ordem.
+func lerTudo(t *testing.T, caminho string) []Evento {
+	t.Helper()
+	var eventos []Evento
+	if err := LerJournal(caminho, func(e Evento) error {
+		eventos = append(eventos, e)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return eventos
+}
+
+// conferirSeqs confere os números dos eventos.
+func conferirSeqs(t *testing.T, eventos []Evento, seqs ...uint64) {
+	t.Helper()
+	if len(eventos) != len(seqs) {
+		t.Fatalf("%d eventos, esperado %d", len(eventos), len(seqs))
+	}
+	for i, e := range eventos {
+		if e.Seq != seqs[i] {
+			t.Errorf("evento %d com seq %d, esperado %d", i, e.Seq, seqs[i])
+		}
+	}
+}
+
+func TestJournalRegistrarELer(t *testing.T) {
+	caminho := filepath.Join(t.TempDir(), "journal.log")
+	j, err := AbrirJournal(caminho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registrar(t, j, "ana", 10)
+	registrar(t, j, "bia", 20)
+	registrar(t, j, "ana", 30)
+	j.Close()
+
+	eventos := lerTudo(t, caminho)
+	conferirSeqs(t, eventos, 1, 2, 3)
+	var estado struct{ Moedas int }
+	if err := json.Unmarshal(eventos[2].Estados["ana"], &estado); err != nil || estado.Moedas != 30 {
+		t.Errorf("estado de ana no último evento: %s (%v)", eventos[2].Estados["ana"], err)
+	}
+	if string(eventos[1].Detalhe) != `{"moedas":20}` {
+		t.Errorf("detalhe = %s", eventos[1].Detalhe)
+	}
+
+	// Reaberto, continua a numeração
+	j, err = AbrirJournal(caminho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registrar(t, j, "bia", 40)
+	j.Close()
+	conferirSeqs(t, lerTudo(t, caminho), 1, 2, 3, 4)
+}
+
+func TestJournalRegistrarGravaAntesDeRetornar(t *testing.T) {
+	// Sem fechar o journal: o que o Registrar confirmou já está no arquivo
+	caminho := filepath.Join(t.TempDir(), "journal.log")
+	j, err := AbrirJournal(caminho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	for i := 1; i <= 3; i++ {
+		registrar(t, j, "ana", i)
+		eventos := lerTudo(t, caminho)
+		if len(eventos) != i {
+			t.Fatalf("depois do Registrar %d o arquivo tem %d eventos", i, len(eventos))
+		}
+	}
+}
+
+func TestJournalEscritaInterrompida(t *testing.T) {
+	caminho := filepath.Join(t.TempDir(), "journal.log")
+	j, err := AbrirJournal(caminho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registrar(t, j, "ana", 10)
+	registrar(t, j, "bia", 20)
+	j.Close()
+
+	// Crash no meio da escrita do terceiro evento: a linha fica sem '\n'
+	inteiro, err := os.ReadFile(caminho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(caminho, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"seq":3,"tipo":"TESTE","estados":{"ana":{"Mo`)
+	f.Close()
+
+	// O replay ignora o evento que nunca foi confirmado
+	conferirSeqs(t, lerTudo(t, caminho), 1, 2)
+
+	// Ao reabrir, o pedaço é cortado e o próximo evento não fica colado nele
+	j, err = AbrirJournal(caminho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(caminho); err != nil || info.Size() != int64(len(inteiro)) {
+		t.Errorf("o journal não foi truncado nas linhas completas (%d bytes, esperado %d)", info.Size(), len(inteiro))
+	}
+	registrar(t, j, "ana", 30)
+	j.Close()
+	eventos := lerTudo(t, caminho)
+	conferirSeqs(t, eventos, 1, 2, 3)
+	if eventos[2].Tipo != "TESTE" || len(eventos[2].Estados) != 1 {
+		t.Errorf("evento 3 = %+v", eventos[2])
+	}
+}
+
+func TestJournalLinhaCorrompida(t *testing.T) {
+	// Uma linha completa que não é JSON não é escrita interrompida: é erro
+	caminho := filepath.Join(t.TempDir(), "journal.log")
+	if err := os.WriteFile(caminho, []byte("{\"seq\":1}\nlixo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LerJournal(caminho, func(Evento) error { return nil }); err == nil {
+		t.Error("journal corrompido aceito")
+	}
+	if _, err := AbrirJournal(caminho); err == nil {
+		t.Error("AbrirJournal aceitou o journal corrompido")
+	}
+}
+
+func TestJournalRotacionar(t *testing.T) {
+	caminho := filepath.Join(t.TempDir(), "journal.log")
+	j, err := AbrirJournal(caminho)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sem eventos não há segmento
+	if segmento, err := j.Rotacionar(); err != nil || segmento != "" {
+		t.Fatalf("rotacionar vazio = %q, %v", segmento, err)
+	}
+
+	registrar(t, j, "ana", 10)
+	registrar(t, j, "bia", 20)
+	primeiro, err := j.Rotacionar()
+	if err != nil || primeiro == "" {
+		t.Fatalf("rotacionar = %q, %v", primeiro, err)
+	}
+	registrar(t, j, "ana", 30)
+	segundo, err := j.Rotacionar()
+	if err != nil || segundo <= primeiro {
+		t.Fatalf("segundo segmento %q depois de %q (%v)", segundo, primeiro, err)
+	}
+	registrar(t, j, "bia", 40)
+
+	// O replay passa pelos segmentos e depois pelo arquivo atual
+	conferirSeqs(t, lerTudo(t, caminho), 1, 2, 3, 4)
+
+	// Reaberto com segmentos pendentes, continua a numeração
+	j.Close()
+	j, err = AbrirJournal(caminho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	registrar(t, j, "ana", 50)
+	conferirSeqs(t, lerTudo(t, caminho), 1, 2, 3, 4, 5)
+
+	// Descartar o primeiro segmento deixa o segundo
+	if err := j.Descartar(primeiro); err != nil {
+		t.Fatal(err)
+	}
+	conferirSeqs(t, lerTudo(t, caminho), 3, 4, 5)
+
+	// Descartar o segundo leva junto qualquer anterior, e "" não faz nada
+	if err := j.Descartar(""); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Descartar(segundo); err != nil {
+		t.Fatal(err)
+	}
+	conferirSeqs(t, lerTudo(t, caminho), 4, 5)
+	if _, err := os.Stat(primeiro); !os.IsNotExist(err) {
+		t.Errorf("segmento %s ainda existe", primeiro)
+	}
+	if _, err := os.Stat(segundo); !os.IsNotExist(err) {
+		t.Errorf("segmento %s ainda existe", segundo)
+	}
+}
+
+func TestJournalDescartarLevaOsAnteriores(t *testing.T) {
+	caminho := filepath.Join(t.TempDir(), "journal.log")
+	j, err := AbrirJournal(caminho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	var segmentos []string
+	for i := 1; i <= 3; i++ {
+		registrar(t, j, "ana", i)
+		segmento, err := j.Rotacionar()
+		if err != nil {
+			t.Fatal(err)
+		}
+		segmentos = append(segmentos, segmento)
+	}
+	if err := j.Descartar(segmentos[1]); err != nil {
+		t.Fatal(err)
+	}
+	conferirSeqs(t, lerTudo(t, caminho), 3)
+}
@@ -0,0 +1,253 @@
+package persistencia
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// JSONStore guarda todos os jogadores num único arquivo JSON (o mesmo
+// formato de data/players.json: um objeto login -> jogador). As escritas
+// ficam em memória e só vão pro disco em snapshots (ver Snapshotter); entre
+// um snapshot e outro quem garante as alterações é o journal.
+type JSONStore struct {
+	caminho  string
+	backups  int
+	dados    map[string]json.RawMessage
+	mu       sync.Mutex
+	gravando sync.Mutex // um snapshot por vez
+}
+
+// AbrirJSON carrega o arquivo (se existir) e devolve o store pronto pra uso.
+// Se o arquivo principal não puder ser decodificado, usa o backup válido
+// mais recente. backups é quantas cópias antigas manter a cada snapshot.
+func AbrirJSON(caminho string, backups int) (*JSONStore, error) {
+	s := &JSONStore{
+		caminho: caminho,
+		backups: backups,
+		dados:   make(map[string]json.RawMessage),
+	}
+
+	dados, errPrincipal := lerArquivoJSON(caminho)
+	if errPrincipal == nil {
+		s.dados = dados
+		return s, nil
+	}
+
+	for i := 1; i <= backups; i++ {
+		dados, err := lerArquivoJSON(s.backup(i))
+		if err != nil {
+			continue
+		}
+		fmt.Printf("Não foi possível ler %s (%v), usando o backup %s.\n", caminho, errPrincipal, s.backup(i))
+		s.dados = dados
+		return s, nil
+	}
+
+	// Sem arquivo e sem backup: começa vazio
+	if os.IsNotExist(errPrincipal) {
+		return s, nil
+	}
+	return nil, errPrincipal
+}
+
+func lerArquivoJSON(caminho string) (map[string]json.RawMessage, error) {
+	data, err := os.ReadFile(caminho)
+	if err != nil {
+		return nil, err
+	}
+
+	dados := make(map[string]json.RawMessage)
+	if len(data) == 0 {
+		return dados, nil
+	}
+	if err := json.Unmarshal(data, &dados); err != nil {
+		return nil, fmt.Errorf("decodificando %s: %w", caminho, err)
+	}
+	if dados == nil {
+		dados = make(map[string]json.RawMessage)
+	}
+	return dados, nil
+}
+
+func (s *JSONStore) Get(login string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.dados[login]
+	if !ok {
+		return nil, ErrNaoEncontrado
+	}
+	return append([]byte(nil), v...), nil
+}
+
+func (s *JSONStore) Put(login string, data []byte) error {
+	return s.Update(func(tx Tx) error {
+		return tx.Put(login, data)
+	})
+}
+
+func (s *JSONStore) Update(fn func(tx Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &jsonTx{base: s.dados, escritas: make(map[string]json.RawMessage)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	for k, v := range tx.escritas {
+		s.dados[k] = v
+	}
+	return nil
+}
+
+func (s *JSONStore) List() (map[string][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string][]byte, len(s.dados))
+	for k, v := range s.dados {
+		out[k] = append([]byte(nil), v...)
+	}
+	return out, nil
+}
+
+func (s *JSONStore) Close() error {
+	return nil
+}
+
+// Capturar copia o mapa atual. Os valores nunca são alterados no lugar
+// (cada Put troca o slice), então a cópia rasa basta e é barata.
+func (s *JSONStore) Capturar() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	foto := make(Snapshot, len(s.dados))
+	for k, v := range s.dados {
+		foto[k] = v
+	}
+	return foto
+}
+
+// Gravar escreve o snapshot num arquivo temporário e o renomeia por cima
+// do principal, então um crash no meio nunca deixa o arquivo pela metade.
+// O arquivo anterior vira o backup .1 e os mais antigos vão sendo empurrados.
+func (s *JSONStore) Gravar(foto Snapshot) error {
+	s.gravando.Lock()
+	defer s.gravando.Unlock()
+
+	data, err := json.MarshalIndent(foto, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.caminho)
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.caminho)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // não faz nada se o rename deu certo
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := s.rotacionarBackups(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.caminho); err != nil {
+		return err
+	}
+	return sincronizarDir(dir)
+}
+
+// rotacionarBackups empurra players.json -> .1 -> .2 ... e descarta o mais antigo.
+func (s *JSONStore) rotacionarBackups() error {
+	if s.backups <= 0 {
+		return nil
+	}
+	for i := s.backups - 1; i >= 1; i-- {
+		if err := os.Rename(s.backup(i), s.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(s.caminho, s.backup(1)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *JSONStore) backup(i int) string {
+	return fmt.Sprintf("%s.%d", s.caminho, i)
+}
+
+// GravarArquivo troca o conteúdo do arquivo de uma vez: escreve num
+// temporário e o renomeia por cima, como Gravar, mas sem guardar backups.
+func GravarArquivo(caminho string, data []byte) error {
+	dir := filepath.Dir(caminho)
+	tmp, err := os.CreateTemp(dir, filepath.Base(caminho)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), caminho); err != nil {
+		return err
+	}
+	return sincronizarDir(dir)
+}
+
+// sincronizarDir garante que o rename chegou ao disco.
+func sincronizarDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// jsonTx acumula as escritas até o fim da transação.
+type jsonTx struct {
+	base     map[string]json.RawMessage
+	escritas map[string]json.RawMessage
+}
+
+func (tx *jsonTx) Get(login string) ([]byte, error) {
+	if v, ok := tx.escritas[login]; ok {
+		return append([]byte(nil), v...), nil
+	}
+	if v, ok := tx.base[login]; ok {
+		return append([]byte(nil), v...), nil
+	}
+	return nil, ErrNaoEncontrado
+}
+
+func (tx *jsonTx) Put(login string, data []byte) error {
+	if !json.Valid(data) {
+		return fmt.Errorf("JSON inválido para o jogador %s", login)
+	}
+	tx.escritas[login] = append(json.RawMessage(nil), data...)
+	return nil
+}
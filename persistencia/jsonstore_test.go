@@ -0,0 +1,333 @@
+package persistencia
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// conferirArquivo confere que o arquivo tem exatamente os jogadores dados
+// (o Gravar indenta o JSON, então compara a forma compacta).
+func conferirArquivo(t *testing.T, caminho string, esperado map[string]string) {
+	t.Helper()
+	dados, err := lerArquivoJSON(caminho)
+	if err != nil {
+		t.Fatalf("lendo %s: %v", caminho, err)
+	}
+	if len(dados) != len(esperado) {
+		t.Errorf("%s tem %d jogadores, esperado %d", caminho, len(dados), len(esperado))
+	}
+	for login, v := range esperado {
+		var compacto bytes.Buffer
+		json.Compact(&compacto, dados[login])
+		if compacto.String() != v {
+			t.Errorf("%s: %s = %s, esperado %s", caminho, login, compacto.String(), v)
+		}
+	}
+}
+
+// temporarios lista os arquivos .tmp deixados no diretório.
+func temporarios(t *testing.T, dir string) []string {
+	t.Helper()
+	sobra, err := filepath.Glob(filepath.Join(dir, "*.tmp*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sobra
+}
+
+func TestJSONStoreUpdate(t *testing.T) {
+	s, err := AbrirJSON(filepath.Join(t.TempDir(), "jogadores.json"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("ana", []byte(`{"Moedas":10}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("bia"); !errors.Is(err, ErrNaoEncontrado) {
+		t.Errorf("Get de quem não existe: %v", err)
+	}
+
+	// Transação com erro não aplica nada
+	falha := errors.New("falha")
+	err = s.Update(func(tx Tx) error {
+		tx.Put("ana", []byte(`{"Moedas":0}`))
+		tx.Put("bia", []byte(`{"Moedas":5}`))
+		return falha
+	})
+	if err != falha {
+		t.Fatalf("Update devolveu %v", err)
+	}
+	if v, _ := s.Get("ana"); string(v) != `{"Moedas":10}` {
+		t.Errorf("ana mudou numa transação desfeita: %s", v)
+	}
+	if _, err := s.Get("bia"); !errors.Is(err, ErrNaoEncontrado) {
+		t.Errorf("bia criada numa transação desfeita")
+	}
+
+	// Dentro da transação as escritas já aparecem
+	err = s.Update(func(tx Tx) error {
+		tx.Put("bia", []byte(`{"Moedas":5}`))
+		v, err := tx.Get("bia")
+		if err != nil || string(v) != `{"Moedas":5}` {
+			t.Errorf("Get dentro da transação = %s, %v", v, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Put("caio", []byte(`{"Moedas":`)); err == nil {
+		t.Error("JSON inválido aceito")
+	}
+	todos, _ := s.List()
+	if len(todos) != 2 {
+		t.Errorf("List = %d jogadores, esperado 2", len(todos))
+	}
+}
+
+func TestJSONStoreReabrir(t *testing.T) {
+	caminho := filepath.Join(t.TempDir(), "jogadores.json")
+	s, err := AbrirJSON(caminho, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put("ana", []byte(`{"Moedas":10}`))
+	s.Put("bia", []byte(`{"Moedas":20}`))
+	if err := s.Gravar(s.Capturar()); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s, err = AbrirJSON(caminho, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	todos, _ := s.List()
+	if len(todos) != 2 {
+		t.Fatalf("List = %d jogadores, esperado 2", len(todos))
+	}
+	var estado struct{ Moedas int }
+	if err := json.Unmarshal(todos["bia"], &estado); err != nil || estado.Moedas != 20 {
+		t.Errorf("bia depois de reaberto: %s (%v)", todos["bia"], err)
+	}
+}
+
+func TestJSONStoreGravar(t *testing.T) {
+	dir := t.TempDir()
+	caminho := filepath.Join(dir, "jogadores.json")
+	s, err := AbrirJSON(caminho, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versoes := []string{`{"Moedas":1}`, `{"Moedas":2}`, `{"Moedas":3}`}
+	for _, v := range versoes {
+		s.Put("ana", []byte(v))
+		if err := s.Gravar(s.Capturar()); err != nil {
+			t.Fatal(err)
+		}
+		if sobra := temporarios(t, dir); len(sobra) > 0 {
+			t.Errorf("arquivos temporários deixados: %v", sobra)
+		}
+	}
+
+	// O principal tem a última versão e os backups as anteriores, sem passar de 2
+	conferirArquivo(t, caminho, map[string]string{"ana": versoes[2]})
+	conferirArquivo(t, caminho+".1", map[string]string{"ana": versoes[1]})
+	conferirArquivo(t, caminho+".2", map[string]string{"ana": versoes[0]})
+	if _, err := os.Stat(caminho + ".3"); !os.IsNotExist(err) {
+		t.Error("mais backups do que o configurado")
+	}
+}
+
+func TestJSONStoreGravarComErro(t *testing.T) {
+	// Se o snapshot não puder ser escrito, o arquivo e os backups ficam como estavam
+	dir := t.TempDir()
+	caminho := filepath.Join(dir, "jogadores.json")
+	s, err := AbrirJSON(caminho, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put("ana", []byte(`{"Moedas":1}`))
+	if err := s.Gravar(s.Capturar()); err != nil {
+		t.Fatal(err)
+	}
+
+	foto := s.Capturar()
+	foto["bia"] = json.RawMessage(`{"Moedas":`)
+	if err := s.Gravar(foto); err == nil {
+		t.Fatal("snapshot inválido gravado")
+	}
+	conferirArquivo(t, caminho, map[string]string{"ana": `{"Moedas":1}`})
+	if _, err := os.Stat(caminho + ".1"); !os.IsNotExist(err) {
+		t.Error("backup rotacionado por um snapshot que não foi gravado")
+	}
+	if sobra := temporarios(t, dir); len(sobra) > 0 {
+		t.Errorf("arquivos temporários deixados: %v", sobra)
+	}
+}
+
+func TestAbrirJSONUsaBackup(t *testing.T) {
+	casos := []struct {
+		nome     string
+		arquivos map[string]string // sufixo -> conteúdo
+		moedas   string            // valor de ana esperado, "" = vazio
+		erro     bool
+	}{
+		{"sem arquivo", nil, "", false},
+		{"arquivo vazio", map[string]string{"": ""}, "", false},
+		{"principal bom", map[string]string{"": `{"ana":1}`, ".1": `{"ana":2}`}, "1", false},
+		{"principal corrompido", map[string]string{"": `{"ana":`, ".1": `{"ana":2}`}, "2", false},
+		{"dois corrompidos", map[string]string{"": `{"ana":`, ".1": `lixo`, ".2": `{"ana":3}`}, "3", false},
+		{"sem backup bom", map[string]string{"": `{"ana":`, ".1": `lixo`}, "", true},
+	}
+	for _, c := range casos {
+		caminho := filepath.Join(t.TempDir(), "jogadores.json")
+		for sufixo, conteudo := range c.arquivos {
+			if err := os.WriteFile(caminho+sufixo, []byte(conteudo), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		s, err := AbrirJSON(caminho, 2)
+		if c.erro {
+			if err == nil {
+				t.Errorf("%s: abriu sem erro", c.nome)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.nome, err)
+			continue
+		}
+		v, err := s.Get("ana")
+		if c.moedas == "" {
+			if !errors.Is(err, ErrNaoEncontrado) {
+				t.Errorf("%s: esperado store vazio, ana = %s", c.nome, v)
+			}
+		} else if string(v) != c.moedas {
+			t.Errorf("%s: ana = %s, esperado %s", c.nome, v, c.moedas)
+		}
+	}
+}
+
+func TestJSONStoreGravarTrocaPorRename(t *testing.T) {
+	// Quem já tinha o arquivo aberto continua vendo a versão anterior inteira:
+	// o Gravar troca o arquivo pelo rename, nunca reescreve o principal no lugar
+	dir := t.TempDir()
+	caminho := filepath.Join(dir, "jogadores.json")
+	s, err := AbrirJSON(caminho, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put("ana", []byte(`{"Moedas":1}`))
+	if err := s.Gravar(s.Capturar()); err != nil {
+		t.Fatal(err)
+	}
+	antes, err := os.ReadFile(caminho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aberto, err := os.Open(caminho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aberto.Close()
+	infoAntes, _ := aberto.Stat()
+
+	s.Put("ana", []byte(`{"Moedas":2}`))
+	s.Put("bia", []byte(`{"Moedas":3}`))
+	if err := s.Gravar(s.Capturar()); err != nil {
+		t.Fatal(err)
+	}
+
+	lido, err := io.ReadAll(aberto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(lido, antes) {
+		t.Errorf("o arquivo antigo foi alterado no lugar: %s", lido)
+	}
+	infoDepois, err := os.Stat(caminho)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(infoAntes, infoDepois) {
+		t.Error("o principal não foi substituído por outro arquivo")
+	}
+	conferirArquivo(t, caminho, map[string]string{"ana": `{"Moedas":2}`, "bia": `{"Moedas":3}`})
+	if sobra := temporarios(t, dir); len(sobra) > 0 {
+		t.Errorf("arquivos temporários deixados: %v", sobra)
+	}
+}
+
+func TestAbrirJSONRecuperaDosBackups(t *testing.T) {
+	// Backups gerados pelos próprios snapshots, depois o principal corrompido
+	caminho := filepath.Join(t.TempDir(), "jogadores.json")
+	s, err := AbrirJSON(caminho, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{`{"Moedas":1}`, `{"Moedas":2}`, `{"Moedas":3}`} {
+		s.Put("ana", []byte(v))
+		if err := s.Gravar(s.Capturar()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	moedas := func() int {
+		t.Helper()
+		s, err := AbrirJSON(caminho, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := s.Get("ana")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var estado struct{ Moedas int }
+		json.Unmarshal(v, &estado)
+		return estado.Moedas
+	}
+
+	// Crash no meio de uma escrita fora do Gravar: o principal fica pela metade
+	if err := os.WriteFile(caminho, []byte(`{"ana":{"Moe`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if m := moedas(); m != 2 {
+		t.Errorf("com o principal corrompido usou a versão %d, esperado a 2 (.1)", m)
+	}
+
+	// Com o .1 também corrompido, cai pro .2
+	if err := os.WriteFile(caminho+".1", []byte("lixo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if m := moedas(); m != 1 {
+		t.Errorf("com o .1 corrompido usou a versão %d, esperado a 1 (.2)", m)
+	}
+}
+
+func TestGravarArquivo(t *testing.T) {
+	dir := t.TempDir()
+	caminho := filepath.Join(dir, "estoque.json")
+	for _, conteudo := range []string{`{"v":1}`, `{"v":2}`} {
+		if err := GravarArquivo(caminho, []byte(conteudo)); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(caminho); string(data) != conteudo {
+			t.Errorf("conteúdo %s, esperado %s", data, conteudo)
+		}
+	}
+	if sobra := temporarios(t, dir); len(sobra) > 0 {
+		t.Errorf("arquivos temporários deixados: %v", sobra)
+	}
+	if _, err := os.Stat(caminho + ".1"); !os.IsNotExist(err) {
+		t.Error("GravarArquivo não guarda backup")
+	}
+}
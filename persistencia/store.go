@@ -0,0 +1,60 @@
+package persistencia
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrNaoEncontrado é retornado quando o login não existe no armazenamento.
+var ErrNaoEncontrado = errors.New("jogador não encontrado")
+
+// PlayerStore abstrai onde os perfis dos jogadores ficam guardados.
+// Os valores são o JSON de cada jogador, indexados pelo login, assim o
+// pacote não precisa conhecer a struct User do servidor.
+type PlayerStore interface {
+	Get(login string) ([]byte, error)
+	Put(login string, data []byte) error
+	// Update executa fn numa transação: ou todas as escritas feitas em tx
+	// são gravadas, ou nenhuma (se fn ou a gravação retornarem erro).
+	Update(fn func(tx Tx) error) error
+	List() (map[string][]byte, error)
+	Close() error
+}
+
+// Tx é a visão de uma transação aberta por PlayerStore.Update.
+type Tx interface {
+	Get(login string) ([]byte, error)
+	Put(login string, data []byte) error
+}
+
+// Snapshot é uma cópia do conteúdo do store num instante.
+type Snapshot map[string]json.RawMessage
+
+// Snapshotter é implementado pelos backends que só vão pro disco em
+// snapshots. Capturar é barato e deve ser chamado com as escritas paradas;
+// Gravar faz o trabalho pesado (serializar e escrever) e pode rodar em
+// paralelo com novas escritas.
+type Snapshotter interface {
+	Capturar() Snapshot
+	Gravar(foto Snapshot) error
+}
+
+// Backends disponíveis
+const (
+	BackendJSON = "json"
+	BackendBolt = "bolt"
+)
+
+// Abrir cria o PlayerStore do backend escolhido na configuração. backups
+// só vale pro backend JSON.
+func Abrir(backend, caminho string, backups int) (PlayerStore, error) {
+	switch backend {
+	case BackendJSON, "":
+		return AbrirJSON(caminho, backups)
+	case BackendBolt:
+		return AbrirBolt(caminho)
+	default:
+		return nil, fmt.Errorf("backend de persistência desconhecido: %q", backend)
+	}
+}
@@ -0,0 +1,150 @@
+package persistencia
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fecharStore grava o snapshot (nos backends que precisam) e fecha o store,
+// como o servidor faz ao desligar.
+func fecharStore(t *testing.T, s PlayerStore) {
+	t.Helper()
+	if snap, ok := s.(Snapshotter); ok {
+		if err := snap.Gravar(snap.Capturar()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// conteudo lista o store na forma compacta (o JSONStore devolve o JSON
+// indentado depois de reaberto, o que não importa pro servidor).
+func conteudo(t *testing.T, s PlayerStore) map[string]string {
+	t.Helper()
+	todos, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[string]string, len(todos))
+	for login, v := range todos {
+		var compacto bytes.Buffer
+		if err := json.Compact(&compacto, v); err != nil {
+			t.Fatalf("%s: %v", login, err)
+		}
+		out[login] = compacto.String()
+	}
+	return out
+}
+
+// roteiro executa os mesmos passos do servidor num backend: escritas,
+// transações, queda com eventos só no journal, replay e reabertura. Devolve
+// o que foi observado em cada passo.
+func roteiro(t *testing.T, backend string) []string {
+	dir := t.TempDir()
+	caminho := filepath.Join(dir, "jogadores")
+	caminhoJournal := filepath.Join(dir, "journal.log")
+	var obs []string
+
+	s, err := Abrir(backend, caminho, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put("ana", []byte(`{"Moedas":50}`))
+	s.Put("bia", []byte(`{"Moedas":50}`))
+
+	_, err = s.Get("caio")
+	obs = append(obs, fmt.Sprintf("get inexistente: %v", errors.Is(err, ErrNaoEncontrado)))
+	obs = append(obs, fmt.Sprintf("json inválido: %v", s.Put("caio", []byte(`{`)) != nil))
+
+	// Transação desfeita e transação confirmada
+	err = s.Update(func(tx Tx) error {
+		tx.Put("ana", []byte(`{"Moedas":0}`))
+		return errors.New("saldo insuficiente")
+	})
+	obs = append(obs, fmt.Sprintf("update com erro: %v", err))
+	err = s.Update(func(tx Tx) error {
+		v, err := tx.Get("ana")
+		if err != nil {
+			return err
+		}
+		tx.Put("ana", []byte(`{"Moedas":40}`))
+		tx.Put("bia", []byte(`{"Moedas":60}`))
+		obs = append(obs, "ana antes da troca: "+string(v))
+		return nil
+	})
+	obs = append(obs, fmt.Sprintf("update: %v", err))
+	fecharStore(t, s)
+
+	// Eventos que só chegaram ao journal antes da queda
+	j, err := AbrirJournal(caminhoJournal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Registrar("COMPRA", nil, map[string][]byte{"ana": []byte(`{"Moedas":30}`)})
+	j.Registrar("TROCA", nil, map[string][]byte{
+		"ana":  []byte(`{"Moedas":30,"Cartas":1}`),
+		"caio": []byte(`{"Moedas":50}`),
+	})
+	j.Close()
+
+	// Reabre e reaplica o journal, como o recuperarJournal do servidor
+	s, err = Abrir(backend, caminho, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obs = append(obs, fmt.Sprintf("reaberto: %v", conteudo(t, s)))
+	finais := make(map[string][]byte)
+	err = LerJournal(caminhoJournal, func(e Evento) error {
+		for login, estado := range e.Estados {
+			finais[login] = estado
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Update(func(tx Tx) error {
+		for login, estado := range finais {
+			if err := tx.Put(login, estado); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fecharStore(t, s)
+
+	s, err = Abrir(backend, caminho, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	obs = append(obs, fmt.Sprintf("depois do replay: %v", conteudo(t, s)))
+	return obs
+}
+
+func TestBackendsEquivalentes(t *testing.T) {
+	json := roteiro(t, BackendJSON)
+	bolt := roteiro(t, BackendBolt)
+	if !reflect.DeepEqual(json, bolt) {
+		t.Fatalf("os backends divergem:\njson: %q\nbolt: %q", json, bolt)
+	}
+
+	esperado := fmt.Sprint(map[string]string{
+		"ana":  `{"Moedas":30,"Cartas":1}`,
+		"bia":  `{"Moedas":60}`,
+		"caio": `{"Moedas":50}`,
+	})
+	if final := json[len(json)-1]; final != "depois do replay: "+esperado {
+		t.Errorf("estado final %s, esperado %s", final, esperado)
+	}
+}
@@ -8,8 +8,21 @@ type Carta struct {
 	Velocidade  int    `json:"velocidade"`
 	Altura      int    `json:"altura"`
 	Passageiros int    `json:"passageiros"`
+
+	// Só nas cartas de um inventário (e nos decks montados com elas)
+	ID        string `json:"id,omitempty"`        // identifica esta cópia da carta
+	Adquirida int64  `json:"adquirida,omitempty"` // quando o jogador ganhou a cópia (Unix, em milissegundos)
+	Origem    string `json:"origem,omitempty"`    // PACOTE, TROCA, MERCADO ou CRIACAO
 }
 
+// Valores de Carta.Origem
+const (
+	OrigemPacote  = "PACOTE"
+	OrigemTroca   = "TROCA"
+	OrigemMercado = "MERCADO"
+	OrigemCriacao = "CRIACAO"
+)
+
 type Inventario struct {
 	Cartas []Carta `json:"cartas"`
 }
@@ -29,9 +42,40 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Status     string     `json:"status"`     // LOGADO, N_EXIST, ONLINE_JA
-	Inventario Inventario `json:"inventario"` // inventário inicial
-	Saldo      int        `json:"saldo"`      // moedas atuais
+	Status     string     `json:"status"`           // LOGADO, N_EXIST, ONLINE_JA, SENHA_INVALIDA
+	Inventario Inventario `json:"inventario"`       // inventário inicial
+	Saldo      int        `json:"saldo"`            // moedas atuais
+	Token      string     `json:"token,omitempty"`  // usado no RESUME se a conexão cair
+	Diario     *DailyInfo `json:"diario,omitempty"` // situação da recompensa diária
+}
+
+// Recompensa diária
+// DailyInfo diz se a recompensa do dia já pode ser resgatada com CLAIM_DAILY.
+type DailyInfo struct {
+	Disponivel bool `json:"disponivel"` // ainda não resgatou hoje
+	Sequencia  int  `json:"sequencia"`  // dias seguidos, contando o resgate disponível (ou o de hoje, se já resgatou)
+	Recompensa int  `json:"recompensa"` // moedas do resgate disponível
+}
+
+type ClaimDailyRequest struct{}
+
+type ClaimDailyResponse struct {
+	Status     string `json:"status"` // RESGATADO ou JA_RESGATADO
+	Recompensa int    `json:"recompensa"`
+	Sequencia  int    `json:"sequencia"`
+	Saldo      int    `json:"saldo"`
+}
+
+// Reconexão: religa uma conexão nova à sessão de antes (e à partida, se houver)
+type ResumeRequest struct {
+	Token string `json:"token"`
+}
+
+type ResumeResponse struct {
+	Status     string     `json:"status"` // RETOMADO, TOKEN_INVALIDO
+	Inventario Inventario `json:"inventario"`
+	Saldo      int        `json:"saldo"`
+	EmPartida  bool       `json:"em_partida"` // se sim, o servidor reenvia GAME_START e ROUND_START
 }
 
 type SignInRequest struct {
@@ -49,10 +93,47 @@ type ScreenMessage struct {
 	Content string `json:"content"`
 }
 
+// ErrorMessage é a resposta (tipo "ERRO") a um pedido recusado pelo servidor.
+// Codigo serve pro cliente decidir o que fazer; Mensagem é pra mostrar na tela.
+type ErrorMessage struct {
+	Codigo   string `json:"codigo"`
+	Mensagem string `json:"mensagem"`
+}
+
+// Códigos de ErrorMessage
+const (
+	ErroMensagemInvalida = "MENSAGEM_INVALIDA"
+	ErroGravacao         = "GRAVACAO"          // o servidor não conseguiu salvar a alteração, que foi desfeita
+	ErroSemPartida       = "SEM_PARTIDA"       // não está numa partida em andamento
+	ErroForaDoRound      = "FORA_DO_ROUND"     // jogada enviada entre rounds
+	ErroJogadaRepetida   = "JOGADA_REPETIDA"   // já jogou neste round
+	ErroForaDaVez        = "FORA_DA_VEZ"       // no modo clássico, é o oponente quem escolhe o atributo
+	ErroCartaInvalida    = "CARTA_INVALIDA"    // índice fora da mão
+	ErroAtributoInvalido = "ATRIBUTO_INVALIDO" // atributo que não existe
+	ErroDeckInvalido     = "DECK_INVALIDO"     // tamanho errado ou carta que o jogador não tem
+	ErroDeckEmSala       = "DECK_EM_SALA"      // troca de deck com o jogador numa sala ou partida
+	ErroPartidaCancelada = "PARTIDA_CANCELADA" // a partida não pôde começar (deck de alguém não serve mais)
+	ErroTrocaInvalida    = "TROCA_INVALIDA"    // troca que não existe ou de que o jogador não participa
+	ErroTrocaJogador     = "TROCA_JOGADOR"     // destinatário offline, inexistente ou o próprio jogador
+	ErroTrocaCarta       = "TROCA_CARTA"       // carta que o jogador não tem ou que já está em outra troca
+	ErroTrocaSaldo       = "TROCA_SALDO"       // moedas a mais do que o saldo livre
+	ErroMercadoAnuncio   = "MERCADO_ANUNCIO"   // anúncio que não existe, encerrado ou do próprio jogador
+	ErroMercadoCarta     = "MERCADO_CARTA"     // carta que o jogador não tem ou que já está em troca/à venda
+	ErroMercadoValor     = "MERCADO_VALOR"     // preço, duração ou lance fora das regras
+	ErroMercadoSaldo     = "MERCADO_SALDO"     // moedas livres insuficientes pro lance ou compra
+	ErroOficinaCarta     = "OFICINA_CARTA"     // carta que não pode ser desmontada ou criada
+	ErroOficinaSaldo     = "OFICINA_SALDO"     // fragmentos insuficientes pra criar a carta
+	ErroRegrasInvalidas  = "REGRAS_INVALIDAS"  // modalidade de partida que não existe
+	ErroSerieInvalida    = "SERIE_INVALIDA"    // série que não é melhor de 1, 3 ou 5
+	ErroSemRevanche      = "SEM_REVANCHE"      // nenhuma partida de sala privada esperando revanche
+)
+
 // Pareamento e sala
 type RoomRequest struct {
-	RoomCode string `json:"room_code,omitempty"`
-	Mode     string `json:"mode,omitempty"` // "PUBLIC" ou "PRIVATE"
+	RoomCode   string `json:"room_code,omitempty"`
+	Mode       string `json:"mode,omitempty"`       // "PUBLIC" ou "PRIVATE"
+	Modalidade string `json:"modalidade,omitempty"` // regras da partida (vazio = a padrão); quem entra por código usa a da sala
+	Serie      int    `json:"serie,omitempty"`      // CREATE_ROOM: melhor de quantas partidas (1, 3 ou 5; vazio = 1)
 }
 
 type PairingMessage struct {
@@ -60,27 +141,253 @@ type PairingMessage struct {
 }
 
 // Compra de cartas e inventario
-type OpenPackageRequest struct{}
+// OpenPackageRequest compra um pacote do tipo pedido (vazio = o primeiro da LIST_PACKS).
+type OpenPackageRequest struct {
+	Tipo string `json:"tipo,omitempty"`
+}
 
 type CompraResponse struct {
-	Status     string     `json:"status"` // "OK" ou "FALHA"
-	CartaNova  *Carta     `json:"carta_nova,omitempty"`
+	Status     string     `json:"status"`           // COMPRA_APROVADA, NO_BALANCE, EMPTY_STORAGE ou PACOTE_INVALIDO
+	Pacote     string     `json:"pacote,omitempty"` // tipo do pacote aberto
+	Cartas     []Carta    `json:"cartas,omitempty"` // todas as cartas que saíram no pacote
 	Inventario Inventario `json:"inventario,omitempty"`
+	Pity       []Pity     `json:"pity,omitempty"` // progresso do pity depois desta compra
+}
+
+// Pity é o progresso do jogador até a raridade garantida num tipo de pacote.
+type Pity struct {
+	Raridade string `json:"raridade"`
+	Limite   int    `json:"limite"` // pacotes seguidos sem a raridade até ela ser garantida
+	Faltam   int    `json:"faltam"` // pacotes até a garantia, contando o próximo
+}
+
+// Loja de pacotes
+type ListPacksRequest struct{}
+
+type PacoteInfo struct {
+	Tipo     string             `json:"tipo"`
+	Nome     string             `json:"nome"`
+	Tamanho  int                `json:"tamanho"`
+	Preco    int                `json:"preco"`
+	Chances  map[string]float64 `json:"chances"`            // raridade -> probabilidade de cada carta (0 a 1)
+	Garantia string             `json:"garantia,omitempty"` // raridade mínima da última carta
+	Pity     []Pity             `json:"pity,omitempty"`     // progresso do jogador que pediu a lista
+	Esgotado bool               `json:"esgotado,omitempty"` // o estoque não tem cartas pra montar o pacote
+}
+
+type ListPacksResponse struct {
+	Pacotes []PacoteInfo `json:"pacotes"`
+}
+
+// Estoque global de onde saem as cartas dos pacotes
+type StorageStatusRequest struct{}
+
+type EstoqueCarta struct {
+	Nome       string `json:"nome"`
+	Raridade   string `json:"raridade"`
+	Quantidade int    `json:"quantidade"` // cópias disponíveis
+	Maximo     int    `json:"maximo"`     // até onde a reposição enche
+}
+
+type EstoquePacote struct {
+	Tipo     string `json:"tipo"`
+	Esgotado bool   `json:"esgotado"`
+}
+
+type StorageStatusResponse struct {
+	Cartas           []EstoqueCarta  `json:"cartas"`
+	Pacotes          []EstoquePacote `json:"pacotes"`
+	ProximaReposicao int64           `json:"proxima_reposicao,omitempty"` // Unix ms; 0 = o estoque não é reposto
+}
+
+// Trocas entre jogadores
+// TradeOfferRequest abre uma troca (Para) ou muda o lado do jogador numa troca
+// aberta (Troca). Cartas e moedas ficam em custódia até a troca acabar, e
+// qualquer mudança desfaz as confirmações dos dois lados.
+type TradeOfferRequest struct {
+	Troca  string   `json:"troca,omitempty"` // ID da troca; vazio abre uma nova
+	Para   string   `json:"para,omitempty"`  // login do outro jogador, só ao abrir
+	Cartas []string `json:"cartas"`          // IDs das cartas oferecidas
+	Moedas int      `json:"moedas"`
+}
+
+// TradeAcceptRequest confirma a troca como está. Quando os dois lados
+// confirmam, as cartas e moedas são trocadas de uma vez.
+type TradeAcceptRequest struct {
+	Troca string `json:"troca"`
+}
+
+// TradeCancelRequest desiste da troca e devolve o que estava em custódia.
+type TradeCancelRequest struct {
+	Troca string `json:"troca"`
+}
+
+// Status de TradeUpdate
+const (
+	TrocaAberta    = "ABERTA"
+	TrocaConcluida = "CONCLUIDA"
+	TrocaCancelada = "CANCELADA"
+)
+
+// TradeUpdate (tipo "TRADE_UPDATE") vai para os dois lados a cada mudança na troca.
+type TradeUpdate struct {
+	Troca      string      `json:"troca"`
+	Status     string      `json:"status"`
+	Lados      []LadoTroca `json:"lados"`
+	Motivo     string      `json:"motivo,omitempty"`     // por que foi cancelada
+	Inventario *Inventario `json:"inventario,omitempty"` // do destinatário, quando a troca é concluída
+}
+
+type LadoTroca struct {
+	Login      string  `json:"login"`
+	Cartas     []Carta `json:"cartas"`
+	Moedas     int     `json:"moedas"`
+	Confirmado bool    `json:"confirmado"`
+}
+
+// Mercado de cartas
+// Tipos de anúncio
+const (
+	AnuncioVenda  = "VENDA"  // preço fixo, leva quem comprar primeiro
+	AnuncioLeilao = "LEILAO" // leva o maior lance quando o prazo acaba
+)
+
+// MarketListRequest coloca uma carta do inventário à venda. A carta fica em
+// custódia (não pode ser trocada nem anunciada de novo) até o anúncio acabar.
+type MarketListRequest struct {
+	CartaID string `json:"carta_id"`
+	Tipo    string `json:"tipo"`              // VENDA ou LEILAO
+	Preco   int    `json:"preco"`             // preço da venda ou lance mínimo do leilão
+	Duracao int    `json:"duracao,omitempty"` // segundos, só no leilão
+}
+
+// MarketBrowseRequest lista os anúncios abertos. Filtros vazios não filtram.
+type MarketBrowseRequest struct {
+	Raridade string         `json:"raridade,omitempty"`
+	Nome     string         `json:"nome,omitempty"`    // parte do nome, sem diferenciar maiúsculas
+	Tipo     string         `json:"tipo,omitempty"`    // VENDA ou LEILAO
+	Minimos  map[string]int `json:"minimos,omitempty"` // atributo -> valor mínimo da carta
+}
+
+type MarketBrowseResponse struct {
+	Anuncios []AnuncioInfo `json:"anuncios"`
+}
+
+// MarketBidRequest dá um lance num leilão. As moedas ficam em custódia até
+// alguém dar um lance maior ou o leilão acabar.
+type MarketBidRequest struct {
+	Anuncio string `json:"anuncio"`
+	Valor   int    `json:"valor"`
+}
+
+// MarketBuyRequest compra pelo preço de um anúncio de VENDA.
+type MarketBuyRequest struct {
+	Anuncio string `json:"anuncio"`
+}
+
+// MarketCancelRequest tira o anúncio do mercado (leilão só enquanto não tem lance).
+type MarketCancelRequest struct {
+	Anuncio string `json:"anuncio"`
+}
+
+type AnuncioInfo struct {
+	ID        string `json:"id"`
+	Vendedor  string `json:"vendedor"`
+	Carta     Carta  `json:"carta"`
+	Tipo      string `json:"tipo"`
+	Preco     int    `json:"preco"`               // preço da venda ou lance mínimo
+	Lance     int    `json:"lance,omitempty"`     // maior lance até agora
+	Licitante string `json:"licitante,omitempty"` // quem deu o maior lance
+	Fim       int64  `json:"fim,omitempty"`       // fim do leilão (Unix, em milissegundos)
+}
+
+// Status de MarketUpdate
+const (
+	MercadoAnunciado = "ANUNCIADO" // anúncio criado
+	MercadoLance     = "LANCE"     // lance aceito (vai pro licitante e pro vendedor)
+	MercadoSuperado  = "SUPERADO"  // alguém deu um lance maior que o seu
+	MercadoVendido   = "VENDIDO"   // sua carta foi vendida
+	MercadoComprado  = "COMPRADO"  // você comprou ou arrematou a carta
+	MercadoExpirado  = "EXPIRADO"  // o leilão acabou sem lances
+	MercadoCancelado = "CANCELADO" // o vendedor tirou o anúncio
+)
+
+// MarketUpdate (tipo "MARKET_UPDATE") avisa o jogador do que aconteceu com um anúncio.
+type MarketUpdate struct {
+	Status     string      `json:"status"`
+	Anuncio    AnuncioInfo `json:"anuncio"`
+	Saldo      int         `json:"saldo"`
+	Inventario *Inventario `json:"inventario,omitempty"` // quando uma carta entrou ou saiu
+}
+
+// Oficina: desmontar cartas em fragmentos e criar cartas do catálogo com eles
+// DismantleRequest desmonta cópias do inventário (pelos IDs). Cada raridade
+// rende uma quantidade de fragmentos.
+type DismantleRequest struct {
+	Cartas []string `json:"cartas"`
+}
+
+// CraftRequest cria uma cópia nova de uma carta do catálogo, pelo nome.
+type CraftRequest struct {
+	Nome string `json:"nome"`
+}
+
+// OficinaResponse responde ao DISMANTLE ("DISMANTLE_RESPONSE") e ao CRAFT ("CRAFT_RESPONSE").
+type OficinaResponse struct {
+	Cartas     []Carta    `json:"cartas"`     // desmontadas ou a criada
+	Fragmentos int        `json:"fragmentos"` // saldo depois da operação
+	Inventario Inventario `json:"inventario"`
 }
 
 type InventoryResponse struct {
 	Inventario Inventario `json:"inventario"`
 }
 
+// SetDeckRequest lista os IDs das cartas do inventário que vão pro deck.
+// Os atributos vêm do catálogo do servidor, não do cliente.
 type SetDeckRequest struct {
-	Cartas []Carta `json:"cartas"`
+	Cartas []string `json:"cartas"`
 }
 
 // Gerenciamento de moedas
 type CheckBalance struct{}
 
 type BalanceResponse struct {
-	Saldo int `json:"saldo"`
+	Saldo      int `json:"saldo"`
+	Fragmentos int `json:"fragmentos"` // moeda da oficina
+}
+
+// Extrato de moedas
+// CoinHistoryRequest pede os últimos lançamentos do extrato (0 = os últimos 20).
+type CoinHistoryRequest struct {
+	Limite int `json:"limite,omitempty"`
+}
+
+// Motivos de Lancamento
+const (
+	MotivoSaldoInicial  = "SALDO_INICIAL" // saldo das contas de antes do extrato
+	MotivoCadastro      = "CADASTRO"
+	MotivoPacote        = "PACOTE"
+	MotivoPartida       = "PARTIDA"
+	MotivoTroca         = "TROCA"
+	MotivoVendaMercado  = "VENDA_MERCADO"
+	MotivoCompraMercado = "COMPRA_MERCADO"
+	MotivoDiario        = "DIARIO" // recompensa diária
+)
+
+// Lancamento é uma mudança no saldo de moedas.
+type Lancamento struct {
+	Hora       int64  `json:"hora"` // Unix, em milissegundos
+	Motivo     string `json:"motivo"`
+	Valor      int    `json:"valor"`                // positivo entra, negativo sai
+	Saldo      int    `json:"saldo"`                // saldo depois do lançamento
+	Referencia string `json:"referencia,omitempty"` // sala, tipo de pacote, troca ou anúncio
+}
+
+type CoinHistoryResponse struct {
+	Saldo       int          `json:"saldo"`
+	Total       int          `json:"total"`       // lançamentos no extrato inteiro
+	Lancamentos []Lancamento `json:"lancamentos"` // do mais recente pro mais antigo
 }
 
 // Check de Latencia
@@ -93,12 +400,31 @@ type LatencyResponse struct {
 // ESTRUTURAS PARA A PARTIDA
 
 type GameStartMessage struct {
-	Opponent string `json:"opponent"`
+	Opponent   string `json:"opponent"`
+	Modalidade string `json:"modalidade"`
+	Rounds     int    `json:"rounds"`
+
+	// Modo clássico: só quem tem a vez escolhe, e quem ganha leva as cartas
+	Classico     bool   `json:"classico,omitempty"`
+	SuperTrunfo  string `json:"super_trunfo,omitempty"`  // carta que ganha de todas...
+	ContraTrunfo string `json:"contra_trunfo,omitempty"` // ...menos das desta raridade
+
+	// Polaridade: atributos em que o menor valor ganha a partida inteira, e a
+	// chance (em %) de cada round inverter mais um
+	Invertidos     []string `json:"invertidos,omitempty"`
+	ChanceInversao int      `json:"chance_inversao,omitempty"`
+
+	Serie *SeriesScore `json:"serie,omitempty"` // placar da série antes desta partida
 }
 
 type RoundStartMessage struct {
-	Round int     `json:"round"`
-	Hand  []Carta `json:"hand"`
+	Round       int     `json:"round"`
+	Hand        []Carta `json:"hand"`
+	Prazo       int64   `json:"prazo,omitempty"`        // fim do tempo pra jogar (Unix, em milissegundos)
+	TempoJogada int     `json:"tempo_jogada,omitempty"` // segundos pra jogar, contados a partir do envio
+	Vez         string  `json:"vez,omitempty"`          // modo clássico: quem escolhe o atributo (Hand é a carta de cima do monte)
+
+	Invertidos []string `json:"invertidos,omitempty"` // atributos em que o menor valor ganha neste round
 }
 
 type PlayMoveRequest struct {
@@ -108,10 +434,13 @@ type PlayMoveRequest struct {
 
 // Estrutura para descrever a jogada de um jogador em um round
 type PlayerMoveInfo struct {
-	PlayerName    string `json:"player_name"`
-	CardName      string `json:"card_name"`
-	Attribute     string `json:"attribute"`
+	PlayerName     string `json:"player_name"`
+	CardName       string `json:"card_name"`
+	Attribute      string `json:"attribute"`
 	AttributeValue int    `json:"attribute_value"`
+	Automatica     bool   `json:"automatica,omitempty"`  // o tempo acabou e o servidor jogou pelo jogador
+	SemJogada      bool   `json:"sem_jogada,omitempty"`  // o tempo acabou e o jogador perdeu o round
+	MenorGanha     bool   `json:"menor_ganha,omitempty"` // no atributo escolhido ganhou o menor valor
 }
 
 type RoundResultMessage struct {
@@ -123,6 +452,15 @@ type RoundResultMessage struct {
 	TotalScoreP1  int            `json:"total_score_p1"`
 	TotalScoreP2  int            `json:"total_score_p2"`
 	ResultText    string         `json:"result_text"`
+
+	// No modo clássico os pontos do round são as cartas que cada um levou e
+	// o placar total é o tamanho de cada monte
+	Vencedor    string `json:"vencedor,omitempty"`     // quem ganhou o round (vazio no empate)
+	SuperTrunfo bool   `json:"super_trunfo,omitempty"` // o Super Trunfo decidiu o round
+	Mesa        int    `json:"mesa,omitempty"`         // cartas de empates esperando quem ganhar o próximo round
+	Vez         string `json:"vez,omitempty"`          // quem escolhe no próximo round
+
+	Invertidos []string `json:"invertidos,omitempty"` // atributos em que o menor valor ganhou neste round
 }
 
 type GameOverMessage struct {
@@ -130,4 +468,47 @@ type GameOverMessage struct {
 	FinalScoreP1 int    `json:"final_score_p1"`
 	FinalScoreP2 int    `json:"final_score_p2"`
 	CoinsEarned  int    `json:"coins_earned"`
-}
\ No newline at end of file
+	Abandono     string `json:"abandono,omitempty"` // login de quem perdeu por abandono (não voltou a tempo)
+
+	// Só em sala privada
+	Serie    *SeriesScore `json:"serie,omitempty"`    // placar da série contando esta partida
+	Continua bool         `json:"continua,omitempty"` // a próxima partida da série começa em seguida
+	Revanche int64        `json:"revanche,omitempty"` // até quando dá pra pedir REMATCH (Unix, em milissegundos)
+}
+
+// SeriesScore é o placar de uma série melhor de N numa sala privada.
+type SeriesScore struct {
+	Serie      int `json:"serie"`    // melhor de quantas
+	Partidas   int `json:"partidas"` // partidas já encerradas
+	VitoriasP1 int `json:"vitorias_p1"`
+	VitoriasP2 int `json:"vitorias_p2"`
+	Empates    int `json:"empates"`
+}
+
+// SeriesOverMessage (tipo "SERIES_OVER") vem depois do GAME_OVER da
+// partida que decidiu a série.
+type SeriesOverMessage struct {
+	SeriesScore
+	Jogador1 string `json:"jogador1"`
+	Jogador2 string `json:"jogador2"`
+	Winner   string `json:"winner"` // vencedor da série ou "EMPATE" (vazio se interrompida)
+	Abandono string `json:"abandono,omitempty"`
+	Motivo   string `json:"motivo,omitempty"` // por que a série parou antes de ser decidida
+}
+
+// RematchStatus (tipo "REMATCH_STATUS") acompanha um pedido de revanche
+// (REMATCH, sem dados) depois de uma partida em sala privada.
+type RematchStatus struct {
+	Status   string `json:"status"`
+	Oponente string `json:"oponente"`
+	Motivo   string `json:"motivo,omitempty"`
+}
+
+// Valores de RematchStatus.Status
+const (
+	RevancheAguardando = "AGUARDANDO" // pedido registrado, falta o oponente
+	RevanchePedida     = "PEDIDA"     // o oponente pediu revanche
+	RevancheAceita     = "ACEITA"     // os dois pediram: a nova partida vai começar
+	RevancheExpirada   = "EXPIRADA"   // o prazo acabou
+	RevancheCancelada  = "CANCELADA"  // alguém saiu da sala ou não pode jogar
+)
@@ -2,6 +2,8 @@ package main
 
 import (
 	"bufio"
+	crand "crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,11 +11,20 @@ import (
 	"net"
 	"os"
 	"os/signal"
-	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"golang.org/x/crypto/bcrypt"
+
+	"card_game/game"
+	"card_game/loja"
+	"card_game/persistencia"
 	"card_game/protocolo"
 )
 
@@ -22,12 +33,26 @@ import (
 type User struct {
 	Login      string
 	Senha      string
-	Conn       net.Conn
-	Online     bool
+	Online     bool `json:"-"`
 	Inventario Inventario
 	Moedas     int
+	Fragmentos int   // moeda da oficina: vem de cartas desmontadas e cria cartas novas
 	Latencia   int64 // em milissegundos
 	Deck       []protocolo.Carta
+	Token      string `json:"-"` // token da sessão, usado pelo RESUME pra reconectar
+
+	// Pacotes seguidos sem cada raridade, pro pity da loja
+	Pity loja.Contadores `json:",omitempty"`
+	// Anúncios abertos no mercado (as cartas continuam no inventário)
+	Anuncios []Anuncio `json:",omitempty"`
+	// Toda mudança em Moedas, em ordem. Só os últimos lançamentos ficam no
+	// perfil; os mais antigos se resumem em SaldoAnterior e Arquivados
+	Extrato       []Lancamento `json:",omitempty"`
+	SaldoAnterior int          `json:",omitempty"` // saldo antes do primeiro lançamento do Extrato
+	Arquivados    int          `json:",omitempty"` // lançamentos que já saíram do Extrato
+	// Recompensa diária: quando foi o último resgate e quantos dias seguidos
+	UltimoResgate time.Time
+	Sequencia     int `json:",omitempty"`
 }
 
 type Carta struct {
@@ -37,325 +62,2920 @@ type Carta struct {
 	Velocidade  int
 	Altura      int
 	Passageiros int
+
+	// Cópia de um inventário (vazio nas cartas do catálogo)
+	ID        string    `json:",omitempty"`
+	Adquirida time.Time `json:",omitempty"`
+	Origem    string    `json:",omitempty"` // protocolo.OrigemPacote, OrigemTroca, OrigemMercado ou OrigemCriacao
 }
 
 type Inventario struct {
 	Cartas []Carta
 }
 
-// Estrutura para armazenar a jogada de um jogador no round atual
-type PlayerMove struct {
-	CardIndex int
-	Attribute string
-	Submitted bool
-}
-
-// Estrutura para gerenciar o estado de uma partida
+// Estrutura para gerenciar o estado de uma partida. Rounds, mãos, jogadas e
+// placar ficam na game.Partida (o Jogador1 da sala é o game.LadoA); aqui
+// fica só o que depende de rede e de tempo.
 type GameState struct {
-	Round         int
-	Player1Score  int
-	Player2Score  int
-	Player1Hand   []protocolo.Carta
-	Player2Hand   []protocolo.Carta
-	Player1Move   PlayerMove
-	Player2Move   PlayerMove
-	GameMutex     sync.Mutex
+	*game.Partida
+	GameMutex sync.Mutex
+
+	Prazo    time.Time              // fim do tempo pra jogar no round atual
+	timer    *time.Timer            // dispara a jogada automática quando o prazo acaba
+	ausentes map[string]*time.Timer // login -> tolerância de quem caiu no meio da partida
 }
 
 type Sala struct {
 	ID        string
-	Jogador1  net.Conn
-	Jogador2  net.Conn
+	Jogador1  string // Login dos jogadores (a conexão fica na Sessao de cada um)
+	Jogador2  string
 	Status    string
 	IsPrivate bool
 	Game      *GameState // Adicionado para gerenciar o estado do jogo
+
+	// Modalidade escolhida por quem criou a sala (config.Regras)
+	Modalidade string
+	Regras     game.MatchRules
+
+	// Só nas salas privadas: a série melhor de N e, depois que ela acaba, o
+	// prazo pra revanche. Protegidos por mu.
+	Serie         *game.Serie
+	revanche      map[string]bool // quem já pediu revanche
+	prazoRevanche *time.Timer
+}
+
+// lado do jogador na game.Partida da sala.
+func (s *Sala) lado(login string) int {
+	if login == s.Jogador2 {
+		return game.LadoB
+	}
+	return game.LadoA
+}
+
+// jogador é o login de um lado da partida ("" para game.Nenhum).
+func (s *Sala) jogador(lado int) string {
+	switch lado {
+	case game.LadoA:
+		return s.Jogador1
+	case game.LadoB:
+		return s.Jogador2
+	}
+	return ""
 }
 
 // Variaveis globais
 var (
 	salas         map[string]*Sala
 	salasEmEspera []*Sala
-	playersInRoom map[string]*Sala
-	players       map[string]*User // Declarei como map porque posso usar futuramente pra verificar se ja esta online.
-	cartas        []Carta          // Lista de cartas EXISTENTES (Se quiser adicionar mais é so mexer no JSON na pasta data)
-	storage       []Carta          // Armazem onde ficam as cartas a serem "compradas"
+	playersInRoom map[string]*Sala   // login -> sala
+	players       map[string]*User   // Declarei como map porque posso usar futuramente pra verificar se ja esta online.
+	tokens        map[string]*User   // token de sessão -> jogador
+	trocas        map[string]*Troca  // trocas abertas, pelo ID
+	mercado       map[string]*User   // ID do anúncio -> vendedor
+	cartas        []Carta            // Lista de cartas EXISTENTES (Se quiser adicionar mais é so mexer no JSON na pasta data)
+	catalogo      map[string]Carta   // as mesmas cartas, indexadas pelo nome
+	porRaridade   map[string][]Carta // cartas do catálogo agrupadas por raridade, pro sorteio dos pacotes
+	pacotes       []loja.Pacote      // tipos de pacote à venda (data/pacotes.json)
+	estoque       Estoque            // cópias de cada carta que ainda podem sair nos pacotes
+	sorteio       *rand.Rand         // usado com mu travado
+	store         persistencia.PlayerStore
+	journal       *persistencia.Journal
+	config        Config
 	mu            sync.Mutex
+
+	// Sessões abertas, indexadas pela conexão e pelo login. Têm lock
+	// próprio, que pode ser pego com mu já travado (nunca o contrário).
+	sessoesPorConn  map[net.Conn]*Sessao
+	sessoesPorLogin map[string]*Sessao
+	sessoesMu       sync.RWMutex
+)
+
+const (
+	playerDataFile = "data/players.json"
+	playerDBFile   = "data/players.db"
+	journalFile    = "data/journal.log"
+	configFile     = "data/config.json"
+	pacotesFile    = "data/pacotes.json"
+	cartasFile     = "data/cartas.json"
+	estoqueFile    = "data/estoque.json"
+)
+
+// CONFIGURACAO
+// Config é lida de data/config.json na inicialização. Campos ausentes ficam com o valor padrão.
+type Config struct {
+	Persistencia ConfigPersistencia `json:"persistencia"`
+	Rede         ConfigRede         `json:"rede"`
+	Partida      ConfigPartida      `json:"partida"`
+	Mercado      ConfigMercado      `json:"mercado"`
+	Oficina      ConfigOficina      `json:"oficina"`
+	Extrato      ConfigExtrato      `json:"extrato"`
+	Diario       ConfigDiario       `json:"diario"`
+	Estoque      ConfigEstoque      `json:"estoque"`
+	Regras       ConfigRegras       `json:"regras"`
+}
+
+type ConfigPersistencia struct {
+	Backend string `json:"backend"` // "json" ou "bolt"
+	Arquivo string `json:"arquivo"` // caminho do arquivo usado pelo backend
+	Journal string `json:"journal"` // journal de eventos de economia
+
+	IntervaloSnapshot int `json:"intervalo_snapshot"` // segundos entre snapshots do store
+	Backups           int `json:"backups"`            // quantos snapshots antigos manter
+}
+
+type ConfigRede struct {
+	FilaSaida         int `json:"fila_saida"`         // mensagens que cabem na fila de saída de cada sessão
+	TimeoutEscrita    int `json:"timeout_escrita"`    // milissegundos pra uma escrita no socket terminar
+	IntervaloMetricas int `json:"intervalo_metricas"` // segundos entre os logs das métricas de envio
+}
+
+type ConfigPartida struct {
+	TempoJogada          int    `json:"tempo_jogada"`          // segundos pra jogar em cada round (0 = sem limite)
+	JogadaExpirada       string `json:"jogada_expirada"`       // o que acontece com quem não jogou a tempo: "ALEATORIA" ou "PERDE_ROUND"
+	ToleranciaDesconexao int    `json:"tolerancia_desconexao"` // segundos pra quem caiu voltar antes de perder por abandono
+	PausaSerie           int    `json:"pausa_serie"`           // segundos entre as partidas de uma série
+	TempoRevanche        int    `json:"tempo_revanche"`        // segundos pra pedir revanche depois de uma sala privada (0 = sem revanche)
+}
+
+type ConfigMercado struct {
+	IntervaloLiquidacao int `json:"intervalo_liquidacao"` // segundos entre as verificações de leilões vencidos
+	DuracaoMinima       int `json:"duracao_minima"`       // segundos
+	DuracaoMaxima       int `json:"duracao_maxima"`       // segundos
+	MaxAnuncios         int `json:"max_anuncios"`         // anúncios abertos por jogador
+}
+
+type ConfigOficina struct {
+	Desmontar map[string]int `json:"desmontar"` // raridade -> fragmentos ganhos por carta desmontada
+	Criar     map[string]int `json:"criar"`     // raridade -> fragmentos pra criar uma carta
+}
+
+type ConfigExtrato struct {
+	MaxLancamentos int `json:"max_lancamentos"` // lançamentos guardados no perfil de cada jogador
+}
+
+type ConfigDiario struct {
+	Recompensas []int `json:"recompensas"` // moedas do 1º, 2º, ... dia seguido; depois repete o último
+}
+
+type ConfigEstoque struct {
+	Arquivo            string         `json:"arquivo"`             // onde o estoque fica salvo
+	Maximo             map[string]int `json:"maximo"`              // raridade -> cópias de cada carta com o estoque cheio
+	IntervaloReposicao int            `json:"intervalo_reposicao"` // segundos entre reposições (0 = nunca repõe)
+	Reposicao          map[string]int `json:"reposicao"`           // raridade -> cópias de cada carta repostas por vez
+}
+
+type ConfigRegras struct {
+	Padrao      string                     `json:"padrao"`      // modalidade de quem não escolhe nenhuma
+	Modalidades map[string]game.MatchRules `json:"modalidades"` // nome -> regras da partida
+}
+
+// Valores de ConfigPartida.JogadaExpirada
+const (
+	JogadaAleatoria  = "ALEATORIA"
+	JogadaPerdeRound = "PERDE_ROUND"
 )
 
-const playerDataFile = "data/players.json"
+func carregarConfig() (Config, error) {
+	cfg := Config{
+		Persistencia: ConfigPersistencia{
+			Backend:           persistencia.BackendJSON,
+			Journal:           journalFile,
+			IntervaloSnapshot: 60,
+			Backups:           3,
+		},
+		Rede: ConfigRede{
+			FilaSaida:         64,
+			TimeoutEscrita:    5000,
+			IntervaloMetricas: 60,
+		},
+		Partida: ConfigPartida{
+			TempoJogada:          30,
+			JogadaExpirada:       JogadaAleatoria,
+			ToleranciaDesconexao: 60,
+			PausaSerie:           5,
+			TempoRevanche:        30,
+		},
+		Mercado: ConfigMercado{
+			IntervaloLiquidacao: 5,
+			DuracaoMinima:       60,
+			DuracaoMaxima:       86400,
+			MaxAnuncios:         10,
+		},
+		Oficina: ConfigOficina{
+			Desmontar: map[string]int{"Comum": 5, "Rara": 20, "Muito Rara": 100},
+			Criar:     map[string]int{"Comum": 40, "Rara": 160, "Muito Rara": 800},
+		},
+		Extrato: ConfigExtrato{
+			MaxLancamentos: 200,
+		},
+		Diario: ConfigDiario{
+			Recompensas: []int{10, 15, 20, 25, 30, 40, 50},
+		},
+		Regras: ConfigRegras{
+			Padrao:      "NORMAL",
+			Modalidades: map[string]game.MatchRules{"NORMAL": game.Padrao()},
+		},
+		Estoque: ConfigEstoque{
+			Arquivo:            estoqueFile,
+			Maximo:             map[string]int{"Comum": 200, "Rara": 60, "Muito Rara": 15},
+			IntervaloReposicao: 600,
+			Reposicao:          map[string]int{"Comum": 20, "Rara": 5, "Muito Rara": 1},
+		},
+	}
+
+	data, err := os.ReadFile(configFile)
+	if err != nil && !os.IsNotExist(err) {
+		return cfg, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("decodificando %s: %w", configFile, err)
+		}
+	}
+
+	if cfg.Partida.JogadaExpirada != JogadaAleatoria && cfg.Partida.JogadaExpirada != JogadaPerdeRound {
+		return cfg, fmt.Errorf("jogada_expirada inválida: %q", cfg.Partida.JogadaExpirada)
+	}
+	if cfg.Partida.PausaSerie < 0 || cfg.Partida.TempoRevanche < 0 {
+		return cfg, fmt.Errorf("partida: pausa_serie e tempo_revanche não podem ser negativos")
+	}
+
+	if cfg.Extrato.MaxLancamentos < 1 {
+		return cfg, fmt.Errorf("extrato: max_lancamentos precisa ser pelo menos 1")
+	}
+
+	if len(cfg.Diario.Recompensas) == 0 {
+		return cfg, fmt.Errorf("diario: a lista de recompensas está vazia")
+	}
+	for _, moedas := range cfg.Diario.Recompensas {
+		if moedas < 0 {
+			return cfg, fmt.Errorf("diario: recompensa negativa (%d)", moedas)
+		}
+	}
+
+	for nome, regras := range cfg.Regras.Modalidades {
+		if err := regras.Validar(); err != nil {
+			return cfg, fmt.Errorf("regras: modalidade %s: %v", nome, err)
+		}
+		if regras.ContraTrunfo != "" && loja.Nivel(regras.ContraTrunfo) < 0 {
+			return cfg, fmt.Errorf("regras: modalidade %s: raridade desconhecida %q", nome, regras.ContraTrunfo)
+		}
+	}
+	if _, ok := cfg.Regras.Modalidades[cfg.Regras.Padrao]; !ok {
+		return cfg, fmt.Errorf("regras: a modalidade padrão %q não existe", cfg.Regras.Padrao)
+	}
+
+	for raridade, maximo := range cfg.Estoque.Maximo {
+		if loja.Nivel(raridade) < 0 || maximo < 0 {
+			return cfg, fmt.Errorf("estoque: maximo %q: %d", raridade, maximo)
+		}
+	}
+	for raridade, quantidade := range cfg.Estoque.Reposicao {
+		if loja.Nivel(raridade) < 0 || quantidade < 0 {
+			return cfg, fmt.Errorf("estoque: reposicao %q: %d", raridade, quantidade)
+		}
+	}
+	if cfg.Estoque.IntervaloReposicao < 0 {
+		return cfg, fmt.Errorf("estoque: intervalo_reposicao negativo")
+	}
+
+	// Criar e desmontar a mesma carta nunca pode dar lucro
+	for raridade, valor := range cfg.Oficina.Desmontar {
+		if loja.Nivel(raridade) < 0 || valor < 0 {
+			return cfg, fmt.Errorf("oficina: desmontar %q: %d", raridade, valor)
+		}
+		if custo, ok := cfg.Oficina.Criar[raridade]; ok && valor >= custo {
+			return cfg, fmt.Errorf("oficina: desmontar %s (%d) rende o mesmo que criar (%d) ou mais", raridade, valor, custo)
+		}
+	}
+	for raridade, custo := range cfg.Oficina.Criar {
+		if loja.Nivel(raridade) < 0 || custo < 1 {
+			return cfg, fmt.Errorf("oficina: criar %q: %d", raridade, custo)
+		}
+	}
+
+	if cfg.Persistencia.Arquivo == "" {
+		if cfg.Persistencia.Backend == persistencia.BackendBolt {
+			cfg.Persistencia.Arquivo = playerDBFile
+		} else {
+			cfg.Persistencia.Arquivo = playerDataFile
+		}
+	}
+	return cfg, nil
+}
 
 // FUNCOES PARA PERSISTENCIA DE DADOS
-// loadPlayerData carrega os dados dos jogadores de um arquivo JSON.
-func loadPlayerData() {
+// loadPlayerData carrega os dados dos jogadores do store configurado.
+func loadPlayerData() error {
 	mu.Lock()
 	defer mu.Unlock()
 
-	data, err := os.ReadFile(playerDataFile)
+	players = make(map[string]*User)
+
+	registros, err := store.List()
 	if err != nil {
-		if os.IsNotExist(err) {
-			fmt.Printf("Arquivo de jogadores (%s) não encontrado. Um novo será criado ao fechar o servidor.\n", playerDataFile)
-			players = make(map[string]*User)
-		} else {
-			fmt.Printf("Erro ao ler o arquivo de jogadores: %v\n", err)
+		return err
+	}
+
+	for login, data := range registros {
+		var player User
+		if err := json.Unmarshal(data, &player); err != nil {
+			fmt.Printf("Erro ao decodificar o jogador %s: %v\n", login, err)
+			continue
 		}
-		return
+		players[login] = &player
 	}
 
-	if err := json.Unmarshal(data, &players); err != nil {
-		fmt.Printf("Erro ao decodificar o JSON dos jogadores: %v\n", err)
-		return
+	fmt.Printf("%d jogadores carregados de %s (%s).\n", len(players), config.Persistencia.Arquivo, config.Persistencia.Backend)
+	return nil
+}
+
+// salvarJogadores grava os jogadores no store numa única transação.
+func salvarJogadores(jogadores ...*User) error {
+	estados, err := estadosDe(jogadores...)
+	if err != nil {
+		return err
+	}
+	return gravarEstados(estados)
+}
+
+// estadosDe serializa os jogadores (login -> JSON) pra gravar no journal/store.
+func estadosDe(jogadores ...*User) (map[string][]byte, error) {
+	estados := make(map[string][]byte, len(jogadores))
+	for _, player := range jogadores {
+		data, err := json.Marshal(player)
+		if err != nil {
+			return nil, err
+		}
+		estados[player.Login] = data
+	}
+	return estados, nil
+}
+
+func gravarEstados(estados map[string][]byte) error {
+	return store.Update(func(tx persistencia.Tx) error {
+		for login, data := range estados {
+			if err := tx.Put(login, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// JOURNAL DE ECONOMIA
+// Tipos de evento gravados no journal
+const (
+	EventoContaCriada       = "CONTA_CRIADA"
+	EventoCartaComprada     = "CARTA_COMPRADA"
+	EventoMoedasCreditadas  = "MOEDAS_CREDITADAS"
+	EventoDeckDefinido      = "DECK_DEFINIDO"
+	EventoTrocaConcluida    = "TROCA_CONCLUIDA"
+	EventoAnuncioCriado     = "ANUNCIO_CRIADO"
+	EventoLance             = "LANCE"
+	EventoAnuncioEncerrado  = "ANUNCIO_ENCERRADO" // cancelado ou vencido sem lance
+	EventoVendaMercado      = "VENDA_MERCADO"
+	EventoCartasDesmontadas = "CARTAS_DESMONTADAS"
+	EventoCartaCriada       = "CARTA_CRIADA"
+	EventoRecompensaDiaria  = "RECOMPENSA_DIARIA"
+)
+
+// Detalhes gravados junto com alguns eventos (só pra auditoria, o replay usa o estado)
+type detalheCompra struct {
+	Pacote string   `json:"pacote"`
+	Cartas []string `json:"cartas"` // IDs das cartas que saíram
+	Preco  int      `json:"preco"`
+}
+
+type detalheTroca struct {
+	Troca string             `json:"troca"`
+	Lados []detalheLadoTroca `json:"lados"`
+}
+
+type detalheLadoTroca struct {
+	Login  string   `json:"login"`
+	Cartas []string `json:"cartas"`
+	Moedas int      `json:"moedas"`
+}
+
+type detalheAnuncio struct {
+	Anuncio   string `json:"anuncio"`
+	CartaID   string `json:"carta_id"`
+	Tipo      string `json:"tipo,omitempty"`
+	Preco     int    `json:"preco,omitempty"`
+	Licitante string `json:"licitante,omitempty"`
+	Valor     int    `json:"valor,omitempty"`
+	Motivo    string `json:"motivo,omitempty"`
+}
+
+type detalheVenda struct {
+	Anuncio   string `json:"anuncio"`
+	CartaID   string `json:"carta_id"`
+	Tipo      string `json:"tipo"`
+	Vendedor  string `json:"vendedor"`
+	Comprador string `json:"comprador"`
+	Valor     int    `json:"valor"`
+}
+
+type detalheOficina struct {
+	Cartas     []string `json:"cartas"`     // IDs das desmontadas ou da criada
+	Fragmentos int      `json:"fragmentos"` // ganhos (ou gastos, negativo)
+}
+
+type detalheDiario struct {
+	Sequencia int `json:"sequencia"`
+	Moedas    int `json:"moedas"`
+}
+
+type detalheCredito struct {
+	Sala     string         `json:"sala"`
+	Valores  map[string]int `json:"valores"`
+	Abandono string         `json:"abandono,omitempty"`
+}
+
+// registrarEvento grava o evento no journal (com fsync) e depois no store.
+// Chamar com mu travado, logo depois de alterar os jogadores e antes de
+// responder ao cliente: se retornar nil a alteração sobrevive a um crash.
+func registrarEvento(tipo string, detalhe interface{}, jogadores ...*User) error {
+	estados, err := estadosDe(jogadores...)
+	if err != nil {
+		return err
+	}
+	if err := journal.Registrar(tipo, detalhe, estados); err != nil {
+		return err
+	}
+	return gravarEstados(estados)
+}
+
+// copiaJogadores guarda o estado dos jogadores antes de uma alteração. Se
+// o registrarEvento falhar, a alteração não foi gravada e não pode ficar só
+// na memória (sumiria no próximo restart): desfazer volta pra cópia.
+type copiaJogadores map[*User][]byte
+
+// copiarJogadores tira a cópia. Chamar com mu travado, antes de alterar.
+func copiarJogadores(jogadores ...*User) copiaJogadores {
+	copia := make(copiaJogadores, len(jogadores))
+	for _, player := range jogadores {
+		data, err := json.Marshal(player)
+		if err != nil {
+			fmt.Printf("Erro ao copiar o estado de %s: %v\n", player.Login, err)
+			continue
+		}
+		copia[player] = data
+	}
+	return copia
+}
+
+// desfazer volta os jogadores pro estado copiado. O que não é gravado (a
+// sessão) fica como está, e os ponteiros continuam valendo. Chamar com mu travado.
+func (c copiaJogadores) desfazer() {
+	for player, data := range c {
+		online, token := player.Online, player.Token
+		*player = User{}
+		if err := json.Unmarshal(data, player); err != nil {
+			fmt.Printf("Erro ao desfazer a alteração de %s: %v\n", player.Login, err)
+		}
+		player.Online, player.Token = online, token
+	}
+}
+
+// recuperarJournal reaplica no store os eventos que ficaram no journal
+// (o servidor caiu sem chegar a salvar) e depois zera o journal.
+func recuperarJournal() error {
+	finais := make(map[string][]byte)
+	total := 0
+	err := persistencia.LerJournal(config.Persistencia.Journal, func(e persistencia.Evento) error {
+		for login, estado := range e.Estados {
+			finais[login] = estado
+		}
+		total++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if total == 0 {
+		return nil
+	}
+	if err := gravarEstados(finais); err != nil {
+		return err
+	}
+	fmt.Printf("%d eventos do journal reaplicados (%d jogadores).\n", total, len(finais))
+	return snapshotJogadores()
+}
+
+// SNAPSHOTS
+var (
+	segmentoCoberto string // segmento do journal coberto pelo último snapshot gravado
+	snapshotMu      sync.Mutex
+)
+
+// snapshotJogadores grava um snapshot do store e descarta o trecho do
+// journal que ele cobre. mu só fica travado pra rotacionar o journal e
+// copiar o store; serializar e escrever o arquivo acontece fora do lock.
+func snapshotJogadores() error {
+	mu.Lock()
+	segmento, foto, err := capturarSnapshot()
+	mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return gravarSnapshot(segmento, foto)
+}
+
+// capturarSnapshot deve ser chamada com mu travado: como todo evento vai
+// pro journal e pro store dentro do mesmo lock, o segmento rotacionado e a
+// cópia do store ficam exatamente consistentes.
+func capturarSnapshot() (string, persistencia.Snapshot, error) {
+	segmento, err := journal.Rotacionar()
+	if err != nil {
+		return "", nil, err
+	}
+	var foto persistencia.Snapshot
+	if snap, ok := store.(persistencia.Snapshotter); ok {
+		foto = snap.Capturar()
+	}
+	return segmento, foto, nil
+}
+
+func gravarSnapshot(segmento string, foto persistencia.Snapshot) error {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+
+	// Backends que gravam a cada commit (bolt) não precisam de arquivo de snapshot
+	if snap, ok := store.(persistencia.Snapshotter); ok {
+		if err := snap.Gravar(foto); err != nil {
+			return err
+		}
 	}
 
-	fmt.Printf("%d jogadores carregados do arquivo %s.\n", len(players), playerDataFile)
+	// O segmento coberto por este snapshot só é apagado no próximo: se o
+	// arquivo principal se corromper, o backup .1 mais esse segmento ainda
+	// reconstroem tudo.
+	anterior := segmentoCoberto
+	if segmento != "" {
+		segmentoCoberto = segmento
+	}
+	if anterior == segmentoCoberto {
+		return nil
+	}
+	return journal.Descartar(anterior)
+}
+
+// Funcao que fica gravando snapshots no intervalo configurado.
+func snapshotPeriodico(intervalo time.Duration) {
+	for {
+		time.Sleep(intervalo)
+
+		mu.Lock()
+		segmento, foto, err := capturarSnapshot()
+		mu.Unlock()
+		if err == nil && segmento == "" {
+			continue // nenhum evento desde o último snapshot
+		}
+		if err == nil {
+			err = gravarSnapshot(segmento, foto)
+		}
+		if err != nil {
+			fmt.Printf("Erro ao gravar snapshot dos jogadores: %v\n", err)
+		}
+	}
 }
 
-// savePlayerData salva os dados dos jogadores em um arquivo JSON.
+// savePlayerData grava todos os jogadores e fecha o store (usada no desligamento).
 func savePlayerData() {
 	fmt.Println("\nSalvando dados dos jogadores...")
 	mu.Lock()
 	defer mu.Unlock()
 
-	// Garante que ninguém seja salvo como "online"
+	todos := make([]*User, 0, len(players))
 	for _, player := range players {
-		player.Online = false
-		player.Conn = nil
+		todos = append(todos, player)
 	}
 
-	data, err := json.MarshalIndent(players, "", "  ") // Usa MarshalIndent para um JSON formatado
+	err := salvarJogadores(todos...)
+	if err == nil {
+		var segmento string
+		var foto persistencia.Snapshot
+		segmento, foto, err = capturarSnapshot()
+		if err == nil {
+			err = gravarSnapshot(segmento, foto)
+		}
+	}
 	if err != nil {
-		fmt.Printf("Erro ao codificar os dados dos jogadores para JSON: %v\n", err)
-		return
+		fmt.Printf("Erro ao salvar os dados dos jogadores: %v\n", err)
+	} else {
+		fmt.Printf("Dados de %d jogadores salvos com sucesso em %s.\n", len(players), config.Persistencia.Arquivo)
+	}
+
+	if err := journal.Close(); err != nil {
+		fmt.Printf("Erro ao fechar o journal: %v\n", err)
+	}
+
+	if err := store.Close(); err != nil {
+		fmt.Printf("Erro ao fechar o armazenamento: %v\n", err)
 	}
+}
+
+// FUNCOES DE SENHA
+// As senhas são guardadas com bcrypt, que já inclui um salt aleatório em cada hash.
+func hashSenha(senha string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(senha), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func senhaConfere(hash, senha string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(senha)) == nil
+}
+
+// Senhas de contas antigas ficaram em texto puro no players.json
+func senhaEmTextoPuro(senha string) bool {
+	_, err := bcrypt.Cost([]byte(senha))
+	return err != nil
+}
+
+// migrarSenhas troca (uma vez só) as senhas em texto puro pelo hash. Roda na
+// inicialização, antes de aceitar conexões, usando todos os núcleos.
+func migrarSenhas() (int, error) {
+	mu.Lock()
+	pendentes := make([]*User, 0)
+	for _, player := range players {
+		if senhaEmTextoPuro(player.Senha) {
+			pendentes = append(pendentes, player)
+		}
+	}
+	mu.Unlock()
+
+	if len(pendentes) == 0 {
+		return 0, nil
+	}
+	fmt.Printf("Migrando %d senhas em texto puro para bcrypt...\n", len(pendentes))
+
+	hashes := make([]string, len(pendentes))
+	fila := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range fila {
+				hash, err := hashSenha(pendentes[i].Senha)
+				if err != nil {
+					fmt.Printf("Não foi possível migrar a senha de %s: %v\n", pendentes[i].Login, err)
+					continue
+				}
+				hashes[i] = hash
+			}
+		}()
+	}
+	for i := range pendentes {
+		fila <- i
+	}
+	close(fila)
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	migrados := make([]*User, 0, len(pendentes))
+	for i, player := range pendentes {
+		if hashes[i] != "" {
+			player.Senha = hashes[i]
+			migrados = append(migrados, player)
+		}
+	}
+	return len(migrados), salvarJogadores(migrados...)
+}
+
+// SESSOES
+// Sessao é uma conexão aberta com um cliente. Só a sessão escreve no
+// socket: as mensagens entram na fila de saída e a goroutine escrever as
+// manda na ordem, uma inteira por vez. O resto do servidor identifica os
+// jogadores pelo login e fala com eles por enviarPara.
+//
+// A fila é limitada e Enviar nunca bloqueia: um cliente que não lê (ou lê
+// devagar demais) enche a fila e é desconectado, em vez de travar quem
+// está mandando mensagem pra ele com mu na mão.
+type Sessao struct {
+	Conn  net.Conn
+	Login string // vazio até o LOGIN ou RESUME
+
+	saida   chan protocolo.Message
+	fechada chan struct{}
+	fechar  sync.Once
+}
+
+// Métricas de envio, somadas de todas as sessões
+var (
+	msgsEnviadas    atomic.Int64 // mensagens escritas no socket
+	msgsDescartadas atomic.Int64 // mensagens perdidas porque a fila estava cheia
+	msgsAtrasadas   atomic.Int64 // mensagens que entraram com a fila já pela metade
+	picoFilaSaida   atomic.Int64 // maior fila de saída vista
+	sessoesLentas   atomic.Int64 // sessões derrubadas por não dar conta das mensagens
+	errosEscrita    atomic.Int64 // escritas que falharam ou estouraram o prazo
+)
 
-	if err := os.WriteFile(playerDataFile, data, 0644); err != nil {
-		fmt.Printf("Erro ao salvar os dados dos jogadores no arquivo: %v\n", err)
+// abrirSessao cria a sessão da conexão, registra no índice e começa a escrever.
+func abrirSessao(conn net.Conn) *Sessao {
+	sessao := &Sessao{
+		Conn:    conn,
+		saida:   make(chan protocolo.Message, config.Rede.FilaSaida),
+		fechada: make(chan struct{}),
+	}
+	sessoesMu.Lock()
+	sessoesPorConn[conn] = sessao
+	sessoesMu.Unlock()
+
+	go sessao.escrever()
+	return sessao
+}
+
+// fecharSessao tira a sessão dos índices e fecha a conexão.
+func fecharSessao(sessao *Sessao) {
+	sessoesMu.Lock()
+	delete(sessoesPorConn, sessao.Conn)
+	if sessoesPorLogin[sessao.Login] == sessao {
+		delete(sessoesPorLogin, sessao.Login)
+	}
+	sessoesMu.Unlock()
+
+	sessao.Fechar()
+}
+
+// Enviar coloca a mensagem na fila de saída sem bloquear. Se a fila estiver
+// cheia o cliente é considerado lento: a mensagem é descartada e a sessão é
+// fechada (o jogador pode voltar com RESUME). Depois de fechada a sessão as
+// mensagens são ignoradas.
+func (sessao *Sessao) Enviar(msg protocolo.Message) {
+	select {
+	case <-sessao.fechada:
 		return
+	default:
 	}
 
-	fmt.Printf("Dados de %d jogadores salvos com sucesso em %s.\n", len(players), playerDataFile)
+	select {
+	case sessao.saida <- msg:
+		tamanho := int64(len(sessao.saida))
+		if tamanho*2 >= int64(cap(sessao.saida)) {
+			msgsAtrasadas.Add(1)
+		}
+		for pico := picoFilaSaida.Load(); tamanho > pico; pico = picoFilaSaida.Load() {
+			if picoFilaSaida.CompareAndSwap(pico, tamanho) {
+				break
+			}
+		}
+	default:
+		msgsDescartadas.Add(1)
+		sessoesLentas.Add(1)
+		fmt.Printf("Fila de saída de %s cheia (%d mensagens), desconectando.\n", sessao.nome(), cap(sessao.saida))
+		sessao.Fechar()
+	}
 }
 
-// FUNCOES PRA GERENCIAR CONEXAO INICIAL
-func loginUser(conn net.Conn, data protocolo.LoginRequest) {
+// Fechar encerra a conexão; a goroutine de leitura cai logo em seguida.
+func (sessao *Sessao) Fechar() {
+	sessao.fechar.Do(func() {
+		close(sessao.fechada)
+		sessao.Conn.Close()
+	})
+}
+
+func (sessao *Sessao) escrever() {
+	timeout := time.Duration(config.Rede.TimeoutEscrita) * time.Millisecond
+	for {
+		select {
+		case msg := <-sessao.saida:
+			data, err := json.Marshal(msg)
+			if err != nil {
+				fmt.Printf("Erro ao codificar mensagem %s: %v\n", msg.Type, err)
+				continue
+			}
+			// Uma escrita só por mensagem, assim o '\n' nunca se separa do JSON
+			sessao.Conn.SetWriteDeadline(time.Now().Add(timeout))
+			if _, err := sessao.Conn.Write(append(data, '\n')); err != nil {
+				select {
+				case <-sessao.fechada: // fechada por outro motivo no meio da escrita
+				default:
+					errosEscrita.Add(1)
+					fmt.Printf("Erro ao escrever para %s: %v\n", sessao.nome(), err)
+					sessao.Fechar()
+				}
+				return
+			}
+			msgsEnviadas.Add(1)
+		case <-sessao.fechada:
+			return
+		}
+	}
+}
+
+// nome identifica a sessão nos logs.
+func (sessao *Sessao) nome() string {
+	if sessao.Login != "" {
+		return sessao.Login
+	}
+	return sessao.Conn.RemoteAddr().String()
+}
+
+// logMetricasPeriodico imprime as métricas de envio quando algo mudou.
+func logMetricasPeriodico(intervalo time.Duration) {
+	var ultimo string
+	for {
+		time.Sleep(intervalo)
+
+		sessoesMu.RLock()
+		abertas := len(sessoesPorConn)
+		sessoesMu.RUnlock()
+
+		linha := fmt.Sprintf("Envio: %d sessões, %d enviadas, %d atrasadas, %d descartadas, pico da fila %d, %d sessões lentas, %d erros de escrita",
+			abertas, msgsEnviadas.Load(), msgsAtrasadas.Load(), msgsDescartadas.Load(),
+			picoFilaSaida.Load(), sessoesLentas.Load(), errosEscrita.Load())
+		if linha != ultimo {
+			fmt.Println(linha)
+			ultimo = linha
+		}
+	}
+}
+
+// vincularSessao liga a sessão ao login. Se o login já tinha outra sessão,
+// ela perde o vínculo (quem chama decide se fecha).
+func vincularSessao(sessao *Sessao, login string) {
+	sessoesMu.Lock()
+	defer sessoesMu.Unlock()
+
+	if sessao.Login != "" && sessoesPorLogin[sessao.Login] == sessao {
+		delete(sessoesPorLogin, sessao.Login)
+	}
+	sessao.Login = login
+	sessoesPorLogin[login] = sessao
+}
+
+// desvincularSessao tira o login da sessão do índice (a conexão continua aberta).
+func desvincularSessao(sessao *Sessao) {
+	sessoesMu.Lock()
+	defer sessoesMu.Unlock()
+
+	if sessoesPorLogin[sessao.Login] == sessao {
+		delete(sessoesPorLogin, sessao.Login)
+	}
+}
+
+// sessaoDoJogador devolve a sessão atual do login, ou nil se ele estiver offline.
+func sessaoDoJogador(login string) *Sessao {
+	sessoesMu.RLock()
+	defer sessoesMu.RUnlock()
+	return sessoesPorLogin[login]
+}
+
+// enviarPara manda a mensagem pro jogador se ele estiver conectado. Se não
+// estiver a mensagem se perde, e o RESUME reenvia o estado da partida.
+func enviarPara(login string, msg protocolo.Message) {
+	if sessao := sessaoDoJogador(login); sessao != nil {
+		sessao.Enviar(msg)
+	}
+}
+
+// migrarCartas dá um ID a cada carta de inventário que ainda não tem (contas
+// de antes dos IDs). A data e a origem reais não existem mais; como até então
+// a única forma de ganhar carta era comprando, a origem fica PACOTE e a data
+// é a da migração. As cartas do deck são ligadas às cópias do inventário.
+func migrarCartas() (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	agora := time.Now()
+	migrados := make([]*User, 0)
+	total := 0
+	for _, player := range players {
+		n := 0
+		for i := range player.Inventario.Cartas {
+			c := &player.Inventario.Cartas[i]
+			if c.ID == "" {
+				c.ID = novoIDCarta()
+				c.Adquirida = agora
+				c.Origem = protocolo.OrigemPacote
+				n++
+			}
+		}
+
+		// Cada carta do deck sem ID pega a primeira cópia livre com o mesmo nome
+		usadas := make(map[string]bool)
+		for _, d := range player.Deck {
+			usadas[d.ID] = true
+		}
+		for i := range player.Deck {
+			if player.Deck[i].ID != "" {
+				continue
+			}
+			for _, c := range player.Inventario.Cartas {
+				if c.Nome == player.Deck[i].Nome && !usadas[c.ID] {
+					player.Deck[i].ID = c.ID
+					usadas[c.ID] = true
+					n++
+					break
+				}
+			}
+		}
+
+		if n > 0 {
+			migrados = append(migrados, player)
+			total += n
+		}
+	}
+	return total, salvarJogadores(migrados...)
+}
+
+// FUNCOES PRA GERENCIAR CONEXAO INICIAL
+func loginUser(sessao *Sessao, data protocolo.LoginRequest) {
+	// Pega o hash com o lock e compara fora dele: o bcrypt é lento de propósito
+	mu.Lock()
+	player, exists := players[data.Login]
+	var hash string
+	if exists {
+		hash = player.Senha
+	}
+	mu.Unlock()
+
+	if !exists {
+		// Usuário não existe
+		msg := protocolo.Message{
+			Type: "LOGIN",
+			Data: protocolo.LoginResponse{Status: "N_EXIST"},
+		}
+		sessao.Enviar(msg)
+		return
+	}
+
+	if !senhaConfere(hash, data.Senha) {
+		msg := protocolo.Message{
+			Type: "LOGIN",
+			Data: protocolo.LoginResponse{Status: "SENHA_INVALIDA"},
+		}
+		sessao.Enviar(msg)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if player.Online {
+		// Usuário já está logado em outro lugar
+		msg := protocolo.Message{
+			Type: "LOGIN",
+			Data: protocolo.LoginResponse{Status: "ONLINE_JA"},
+		}
+		sessao.Enviar(msg)
+		return
+	}
+
+	// Usuário existe e não está online -> loga
+	vincularSessao(sessao, player.Login)
+	player.Online = true
+	token := novoToken(player)
+
+	// Converte inventário do servidor para protocolo
+	invProto := inventarioProto(player)
+
+	// Resposta completa com status + inventário + moedas + recompensa do dia
+	diario := situacaoDiaria(player, time.Now())
+	msg := protocolo.Message{
+		Type: "LOGIN",
+		Data: protocolo.LoginResponse{
+			Status:     "LOGADO",
+			Inventario: invProto,
+			Saldo:      player.Moedas,
+			Token:      token,
+			Diario:     &diario,
+		},
+	}
+	sessao.Enviar(msg)
+}
+func cadastrarUser(sessao *Sessao, data protocolo.SignInRequest) {
+	// Gera o hash antes de pegar o lock
+	hash, err := hashSenha(data.Senha)
+	if err != nil {
+		sendScreenMsg(sessao, "Senha inválida (máximo de 72 caracteres).")
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, exists := players[data.Login]; exists {
+		sendScreenMsg(sessao, "Login já existe.")
+		return
+	}
+
+	novo := &User{
+		Login:      data.Login,
+		Senha:      hash,
+		Online:     false,
+		Inventario: Inventario{},
+	}
+	movimentarMoedas(novo, 50, protocolo.MotivoCadastro, "") // Player novo comeca com 50 moedas pra conseguir montar ao menos 1 deck
+
+	if err := registrarEvento(EventoContaCriada, nil, novo); err != nil {
+		fmt.Printf("Erro ao salvar o cadastro de %s: %v\n", data.Login, err)
+		sendScreenMsg(sessao, "Erro ao salvar o cadastro, tente novamente.")
+		return
+	}
+	players[data.Login] = novo
+
+	sendScreenMsg(sessao, "Cadastro realizado com sucesso!")
+}
+
+// FUNCOES DE SESSAO
+// novoToken gera o token da sessão (e invalida o anterior). Chamar com mu travado.
+func novoToken(player *User) string {
+	b := make([]byte, 16)
+	if _, err := crand.Read(b); err != nil {
+		panic(err) // sem fonte de aleatoriedade não dá pra gerar tokens seguros
+	}
+	token := hex.EncodeToString(b)
+
+	delete(tokens, player.Token)
+	player.Token = token
+	tokens[token] = player
+	return token
+}
+
+// resumeSession liga a sessão nova ao jogador dono do token. Como as salas
+// guardam o login e não a conexão, a partida continua sem mexer nela: só é
+// preciso reenviar o estado atual pra quem voltou.
+func resumeSession(sessao *Sessao, data protocolo.ResumeRequest) {
+	mu.Lock()
+	player, ok := tokens[data.Token]
+	if !ok {
+		mu.Unlock()
+		sessao.Enviar(protocolo.Message{Type: "RESUME", Data: protocolo.ResumeResponse{Status: "TOKEN_INVALIDO"}})
+		return
+	}
+
+	// A sessão antiga pode ainda não ter caído do lado do servidor
+	if antiga := sessaoDoJogador(player.Login); antiga != nil && antiga != sessao {
+		desvincularSessao(antiga)
+		antiga.Fechar()
+	}
+	vincularSessao(sessao, player.Login)
+	player.Online = true
+
+	// Entre as partidas de uma série (ou esperando revanche) a sala ainda
+	// guarda a partida que acabou
+	sala := playersInRoom[player.Login]
+	var partida *GameState
+	if sala != nil && sala.Status == "Em_Jogo" {
+		partida = sala.Game
+	}
+
+	resp := protocolo.ResumeResponse{
+		Status:     "RETOMADO",
+		Inventario: inventarioProto(player),
+		Saldo:      player.Moedas,
+		EmPartida:  partida != nil,
+	}
+	mu.Unlock()
+
+	fmt.Printf("Usuário %s retomou a sessão\n", player.Login)
+	sessao.Enviar(protocolo.Message{Type: "RESUME", Data: resp})
+
+	if partida == nil {
+		return
+	}
+
+	// Reenvia o estado da partida pra quem voltou
+	partida.GameMutex.Lock()
+	defer partida.GameMutex.Unlock()
+	if partida.Encerrada() {
+		return
+	}
+
+	lado := sala.lado(player.Login)
+	oponente := sala.jogador(game.Outro(lado))
+
+	// Voltou dentro da tolerância: não perde mais por abandono
+	if t, ok := partida.ausentes[player.Login]; ok {
+		t.Stop()
+		delete(partida.ausentes, player.Login)
+		enviarPara(oponente, protocolo.Message{Type: "SCREEN_MSG", Data: protocolo.ScreenMessage{Content: player.Login + " voltou para a partida."}})
+	}
+
+	sessao.Enviar(mensagemGameStart(sala, oponente))
+	if !partida.RoundAberto() {
+		sendScreenMsg(sessao, "Aguardando o próximo round...")
+	} else if partida.Jogou(lado) {
+		sendScreenMsg(sessao, "Sua jogada deste round já foi enviada. Aguardando oponente...")
+	} else {
+		sessao.Enviar(mensagemRoundStart(sala, lado))
+	}
+}
+
+// desconectar marca o jogador da conexão como offline. Se logout for falso
+// (a conexão só caiu), o token continua valendo pra um RESUME.
+func desconectar(sessao *Sessao, logout bool) {
+	mu.Lock()
+
+	// Se o jogador já voltou por outra sessão (RESUME), esta não manda mais nele
+	player := jogadorDaSessao(sessao)
+	if player == nil || sessaoDoJogador(player.Login) != sessao {
+		mu.Unlock()
+		return
+	}
+	desvincularSessao(sessao)
+	player.Online = false
+	if logout {
+		delete(tokens, player.Token)
+		player.Token = ""
+		fmt.Printf("Usuário %s saiu\n", player.Login)
+	} else {
+		fmt.Printf("Usuário %s deslogou automaticamente\n", player.Login)
+	}
+	cancelarTrocas(player.Login, player.Login+" desconectou")
+
+	// Quem estava esperando oponente sai da fila, quem esperava revanche
+	// desiste dela, e quem estava jogando ganha um tempo pra voltar
+	sala := playersInRoom[player.Login]
+	var partida *GameState
+	if sala != nil {
+		partida = sala.Game
+		if partida == nil && sala.Status == "Waiting_Player" {
+			removeSala(sala.ID)
+			delete(salas, sala.ID)
+			delete(playersInRoom, player.Login)
+		}
+		if sala.Status == "Revanche" {
+			encerrarRevanche(sala, protocolo.RevancheCancelada, player.Login+" desconectou.")
+			partida = nil
+		}
+	}
+	mu.Unlock()
+
+	if partida != nil {
+		aguardarRetorno(sala, partida, player.Login, logout)
+	}
+}
+
+// FUNCOES DE MENSAGENS
+func sendScreenMsg(sessao *Sessao, text string) {
+	msg := protocolo.Message{
+		Type: "SCREEN_MSG",
+		Data: protocolo.ScreenMessage{Content: text},
+	}
+	sessao.Enviar(msg)
+}
+func enviarErro(sessao *Sessao, codigo, text string) {
+	msg := protocolo.Message{
+		Type: "ERRO",
+		Data: protocolo.ErrorMessage{Codigo: codigo, Mensagem: text},
+	}
+	sessao.Enviar(msg)
+}
+func messageRouter(sessao *Sessao, msg protocolo.ChatMessage) {
+	mu.Lock()
+	defer mu.Unlock()
+	room, ok := playersInRoom[sessao.Login]
+	if !ok || room.Jogador2 == "" {
+		sendScreenMsg(sessao, "Aguardando oponente.")
+		return
+	}
+
+	jsonMsg := protocolo.Message{
+		Type: "CHAT",
+		Data: msg,
+	}
+	if sessao.Login == room.Jogador1 {
+		enviarPara(room.Jogador2, jsonMsg)
+	} else if sessao.Login == room.Jogador2 {
+		enviarPara(room.Jogador1, jsonMsg)
+	}
+}
+
+// FUNCOES AUXILIARES
+func mapToStruct(input interface{}, target interface{}) error {
+	bytes, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes, target)
+}
+func randomGenerate() string {
+	const charset = "ACDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	var seededRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	b := make([]byte, 6)
+	for {
+		for i := range b {
+			b[i] = charset[seededRand.Intn(len(charset))]
+		}
+		codigo := string(b)
+		if _, ok := salas[codigo]; !ok {
+			return codigo
+		}
+	}
+}
+
+// Converte o inventário do servidor para o tipo do protocolo
+func inventarioProto(player *User) protocolo.Inventario {
+	invProto := protocolo.Inventario{
+		Cartas: make([]protocolo.Carta, len(player.Inventario.Cartas)),
+	}
+	for i, c := range player.Inventario.Cartas {
+		invProto.Cartas[i] = cartaProto(c)
+	}
+	return invProto
+}
+
+func cartaProto(c Carta) protocolo.Carta {
+	p := protocolo.Carta{
+		Nome:        c.Nome,
+		Raridade:    c.Raridade,
+		Envergadura: c.Envergadura,
+		Velocidade:  c.Velocidade,
+		Altura:      c.Altura,
+		Passageiros: c.Passageiros,
+		ID:          c.ID,
+		Origem:      c.Origem,
+	}
+	if !c.Adquirida.IsZero() {
+		p.Adquirida = c.Adquirida.UnixMilli()
+	}
+	return p
+}
+
+// novaCopia cria a cópia de uma carta do catálogo que vai pro inventário de alguém.
+func novaCopia(c Carta, origem string) Carta {
+	c.ID = novoIDCarta()
+	c.Adquirida = time.Now()
+	c.Origem = origem
+	return c
+}
+
+func novoIDCarta() string {
+	b := make([]byte, 8)
+	if _, err := crand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// jogadorDaSessao devolve o jogador logado na sessão (nil antes do LOGIN).
+func jogadorDaSessao(sessao *Sessao) *User {
+	if sessao.Login == "" {
+		return nil
+	}
+	return players[sessao.Login]
+}
+
+// Funcao pra medir a latencia periodicamente usando um ping-pong
+func measureLatency(player *User) {
+	if player == nil || !player.Online {
+		return
+	}
+
+	// Timestamp em nanossegundos
+	ts := time.Now().UnixNano()
+
+	pingMsg := protocolo.Message{
+		Type: "PING",
+		Data: ts,
+	}
+
+	enviarPara(player.Login, pingMsg)
+}
+
+// FUNCOES PRO MENU DO PLAYER
+
+// CATALOGO
+// As cartas existentes ficam em data/cartas.json. O arquivo é validado
+// inteiro antes de ser usado (no início e no recarregar do console), e um
+// catálogo com qualquer problema nunca substitui o que está em uso.
+
+// Faixa aceita pra cada atributo de uma carta do catálogo
+var limitesAtributos = map[string][2]int{
+	"Envergadura": {1, 150},   // metros
+	"Velocidade":  {1, 10000}, // km/h
+	"Altura":      {1, 50000}, // teto, em metros
+	"Passageiros": {1, 2000},
+}
+
+// lerCatalogo decodifica o arquivo recusando campos desconhecidos (um
+// atributo com o nome errado viraria zero) e devolve as cartas junto com
+// os problemas encontrados por validarCatalogo.
+func lerCatalogo(caminho string) ([]Carta, []string, error) {
+	file, err := os.Open(caminho)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	var lidas []Carta
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&lidas); err != nil {
+		return nil, nil, fmt.Errorf("decodificando %s: %w", caminho, err)
+	}
+	return lidas, validarCatalogo(lidas), nil
+}
+
+// validarCatalogo lista todos os problemas do catálogo, não só o primeiro,
+// pra dar pra corrigir o arquivo de uma vez.
+func validarCatalogo(lidas []Carta) []string {
+	var problemas []string
+	if len(lidas) == 0 {
+		problemas = append(problemas, "o catálogo não tem nenhuma carta")
+	}
+
+	nomes := make(map[string]int)
+	for i, c := range lidas {
+		carta := fmt.Sprintf("carta %d (%q)", i+1, c.Nome)
+		if strings.TrimSpace(c.Nome) == "" || strings.TrimSpace(c.Nome) != c.Nome {
+			problemas = append(problemas, carta+": nome vazio ou com espaços nas pontas")
+		}
+		if anterior, ok := nomes[strings.ToLower(c.Nome)]; ok {
+			problemas = append(problemas, fmt.Sprintf("%s: mesmo nome da carta %d", carta, anterior))
+		} else {
+			nomes[strings.ToLower(c.Nome)] = i + 1
+		}
+		if loja.Nivel(c.Raridade) < 0 {
+			problemas = append(problemas, fmt.Sprintf("%s: raridade desconhecida %q", carta, c.Raridade))
+		}
+		for _, atributo := range game.Atributos {
+			valor, limite := game.Valor(cartaProto(c), atributo), limitesAtributos[atributo]
+			if valor < limite[0] || valor > limite[1] {
+				problemas = append(problemas, fmt.Sprintf("%s: %s = %d, fora da faixa de %d a %d", carta, atributo, valor, limite[0], limite[1]))
+			}
+		}
+		if c.ID != "" || !c.Adquirida.IsZero() || c.Origem != "" {
+			problemas = append(problemas, carta+": ID, Adquirida e Origem são só das cópias dos inventários")
+		}
+	}
+	return problemas
+}
+
+// agruparPorRaridade monta o índice usado no sorteio dos pacotes.
+func agruparPorRaridade(lidas []Carta) map[string][]Carta {
+	grupos := make(map[string][]Carta)
+	for _, c := range lidas {
+		grupos[c.Raridade] = append(grupos[c.Raridade], c)
+	}
+	return grupos
+}
+
+// resumoCatalogo descreve o catálogo pro log, ex: "20 cartas (Comum 7, Rara 7, Muito Rara 6)".
+func resumoCatalogo(lidas []Carta, grupos map[string][]Carta) string {
+	partes := make([]string, 0, len(loja.Raridades))
+	for _, raridade := range loja.Raridades {
+		partes = append(partes, fmt.Sprintf("%s %d", raridade, len(grupos[raridade])))
+	}
+	return fmt.Sprintf("%d cartas (%s)", len(lidas), strings.Join(partes, ", "))
+}
+
+// Funcao pra buscar o json com cartas existentes no jogo
+func carregarCartas() error {
+	lidas, problemas, err := lerCatalogo(cartasFile)
+	if err != nil {
+		return err
+	}
+	if len(problemas) > 0 {
+		for _, problema := range problemas {
+			fmt.Println("  " + problema)
+		}
+		return fmt.Errorf("%s tem %d problema(s)", cartasFile, len(problemas))
+	}
+
+	novo := make(map[string]Carta, len(lidas))
+	for _, c := range lidas {
+		novo[c.Nome] = c
+	}
+	if err := conferirTrunfos(novo); err != nil {
+		return err
+	}
+
+	cartas, catalogo = lidas, novo
+	porRaridade = agruparPorRaridade(cartas)
+
+	fmt.Printf("Catálogo carregado de %s: %s.\n", cartasFile, resumoCatalogo(cartas, porRaridade))
+	return nil
+}
+
+// recarregarCartas lê o catálogo de novo (comando recarregar do console).
+// Se estiver tudo certo, troca cartas, catalogo e porRaridade de uma vez,
+// com mu travado. Partidas em andamento não mudam: as mãos são cópias
+// feitas no início da partida; o deck de cada jogador pega os atributos
+// novos quando ele entrar na próxima sala.
+func recarregarCartas() error {
+	lidas, problemas, err := lerCatalogo(cartasFile)
+	if err != nil {
+		return err
+	}
+	if len(problemas) > 0 {
+		for _, problema := range problemas {
+			fmt.Println("  " + problema)
+		}
+		return fmt.Errorf("%s tem %d problema(s), o catálogo atual continua valendo", cartasFile, len(problemas))
+	}
+	grupos := agruparPorRaridade(lidas)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := conferirPacotes(pacotes, grupos); err != nil {
+		return fmt.Errorf("%v, o catálogo atual continua valendo", err)
+	}
+
+	novo := make(map[string]Carta, len(lidas))
+	novas, alteradas := 0, 0
+	for _, c := range lidas {
+		novo[c.Nome] = c
+		if antiga, ok := catalogo[c.Nome]; !ok {
+			novas++
+		} else if antiga != c {
+			alteradas++
+		}
+	}
+	removidas := 0
+	for nome := range catalogo {
+		if _, ok := novo[nome]; !ok {
+			removidas++
+		}
+	}
+	if err := conferirTrunfos(novo); err != nil {
+		return fmt.Errorf("%v, o catálogo atual continua valendo", err)
+	}
+
+	cartas, catalogo, porRaridade = lidas, novo, grupos
+	ajustarEstoque()
+	if err := gravarEstoque(); err != nil {
+		fmt.Printf("Erro ao salvar o estoque: %v\n", err)
+	}
+
+	// Cópias de cartas que saíram do catálogo continuam nos inventários, mas não entram em deck
+	orfas := 0
+	for _, player := range players {
+		for _, c := range player.Inventario.Cartas {
+			if _, ok := catalogo[c.Nome]; !ok {
+				orfas++
+			}
+		}
+	}
+
+	fmt.Printf("Catálogo recarregado: %s; %d novas, %d alteradas, %d removidas.\n", resumoCatalogo(cartas, porRaridade), novas, alteradas, removidas)
+	if orfas > 0 {
+		fmt.Printf("Atenção: %d cópias nos inventários são de cartas que não estão mais no catálogo.\n", orfas)
+	}
+	return nil
+}
+
+// conferirTrunfos confere se o Super Trunfo de cada modalidade clássica está
+// no catálogo e não é da raridade que ganha dele.
+func conferirTrunfos(novo map[string]Carta) error {
+	for nome, regras := range config.Regras.Modalidades {
+		if regras.SuperTrunfo == "" {
+			continue
+		}
+		c, ok := novo[regras.SuperTrunfo]
+		if !ok {
+			return fmt.Errorf("modalidade %s: o Super Trunfo %q não está no catálogo", nome, regras.SuperTrunfo)
+		}
+		if c.Raridade == regras.ContraTrunfo {
+			return fmt.Errorf("modalidade %s: o Super Trunfo é da raridade que ganha dele (%s)", nome, c.Raridade)
+		}
+	}
+	return nil
+}
+
+// Carrega os tipos de pacote. Tem que rodar depois de carregarCartas, pra
+// conferir se toda raridade que pode sair tem carta no catálogo.
+func carregarPacotes() error {
+	lidos, err := loja.Carregar(pacotesFile)
+	if err != nil {
+		return err
+	}
+	if err := conferirPacotes(lidos, porRaridade); err != nil {
+		return err
+	}
+
+	pacotes = lidos
+	sorteio = rand.New(rand.NewSource(time.Now().UnixNano()))
+	fmt.Printf("Foram carregados %d tipos de pacote.\n", len(pacotes))
+	return nil
+}
+
+// conferirPacotes vê se toda raridade que pode sair nos pacotes tem carta no catálogo.
+func conferirPacotes(lidos []loja.Pacote, grupos map[string][]Carta) error {
+	for _, p := range lidos {
+		for raridade, peso := range p.Pesos {
+			if peso > 0 && len(grupos[raridade]) == 0 {
+				return fmt.Errorf("pacote %s: nenhuma carta %s no catálogo", p.Tipo, raridade)
+			}
+		}
+	}
+	return nil
+}
+
+// Devolve o pacote do tipo pedido; tipo vazio é o primeiro da lista.
+func pacotePorTipo(tipo string) *loja.Pacote {
+	if tipo == "" {
+		return &pacotes[0]
+	}
+	for i := range pacotes {
+		if pacotes[i].Tipo == tipo {
+			return &pacotes[i]
+		}
+	}
+	return nil
+}
+
+// Abre o pacote pro jogador: desconta o preço, atualiza o pity e coloca as
+// cartas sorteadas no inventário, tirando-as do estoque. Chamar com mu
+// travado e depois de conferir o saldo e se o pacote não está esgotado.
+func abrirPacote(player *User, pacote *loja.Pacote) []Carta {
+	movimentarMoedas(player, -pacote.Preco, protocolo.MotivoPacote, pacote.Tipo)
+
+	if player.Pity == nil {
+		player.Pity = make(loja.Contadores)
+	}
+	var novas []Carta
+	for _, raridade := range pacote.Abrir(player.Pity, sorteio) {
+		novas = append(novas, novaCopia(retirarDoEstoque(raridade), protocolo.OrigemPacote))
+	}
+	player.Inventario.Cartas = append(player.Inventario.Cartas, novas...)
+	return novas
+}
+
+// Progresso do jogador no pity de cada raridade do pacote. Chamar com mu travado.
+func progressoPity(player *User, pacote loja.Pacote) []protocolo.Pity {
+	var progresso []protocolo.Pity
+	for _, raridade := range loja.Raridades {
+		limite, ok := pacote.Pity[raridade]
+		if !ok {
+			continue
+		}
+		progresso = append(progresso, protocolo.Pity{
+			Raridade: raridade,
+			Limite:   limite,
+			Faltam:   pacote.Faltam(player.Pity, raridade),
+		})
+	}
+	return progresso
+}
+
+// ESTOQUE
+// As cartas dos pacotes saem de um estoque global finito: cada carta do
+// catálogo tem um número de cópias, que volta a subir (até o máximo da
+// raridade) a cada reposição. O estoque fica em data/estoque.json e é
+// gravado a cada mudança, antes do evento da compra: se o servidor cair
+// entre os dois, some uma cópia do estoque, mas nunca aparece carta a mais.
+
+type Estoque struct {
+	Cartas          map[string]int `json:"cartas"`           // nome da carta -> cópias disponíveis
+	UltimaReposicao time.Time      `json:"ultima_reposicao"` // a próxima é um intervalo depois
+}
+
+// Carrega o estoque salvo (ou começa cheio) e aplica as reposições que
+// venceram com o servidor desligado. Tem que rodar depois de carregarCartas.
+func carregarEstoque() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	estoque = Estoque{Cartas: make(map[string]int), UltimaReposicao: time.Now()}
+	data, err := os.ReadFile(config.Estoque.Arquivo)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &estoque); err != nil {
+			return fmt.Errorf("decodificando %s: %w", config.Estoque.Arquivo, err)
+		}
+		if estoque.Cartas == nil {
+			estoque.Cartas = make(map[string]int)
+		}
+	}
+
+	ajustarEstoque()
+	if repostas := reporEstoque(time.Now()); repostas > 0 {
+		fmt.Printf("%d cópias repostas no estoque enquanto o servidor estava desligado.\n", repostas)
+	}
+	if err := gravarEstoque(); err != nil {
+		return err
+	}
+
+	total := 0
+	for _, n := range estoque.Cartas {
+		total += n
+	}
+	fmt.Printf("%d cópias no estoque de cartas.\n", total)
+	return nil
+}
+
+// ajustarEstoque acompanha o catálogo: carta nova entra com o estoque
+// cheio e a que saiu deixa de contar. Chamar com mu travado.
+func ajustarEstoque() {
+	for _, c := range cartas {
+		if _, ok := estoque.Cartas[c.Nome]; !ok {
+			estoque.Cartas[c.Nome] = config.Estoque.Maximo[c.Raridade]
+		}
+	}
+	for nome := range estoque.Cartas {
+		if _, ok := catalogo[nome]; !ok {
+			delete(estoque.Cartas, nome)
+		}
+	}
+}
+
+// gravarEstoque troca o arquivo do estoque de uma vez. Chamar com mu travado.
+func gravarEstoque() error {
+	data, err := json.MarshalIndent(estoque, "", "  ")
+	if err != nil {
+		return err
+	}
+	return persistencia.GravarArquivo(config.Estoque.Arquivo, data)
+}
+
+// reporEstoque aplica todas as reposições vencidas até agora e devolve
+// quantas cópias entraram. Carta acima do máximo (o máximo pode ter
+// diminuído na configuração) fica como está. Chamar com mu travado.
+func reporEstoque(agora time.Time) int {
+	if config.Estoque.IntervaloReposicao <= 0 {
+		return 0
+	}
+	intervalo := time.Duration(config.Estoque.IntervaloReposicao) * time.Second
+	vezes := int(agora.Sub(estoque.UltimaReposicao) / intervalo)
+	if vezes <= 0 {
+		return 0
+	}
+	estoque.UltimaReposicao = estoque.UltimaReposicao.Add(time.Duration(vezes) * intervalo)
+
+	repostas := 0
+	for _, c := range cartas {
+		atual, maximo := estoque.Cartas[c.Nome], config.Estoque.Maximo[c.Raridade]
+		novo := atual + vezes*config.Estoque.Reposicao[c.Raridade]
+		if novo > maximo {
+			novo = maximo
+		}
+		if novo > atual {
+			estoque.Cartas[c.Nome] = novo
+			repostas += novo - atual
+		}
+	}
+	return repostas
+}
+
+// proximaReposicao é quando vence a próxima reposição (zero se não há reposição).
+func proximaReposicao() time.Time {
+	if config.Estoque.IntervaloReposicao <= 0 {
+		return time.Time{}
+	}
+	return estoque.UltimaReposicao.Add(time.Duration(config.Estoque.IntervaloReposicao) * time.Second)
+}
+
+// Funcao que fica repondo o estoque no horário de cada reposição.
+func reposicaoPeriodica() {
+	for {
+		mu.Lock()
+		proxima := proximaReposicao()
+		mu.Unlock()
+		time.Sleep(time.Until(proxima))
+
+		mu.Lock()
+		repostas := reporEstoque(time.Now())
+		if repostas > 0 {
+			if err := gravarEstoque(); err != nil {
+				fmt.Printf("Erro ao salvar o estoque: %v\n", err)
+			}
+		}
+		mu.Unlock()
+		if repostas > 0 {
+			fmt.Printf("Estoque reposto: %d cópias.\n", repostas)
+		}
+	}
+}
+
+// estoqueDaRaridade soma as cópias de todas as cartas da raridade. Chamar com mu travado.
+func estoqueDaRaridade(raridade string) int {
+	total := 0
+	for _, c := range porRaridade[raridade] {
+		total += estoque.Cartas[c.Nome]
+	}
+	return total
+}
+
+// pacoteEsgotado diz se falta carta pra garantir o pacote: cada raridade
+// que pode sair nele precisa de pelo menos Tamanho cópias, assim as
+// chances anunciadas nunca mudam por causa do estoque. Chamar com mu travado.
+func pacoteEsgotado(p *loja.Pacote) bool {
+	for raridade, peso := range p.Pesos {
+		if peso > 0 && estoqueDaRaridade(raridade) < p.Tamanho {
+			return true
+		}
+	}
+	return false
+}
+
+// retirarDoEstoque sorteia uma carta da raridade com peso pelas cópias
+// disponíveis (como tirar de uma pilha) e a desconta do estoque. Chamar
+// com mu travado e só depois de pacoteEsgotado.
+func retirarDoEstoque(raridade string) Carta {
+	n := sorteio.Intn(estoqueDaRaridade(raridade))
+	for _, c := range porRaridade[raridade] {
+		if n < estoque.Cartas[c.Nome] {
+			estoque.Cartas[c.Nome]--
+			return c
+		}
+		n -= estoque.Cartas[c.Nome]
+	}
+	panic("estoque: sorteio fora das cópias") // pacoteEsgotado garante que não acontece
+}
+
+func handleStorageStatus(sessao *Sessao) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	resp := protocolo.StorageStatusResponse{}
+	for _, c := range cartas {
+		resp.Cartas = append(resp.Cartas, protocolo.EstoqueCarta{
+			Nome:       c.Nome,
+			Raridade:   c.Raridade,
+			Quantidade: estoque.Cartas[c.Nome],
+			Maximo:     config.Estoque.Maximo[c.Raridade],
+		})
+	}
+	for i := range pacotes {
+		resp.Pacotes = append(resp.Pacotes, protocolo.EstoquePacote{
+			Tipo:     pacotes[i].Tipo,
+			Esgotado: pacoteEsgotado(&pacotes[i]),
+		})
+	}
+	if proxima := proximaReposicao(); !proxima.IsZero() {
+		resp.ProximaReposicao = proxima.UnixMilli()
+	}
+
+	sessao.Enviar(protocolo.Message{
+		Type: "STORAGE_STATUS_RESPONSE",
+		Data: resp,
+	})
+}
+
+// EXTRATO DE MOEDAS
+// Toda mudança em User.Moedas passa por movimentarMoedas, que anota o
+// lançamento no extrato do próprio jogador. Como o extrato fica no perfil,
+// ele é gravado no mesmo evento do journal que o novo saldo. Pra o perfil
+// (e cada evento) não crescer com a idade da conta, só os últimos
+// max_lancamentos ficam guardados; o saldo de antes deles fica em
+// SaldoAnterior, que é de onde a auditoria começa a somar.
+
+// Lancamento é uma linha do extrato de moedas do jogador.
+type Lancamento struct {
+	Hora       time.Time
+	Motivo     string // protocolo.MotivoCadastro, MotivoPacote, MotivoPartida...
+	Valor      int    // positivo entra, negativo sai
+	Saldo      int    // saldo depois do lançamento
+	Referencia string `json:",omitempty"` // sala, tipo de pacote, troca ou anúncio
+}
+
+// movimentarMoedas soma valor ao saldo do jogador e anota no extrato.
+// Chamar com mu travado, antes do registrarEvento da operação.
+func movimentarMoedas(player *User, valor int, motivo, referencia string) {
+	if valor == 0 {
+		return
+	}
+	player.Moedas += valor
+	player.Extrato = append(player.Extrato, Lancamento{
+		Hora:       time.Now(),
+		Motivo:     motivo,
+		Valor:      valor,
+		Saldo:      player.Moedas,
+		Referencia: referencia,
+	})
+	aparaExtrato(player)
+}
+
+// aparaExtrato tira do extrato os lançamentos além do limite, guardando o
+// saldo de antes dos que ficaram. Devolve se tirou algum. Chamar com mu travado.
+func aparaExtrato(player *User) bool {
+	sobra := len(player.Extrato) - config.Extrato.MaxLancamentos
+	if sobra <= 0 {
+		return false
+	}
+	player.SaldoAnterior = player.Extrato[sobra-1].Saldo
+	player.Arquivados += sobra
+	player.Extrato = append([]Lancamento(nil), player.Extrato[sobra:]...)
+	return true
+}
+
+// migrarExtrato abre o extrato das contas de antes dele com um lançamento
+// de saldo inicial, pra que a auditoria feche também nelas, e apara os
+// extratos maiores que o limite configurado.
+func migrarExtrato() (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	migrados := make([]*User, 0)
+	for _, player := range players {
+		if len(player.Extrato) == 0 && player.Moedas != 0 {
+			player.Extrato = []Lancamento{{
+				Hora:   time.Now(),
+				Motivo: protocolo.MotivoSaldoInicial,
+				Valor:  player.Moedas,
+				Saldo:  player.Moedas,
+			}}
+			migrados = append(migrados, player)
+		} else if aparaExtrato(player) {
+			migrados = append(migrados, player)
+		}
+	}
+	return len(migrados), salvarJogadores(migrados...)
+}
+
+// auditarMoedas refaz o saldo de cada jogador somando o extrato (a partir
+// do SaldoAnterior) e devolve uma linha por divergência: um lançamento cujo
+// saldo não bate com a soma até ele, ou um saldo final diferente da soma do extrato.
+func auditarMoedas() (int, []string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	logins := make([]string, 0, len(players))
+	for login := range players {
+		logins = append(logins, login)
+	}
+	sort.Strings(logins)
+
+	var divergencias []string
+	for _, login := range logins {
+		player := players[login]
+		soma := player.SaldoAnterior
+		for i, l := range player.Extrato {
+			soma += l.Valor
+			if l.Saldo != soma {
+				divergencias = append(divergencias, fmt.Sprintf("%s: lançamento %d (%s %+d em %s) diz saldo %d, a soma dá %d",
+					login, player.Arquivados+i+1, l.Motivo, l.Valor, l.Hora.Format("02/01/2006 15:04:05"), l.Saldo, soma))
+				break
+			}
+		}
+		soma = player.SaldoAnterior
+		for _, l := range player.Extrato {
+			soma += l.Valor
+		}
+		if soma != player.Moedas {
+			divergencias = append(divergencias, fmt.Sprintf("%s: saldo %d, mas o extrato soma %d (diferença %+d)",
+				login, player.Moedas, soma, player.Moedas-soma))
+		}
+	}
+	return len(logins), divergencias
+}
+
+func handleCoinHistory(sessao *Sessao, data interface{}) {
+	var req protocolo.CoinHistoryRequest
+	_ = mapToStruct(data, &req)
+	if req.Limite <= 0 {
+		req.Limite = 20
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	player := jogadorDaSessao(sessao)
+	if player == nil {
+		sendScreenMsg(sessao, "Usuário não encontrado.")
+		return
+	}
+
+	resp := protocolo.CoinHistoryResponse{
+		Saldo:       player.Moedas,
+		Total:       player.Arquivados + len(player.Extrato),
+		Lancamentos: []protocolo.Lancamento{},
+	}
+	for i := len(player.Extrato) - 1; i >= 0 && len(resp.Lancamentos) < req.Limite; i-- {
+		l := player.Extrato[i]
+		resp.Lancamentos = append(resp.Lancamentos, protocolo.Lancamento{
+			Hora:       l.Hora.UnixMilli(),
+			Motivo:     l.Motivo,
+			Valor:      l.Valor,
+			Saldo:      l.Saldo,
+			Referencia: l.Referencia,
+		})
+	}
+
+	sessao.Enviar(protocolo.Message{
+		Type: "COIN_HISTORY_RESPONSE",
+		Data: resp,
+	})
+}
+
+// RECOMPENSA DIARIA
+// Uma vez por dia (no fuso do servidor) o jogador pode resgatar moedas com
+// CLAIM_DAILY. Resgatar em dias seguidos aumenta a sequência e o valor, que
+// vem da lista "recompensas" da configuração (depois do fim dela repete o último).
+
+// diasEntre conta quantas viradas de dia houve de a até b.
+func diasEntre(a, b time.Time) int {
+	a, b = a.Local(), b.Local()
+	da := time.Date(a.Year(), a.Month(), a.Day(), 12, 0, 0, 0, time.Local)
+	db := time.Date(b.Year(), b.Month(), b.Day(), 12, 0, 0, 0, time.Local)
+	return int(db.Sub(da).Round(24*time.Hour) / (24 * time.Hour))
+}
+
+// situacaoDiaria calcula o resgate do dia: se está disponível, em que dia
+// da sequência ele cai e quantas moedas vale. Chamar com mu travado.
+func situacaoDiaria(player *User, agora time.Time) protocolo.DailyInfo {
+	sequencia := 1
+	if !player.UltimoResgate.IsZero() {
+		// Se o relógio voltou pra antes do último resgate, conta como o mesmo dia
+		switch dias := diasEntre(player.UltimoResgate, agora); {
+		case dias <= 0:
+			return protocolo.DailyInfo{Disponivel: false, Sequencia: player.Sequencia}
+		case dias == 1:
+			sequencia = player.Sequencia + 1
+		}
+	}
+
+	recompensas := config.Diario.Recompensas
+	i := sequencia - 1
+	if i >= len(recompensas) {
+		i = len(recompensas) - 1
+	}
+	return protocolo.DailyInfo{Disponivel: true, Sequencia: sequencia, Recompensa: recompensas[i]}
+}
+
+func handleClaimDaily(sessao *Sessao) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	player := jogadorDaSessao(sessao)
+	if player == nil {
+		sendScreenMsg(sessao, "Usuário não encontrado.")
+		return
+	}
+
+	agora := time.Now()
+	diario := situacaoDiaria(player, agora)
+	resp := protocolo.ClaimDailyResponse{Status: "JA_RESGATADO", Sequencia: diario.Sequencia, Saldo: player.Moedas}
+	if diario.Disponivel {
+		copia := copiarJogadores(player)
+		player.UltimoResgate = agora
+		player.Sequencia = diario.Sequencia
+		movimentarMoedas(player, diario.Recompensa, protocolo.MotivoDiario, fmt.Sprintf("dia %d", diario.Sequencia))
+		if err := registrarEvento(EventoRecompensaDiaria, detalheDiario{Sequencia: diario.Sequencia, Moedas: diario.Recompensa}, player); err != nil {
+			fmt.Printf("Erro ao salvar a recompensa diária de %s: %v\n", player.Login, err)
+			copia.desfazer()
+			enviarErro(sessao, protocolo.ErroGravacao, "Erro ao salvar a recompensa diária, tente novamente.")
+			return
+		}
+		resp.Status = "RESGATADO"
+		resp.Recompensa = diario.Recompensa
+		resp.Saldo = player.Moedas
+	}
+
+	sessao.Enviar(protocolo.Message{
+		Type: "CLAIM_DAILY_RESPONSE",
+		Data: resp,
+	})
+}
+
+// TROCAS
+// Troca entre dois jogadores. O que cada lado oferece fica em custódia: as
+// cartas e moedas continuam no inventário (e no store) de quem ofereceu, mas
+// não podem entrar em outra troca nem ser gastas. Só quando os dois
+// confirmam é que mudam de dono, num único evento do journal com o estado
+// dos dois jogadores; se a conexão (ou o servidor) cair antes disso, cada um
+// continua com o que tinha.
+type Troca struct {
+	ID    string
+	Lados [2]*LadoTroca // [0] é quem abriu a troca
+}
+
+type LadoTroca struct {
+	Login      string
+	Cartas     []string // IDs das cartas em custódia
+	Moedas     int
+	Confirmado bool
+}
+
+// lado devolve o lado do jogador e o do outro (nil se ele não participa).
+func (t *Troca) lado(login string) (*LadoTroca, *LadoTroca) {
+	if t.Lados[0].Login == login {
+		return t.Lados[0], t.Lados[1]
+	}
+	if t.Lados[1].Login == login {
+		return t.Lados[1], t.Lados[0]
+	}
+	return nil, nil
+}
+
+// emCustodia junta as cartas e moedas do jogador presas em trocas abertas
+// (menos as do lado informado), em anúncios e em lances no mercado.
+// Chamar com mu travado.
+func emCustodia(login string, exceto *LadoTroca) (map[string]bool, int) {
+	cartas := make(map[string]bool)
+	moedas := 0
+	if player := players[login]; player != nil {
+		for _, a := range player.Anuncios {
+			cartas[a.CartaID] = true
+		}
+	}
+	for id, vendedor := range mercado {
+		if a := anuncioDe(vendedor, id); a != nil && a.Licitante == login {
+			moedas += a.Lance
+		}
+	}
+	for _, t := range trocas {
+		meu, _ := t.lado(login)
+		if meu == nil || meu == exceto {
+			continue
+		}
+		for _, id := range meu.Cartas {
+			cartas[id] = true
+		}
+		moedas += meu.Moedas
+	}
+	return cartas, moedas
+}
+
+// saldoLivre é o saldo que o jogador pode gastar (fora o que está em troca). Chamar com mu travado.
+func saldoLivre(player *User) int {
+	_, moedas := emCustodia(player.Login, nil)
+	return player.Moedas - moedas
+}
+
+func indiceCarta(player *User, id string) int {
+	for i, c := range player.Inventario.Cartas {
+		if c.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// cartasDoDeck marca as cópias que estão no deck do jogador. Elas não podem
+// sair do inventário (a mão da partida é sorteada do deck).
+func cartasDoDeck(player *User) map[string]bool {
+	noDeck := make(map[string]bool, len(player.Deck))
+	for _, c := range player.Deck {
+		noDeck[c.ID] = true
+	}
+	return noDeck
+}
+
+// conferirOferta vê se o jogador pode colocar as cartas e moedas no seu lado
+// da troca. Devolve o código de erro e a mensagem, ou "" se estiver tudo certo.
+// Chamar com mu travado.
+func conferirOferta(player *User, lado *LadoTroca, ids []string, moedas int) (string, string) {
+	presas, moedasPresas := emCustodia(player.Login, lado)
+	noDeck := cartasDoDeck(player)
+
+	usadas := make(map[string]bool)
+	for _, id := range ids {
+		if id == "" || indiceCarta(player, id) < 0 {
+			return protocolo.ErroTrocaCarta, fmt.Sprintf("A carta %s não está no seu inventário.", id)
+		}
+		if usadas[id] {
+			return protocolo.ErroTrocaCarta, fmt.Sprintf("A carta %s foi oferecida mais de uma vez.", id)
+		}
+		if presas[id] {
+			return protocolo.ErroTrocaCarta, fmt.Sprintf("A carta %s já está em outra troca ou à venda.", id)
+		}
+		if noDeck[id] {
+			return protocolo.ErroTrocaCarta, fmt.Sprintf("A carta %s está no seu deck.", id)
+		}
+		usadas[id] = true
+	}
+
+	if moedas < 0 {
+		return protocolo.ErroTrocaSaldo, "Quantidade de moedas inválida."
+	}
+	if moedas > player.Moedas-moedasPresas {
+		return protocolo.ErroTrocaSaldo, fmt.Sprintf("Você só tem %d moedas livres.", player.Moedas-moedasPresas)
+	}
+	return "", ""
+}
+
+// Monta a mensagem da troca. Chamar com mu travado (e antes de mover as cartas,
+// já que elas são procuradas no inventário de quem ofereceu).
+func trocaProto(t *Troca, status, motivo string) protocolo.TradeUpdate {
+	upd := protocolo.TradeUpdate{Troca: t.ID, Status: status, Motivo: motivo}
+	for _, lado := range t.Lados {
+		info := protocolo.LadoTroca{
+			Login:      lado.Login,
+			Cartas:     []protocolo.Carta{},
+			Moedas:     lado.Moedas,
+			Confirmado: lado.Confirmado,
+		}
+		if player := players[lado.Login]; player != nil {
+			for _, id := range lado.Cartas {
+				if i := indiceCarta(player, id); i >= 0 {
+					info.Cartas = append(info.Cartas, cartaProto(player.Inventario.Cartas[i]))
+				}
+			}
+		}
+		upd.Lados = append(upd.Lados, info)
+	}
+	return upd
+}
+
+func notificarTroca(t *Troca, upd protocolo.TradeUpdate) {
+	for _, lado := range t.Lados {
+		enviarPara(lado.Login, protocolo.Message{Type: "TRADE_UPDATE", Data: upd})
+	}
+}
+
+// cancelarTrocas desfaz as trocas abertas do jogador (ele saiu ou caiu).
+// Como nada saiu do inventário, basta esquecer a troca. Chamar com mu travado.
+func cancelarTrocas(login, motivo string) {
+	for id, t := range trocas {
+		if meu, _ := t.lado(login); meu == nil {
+			continue
+		}
+		delete(trocas, id)
+		notificarTroca(t, trocaProto(t, protocolo.TrocaCancelada, motivo))
+	}
+}
+
+// concluirTroca passa as cartas e moedas de cada lado para o outro e grava
+// os dois jogadores num único evento. Chamar com mu travado, com os dois
+// lados confirmados.
+func concluirTroca(t *Troca) {
+	upd := trocaProto(t, protocolo.TrocaConcluida, "")
+	delete(trocas, t.ID)
+
+	a, b := players[t.Lados[0].Login], players[t.Lados[1].Login]
+	copia := copiarJogadores(a, b)
+	agora := time.Now()
+	mover := func(de, para *User, lado *LadoTroca) {
+		for _, id := range lado.Cartas {
+			i := indiceCarta(de, id)
+			carta := de.Inventario.Cartas[i]
+			de.Inventario.Cartas = append(de.Inventario.Cartas[:i], de.Inventario.Cartas[i+1:]...)
+
+			// A cópia continua a mesma (mesmo ID), só muda de dono
+			carta.Adquirida = agora
+			carta.Origem = protocolo.OrigemTroca
+			para.Inventario.Cartas = append(para.Inventario.Cartas, carta)
+		}
+		movimentarMoedas(de, -lado.Moedas, protocolo.MotivoTroca, t.ID)
+		movimentarMoedas(para, lado.Moedas, protocolo.MotivoTroca, t.ID)
+	}
+	mover(a, b, t.Lados[0])
+	mover(b, a, t.Lados[1])
+
+	detalhe := detalheTroca{Troca: t.ID}
+	for _, lado := range t.Lados {
+		detalhe.Lados = append(detalhe.Lados, detalheLadoTroca{Login: lado.Login, Cartas: lado.Cartas, Moedas: lado.Moedas})
+	}
+	if err := registrarEvento(EventoTrocaConcluida, detalhe, a, b); err != nil {
+		fmt.Printf("Erro ao salvar a troca %s: %v\n", t.ID, err)
+		// Cada um fica com o que tinha, como numa troca cancelada
+		copia.desfazer()
+		notificarTroca(t, trocaProto(t, protocolo.TrocaCancelada, "erro ao salvar a troca, tente de novo"))
+		return
+	}
+	fmt.Printf("Troca %s concluída entre %s e %s\n", t.ID, a.Login, b.Login)
+
+	for _, player := range []*User{a, b} {
+		inv := inventarioProto(player)
+		upd.Inventario = &inv
+		enviarPara(player.Login, protocolo.Message{Type: "TRADE_UPDATE", Data: upd})
+	}
+}
+
+func handleTradeOffer(sessao *Sessao, data interface{}) {
+	var req protocolo.TradeOfferRequest
+	if err := mapToStruct(data, &req); err != nil {
+		enviarErro(sessao, protocolo.ErroMensagemInvalida, "Oferta de troca mal formada.")
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	player := jogadorDaSessao(sessao)
+	if player == nil {
+		sendScreenMsg(sessao, "Usuário não encontrado.")
+		return
+	}
+
+	var t *Troca
+	if req.Troca == "" {
+		outro := players[req.Para]
+		if outro == nil || !outro.Online || outro.Login == player.Login {
+			enviarErro(sessao, protocolo.ErroTrocaJogador, "Jogador "+req.Para+" não está disponível para troca.")
+			return
+		}
+		t = &Troca{
+			ID:    novoIDCarta(),
+			Lados: [2]*LadoTroca{{Login: player.Login}, {Login: outro.Login}},
+		}
+	} else {
+		t = trocas[req.Troca]
+		if t == nil {
+			enviarErro(sessao, protocolo.ErroTrocaInvalida, "Troca "+req.Troca+" não encontrada.")
+			return
+		}
+	}
+
+	meu, outro := t.lado(player.Login)
+	if meu == nil {
+		enviarErro(sessao, protocolo.ErroTrocaInvalida, "Você não participa da troca "+req.Troca+".")
+		return
+	}
+	if codigo, texto := conferirOferta(player, meu, req.Cartas, req.Moedas); codigo != "" {
+		enviarErro(sessao, codigo, texto)
+		return
+	}
+
+	// Mudou a oferta: os dois precisam confirmar de novo
+	meu.Cartas = append([]string(nil), req.Cartas...)
+	meu.Moedas = req.Moedas
+	meu.Confirmado = false
+	outro.Confirmado = false
+	trocas[t.ID] = t
+
+	notificarTroca(t, trocaProto(t, protocolo.TrocaAberta, ""))
+}
+
+func handleTradeAccept(sessao *Sessao, data interface{}) {
+	var req protocolo.TradeAcceptRequest
+	if err := mapToStruct(data, &req); err != nil {
+		enviarErro(sessao, protocolo.ErroMensagemInvalida, "Confirmação de troca mal formada.")
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	t := trocas[req.Troca]
+	var meu, outro *LadoTroca
+	if t != nil {
+		meu, outro = t.lado(sessao.Login)
+	}
+	if meu == nil {
+		enviarErro(sessao, protocolo.ErroTrocaInvalida, "Troca "+req.Troca+" não encontrada.")
+		return
+	}
+
+	meu.Confirmado = true
+	if !outro.Confirmado {
+		notificarTroca(t, trocaProto(t, protocolo.TrocaAberta, ""))
+		return
+	}
+
+	// A custódia já impede, mas confere de novo antes de mexer nos inventários
+	for _, lado := range t.Lados {
+		if codigo, texto := conferirOferta(players[lado.Login], lado, lado.Cartas, lado.Moedas); codigo != "" {
+			delete(trocas, t.ID)
+			notificarTroca(t, trocaProto(t, protocolo.TrocaCancelada, lado.Login+": "+texto))
+			return
+		}
+	}
+	concluirTroca(t)
+}
+
+func handleTradeCancel(sessao *Sessao, data interface{}) {
+	var req protocolo.TradeCancelRequest
+	if err := mapToStruct(data, &req); err != nil {
+		enviarErro(sessao, protocolo.ErroMensagemInvalida, "Cancelamento de troca mal formado.")
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	t := trocas[req.Troca]
+	if t == nil {
+		enviarErro(sessao, protocolo.ErroTrocaInvalida, "Troca "+req.Troca+" não encontrada.")
+		return
+	}
+	if meu, _ := t.lado(sessao.Login); meu == nil {
+		enviarErro(sessao, protocolo.ErroTrocaInvalida, "Troca "+req.Troca+" não encontrada.")
+		return
+	}
+
+	delete(trocas, t.ID)
+	notificarTroca(t, trocaProto(t, protocolo.TrocaCancelada, sessao.Login+" cancelou a troca"))
+}
+
+// MERCADO
+// Anúncio de uma carta no mercado. Fica salvo no perfil do vendedor, então
+// sobrevive a reinícios junto com o resto da conta. A carta continua no
+// inventário do vendedor (em custódia) e as moedas do maior lance continuam
+// com o licitante (também em custódia) até a venda, que passa as duas de
+// dono num único evento do journal.
+type Anuncio struct {
+	ID        string
+	CartaID   string
+	Tipo      string // protocolo.AnuncioVenda ou AnuncioLeilao
+	Preco     int    // preço da venda ou lance mínimo do leilão
+	Lance     int    `json:",omitempty"`
+	Licitante string `json:",omitempty"`
+	Criado    time.Time
+	Fim       time.Time `json:",omitempty"` // só leilão
+}
+
+// carregarMercado monta o índice dos anúncios a partir dos perfis. Chamar
+// depois de carregar os jogadores.
+func carregarMercado() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	mercado = make(map[string]*User)
+	for _, player := range players {
+		for _, a := range player.Anuncios {
+			mercado[a.ID] = player
+		}
+	}
+	fmt.Printf("%d anúncios abertos no mercado.\n", len(mercado))
+}
+
+// anuncioDe devolve o anúncio do vendedor pelo ID (nil se não existir).
+// O ponteiro só vale até a próxima mudança em vendedor.Anuncios.
+func anuncioDe(vendedor *User, id string) *Anuncio {
+	for i := range vendedor.Anuncios {
+		if vendedor.Anuncios[i].ID == id {
+			return &vendedor.Anuncios[i]
+		}
+	}
+	return nil
+}
+
+// Tira o anúncio do perfil e do índice. Chamar com mu travado.
+func removerAnuncio(vendedor *User, id string) {
+	for i := range vendedor.Anuncios {
+		if vendedor.Anuncios[i].ID == id {
+			vendedor.Anuncios = append(vendedor.Anuncios[:i], vendedor.Anuncios[i+1:]...)
+			break
+		}
+	}
+	delete(mercado, id)
+}
+
+// Procura o anúncio aberto pelo ID. Chamar com mu travado.
+func buscarAnuncio(id string) (*User, *Anuncio) {
+	vendedor := mercado[id]
+	if vendedor == nil {
+		return nil, nil
+	}
+	a := anuncioDe(vendedor, id)
+	if a == nil {
+		return nil, nil
+	}
+	return vendedor, a
+}
+
+func anuncioProto(vendedor *User, a *Anuncio) protocolo.AnuncioInfo {
+	info := protocolo.AnuncioInfo{
+		ID:        a.ID,
+		Vendedor:  vendedor.Login,
+		Tipo:      a.Tipo,
+		Preco:     a.Preco,
+		Lance:     a.Lance,
+		Licitante: a.Licitante,
+	}
+	if i := indiceCarta(vendedor, a.CartaID); i >= 0 {
+		info.Carta = cartaProto(vendedor.Inventario.Cartas[i])
+	}
+	if !a.Fim.IsZero() {
+		info.Fim = a.Fim.UnixMilli()
+	}
+	return info
+}
+
+// Avisa o jogador do que aconteceu com o anúncio. Chamar com mu travado.
+func avisarMercado(player *User, status string, info protocolo.AnuncioInfo, comInventario bool) {
+	upd := protocolo.MarketUpdate{Status: status, Anuncio: info, Saldo: player.Moedas}
+	if comInventario {
+		inv := inventarioProto(player)
+		upd.Inventario = &inv
+	}
+	enviarPara(player.Login, protocolo.Message{Type: "MARKET_UPDATE", Data: upd})
+}
+
+// anuncioConfere vê se o anúncio passa pelos filtros da busca.
+func anuncioConfere(info protocolo.AnuncioInfo, filtro protocolo.MarketBrowseRequest) bool {
+	if filtro.Raridade != "" && info.Carta.Raridade != filtro.Raridade {
+		return false
+	}
+	if filtro.Tipo != "" && info.Tipo != filtro.Tipo {
+		return false
+	}
+	if filtro.Nome != "" && !strings.Contains(strings.ToLower(info.Carta.Nome), strings.ToLower(filtro.Nome)) {
+		return false
+	}
+	for atributo, minimo := range filtro.Minimos {
+		if game.Valor(info.Carta, atributo) < minimo {
+			return false
+		}
+	}
+	return true
+}
+
+// concluirVenda passa a carta do vendedor pro comprador e o valor do
+// comprador pro vendedor, grava os dois num único evento e avisa ambos.
+// Chamar com mu travado e com o saldo do comprador já conferido. Se não
+// conseguir gravar, nada muda e o anúncio continua aberto.
+func concluirVenda(vendedor *User, a *Anuncio, comprador *User, valor int) error {
+	copia := copiarJogadores(vendedor, comprador)
+	info := anuncioProto(vendedor, a)
+	anuncio := *a
+	removerAnuncio(vendedor, anuncio.ID)
+
+	i := indiceCarta(vendedor, anuncio.CartaID)
+	carta := vendedor.Inventario.Cartas[i]
+	vendedor.Inventario.Cartas = append(vendedor.Inventario.Cartas[:i], vendedor.Inventario.Cartas[i+1:]...)
+	carta.Adquirida = time.Now()
+	carta.Origem = protocolo.OrigemMercado
+	comprador.Inventario.Cartas = append(comprador.Inventario.Cartas, carta)
+
+	movimentarMoedas(comprador, -valor, protocolo.MotivoCompraMercado, anuncio.ID)
+	movimentarMoedas(vendedor, valor, protocolo.MotivoVendaMercado, anuncio.ID)
+
+	detalhe := detalheVenda{Anuncio: anuncio.ID, CartaID: anuncio.CartaID, Tipo: anuncio.Tipo, Vendedor: vendedor.Login, Comprador: comprador.Login, Valor: valor}
+	if err := registrarEvento(EventoVendaMercado, detalhe, vendedor, comprador); err != nil {
+		fmt.Printf("Erro ao salvar a venda do anúncio %s: %v\n", anuncio.ID, err)
+		copia.desfazer()
+		mercado[anuncio.ID] = vendedor
+		return err
+	}
+	fmt.Printf("Anúncio %s vendido de %s para %s por %d moedas\n", anuncio.ID, vendedor.Login, comprador.Login, valor)
+
+	avisarMercado(vendedor, protocolo.MercadoVendido, info, true)
+	avisarMercado(comprador, protocolo.MercadoComprado, info, true)
+	return nil
+}
+
+// liquidarLeiloes encerra os leilões vencidos: vende pro maior lance ou,
+// sem lance, devolve a carta ao vendedor.
+func liquidarLeiloes() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Os IDs são copiados antes porque um anúncio que não deu pra gravar
+	// volta pro índice, e fica pra próxima liquidação
+	ids := make([]string, 0, len(mercado))
+	for id := range mercado {
+		ids = append(ids, id)
+	}
+
+	agora := time.Now()
+	for _, id := range ids {
+		vendedor, a := buscarAnuncio(id)
+		if a == nil || a.Tipo != protocolo.AnuncioLeilao || agora.Before(a.Fim) {
+			continue
+		}
+
+		// A custódia garante o saldo do licitante; se mesmo assim faltar, o leilão vence sem venda
+		if comprador := players[a.Licitante]; comprador != nil && comprador.Moedas >= a.Lance {
+			concluirVenda(vendedor, a, comprador, a.Lance)
+			continue
+		}
+
+		copia := copiarJogadores(vendedor)
+		info := anuncioProto(vendedor, a)
+		removerAnuncio(vendedor, id)
+		if err := registrarEvento(EventoAnuncioEncerrado, detalheAnuncio{Anuncio: id, CartaID: a.CartaID, Motivo: protocolo.MercadoExpirado}, vendedor); err != nil {
+			fmt.Printf("Erro ao salvar o fim do anúncio %s: %v\n", id, err)
+			copia.desfazer()
+			mercado[id] = vendedor
+			continue
+		}
+		avisarMercado(vendedor, protocolo.MercadoExpirado, info, false)
+	}
+}
+
+func liquidacaoPeriodica(intervalo time.Duration) {
+	for range time.Tick(intervalo) {
+		liquidarLeiloes()
+	}
+}
+
+func handleMarketList(sessao *Sessao, data interface{}) {
+	var req protocolo.MarketListRequest
+	if err := mapToStruct(data, &req); err != nil {
+		enviarErro(sessao, protocolo.ErroMensagemInvalida, "Anúncio mal formado.")
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	player := jogadorDaSessao(sessao)
+	if player == nil {
+		sendScreenMsg(sessao, "Usuário não encontrado.")
+		return
+	}
+
+	if req.Tipo != protocolo.AnuncioVenda && req.Tipo != protocolo.AnuncioLeilao {
+		enviarErro(sessao, protocolo.ErroMercadoValor, "Tipo de anúncio inválido: "+req.Tipo)
+		return
+	}
+	if req.Preco < 1 {
+		enviarErro(sessao, protocolo.ErroMercadoValor, "O preço precisa ser de pelo menos 1 moeda.")
+		return
+	}
+	if req.Tipo == protocolo.AnuncioLeilao && (req.Duracao < config.Mercado.DuracaoMinima || req.Duracao > config.Mercado.DuracaoMaxima) {
+		enviarErro(sessao, protocolo.ErroMercadoValor, fmt.Sprintf("O leilão precisa durar de %d a %d segundos.", config.Mercado.DuracaoMinima, config.Mercado.DuracaoMaxima))
+		return
+	}
+	if len(player.Anuncios) >= config.Mercado.MaxAnuncios {
+		enviarErro(sessao, protocolo.ErroMercadoValor, fmt.Sprintf("Você já tem %d anúncios abertos.", len(player.Anuncios)))
+		return
+	}
+	if indiceCarta(player, req.CartaID) < 0 {
+		enviarErro(sessao, protocolo.ErroMercadoCarta, fmt.Sprintf("A carta %s não está no seu inventário.", req.CartaID))
+		return
+	}
+	if presas, _ := emCustodia(player.Login, nil); presas[req.CartaID] {
+		enviarErro(sessao, protocolo.ErroMercadoCarta, fmt.Sprintf("A carta %s já está em uma troca ou à venda.", req.CartaID))
+		return
+	}
+	if cartasDoDeck(player)[req.CartaID] {
+		enviarErro(sessao, protocolo.ErroMercadoCarta, fmt.Sprintf("A carta %s está no seu deck.", req.CartaID))
+		return
+	}
+
+	a := Anuncio{
+		ID:      novoIDCarta(),
+		CartaID: req.CartaID,
+		Tipo:    req.Tipo,
+		Preco:   req.Preco,
+		Criado:  time.Now(),
+	}
+	if a.Tipo == protocolo.AnuncioLeilao {
+		a.Fim = a.Criado.Add(time.Duration(req.Duracao) * time.Second)
+	}
+	copia := copiarJogadores(player)
+	player.Anuncios = append(player.Anuncios, a)
+	mercado[a.ID] = player
+	if err := registrarEvento(EventoAnuncioCriado, detalheAnuncio{Anuncio: a.ID, CartaID: a.CartaID, Tipo: a.Tipo, Preco: a.Preco}, player); err != nil {
+		fmt.Printf("Erro ao salvar o anúncio de %s: %v\n", player.Login, err)
+		copia.desfazer()
+		delete(mercado, a.ID)
+		enviarErro(sessao, protocolo.ErroGravacao, "Erro ao salvar o anúncio, tente novamente.")
+		return
+	}
+
+	avisarMercado(player, protocolo.MercadoAnunciado, anuncioProto(player, &a), false)
+}
+
+func handleMarketBrowse(sessao *Sessao, data interface{}) {
+	var req protocolo.MarketBrowseRequest
+	if err := mapToStruct(data, &req); err != nil {
+		enviarErro(sessao, protocolo.ErroMensagemInvalida, "Busca mal formada.")
+		return
+	}
+	for atributo := range req.Minimos {
+		if !game.AtributoValido(atributo) {
+			enviarErro(sessao, protocolo.ErroAtributoInvalido, "Atributo inválido: "+atributo)
+			return
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var encontrados []*Anuncio
+	resp := protocolo.MarketBrowseResponse{Anuncios: []protocolo.AnuncioInfo{}}
+	for id, vendedor := range mercado {
+		a := anuncioDe(vendedor, id)
+		if a != nil && anuncioConfere(anuncioProto(vendedor, a), req) {
+			encontrados = append(encontrados, a)
+		}
+	}
+	// Mais antigos primeiro (o ID desempata)
+	sort.Slice(encontrados, func(i, j int) bool {
+		if !encontrados[i].Criado.Equal(encontrados[j].Criado) {
+			return encontrados[i].Criado.Before(encontrados[j].Criado)
+		}
+		return encontrados[i].ID < encontrados[j].ID
+	})
+	for _, a := range encontrados {
+		resp.Anuncios = append(resp.Anuncios, anuncioProto(mercado[a.ID], a))
+	}
+
+	sessao.Enviar(protocolo.Message{
+		Type: "MARKET_BROWSE_RESPONSE",
+		Data: resp,
+	})
+}
+
+func handleMarketBid(sessao *Sessao, data interface{}) {
+	var req protocolo.MarketBidRequest
+	if err := mapToStruct(data, &req); err != nil {
+		enviarErro(sessao, protocolo.ErroMensagemInvalida, "Lance mal formado.")
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	player := jogadorDaSessao(sessao)
+	if player == nil {
+		sendScreenMsg(sessao, "Usuário não encontrado.")
+		return
+	}
+
+	vendedor, a := buscarAnuncio(req.Anuncio)
+	if a == nil || a.Tipo != protocolo.AnuncioLeilao || !time.Now().Before(a.Fim) {
+		enviarErro(sessao, protocolo.ErroMercadoAnuncio, "Leilão "+req.Anuncio+" não encontrado ou já encerrado.")
+		return
+	}
+	if vendedor == player {
+		enviarErro(sessao, protocolo.ErroMercadoAnuncio, "Você não pode dar lance no seu próprio leilão.")
+		return
+	}
+	minimo := a.Preco
+	if a.Licitante != "" {
+		minimo = a.Lance + 1
+	}
+	if req.Valor < minimo {
+		enviarErro(sessao, protocolo.ErroMercadoValor, fmt.Sprintf("O lance precisa ser de pelo menos %d moedas.", minimo))
+		return
+	}
+
+	// O lance anterior do próprio jogador neste leilão é liberado pelo novo
+	livre := saldoLivre(player)
+	if a.Licitante == player.Login {
+		livre += a.Lance
+	}
+	if req.Valor > livre {
+		enviarErro(sessao, protocolo.ErroMercadoSaldo, fmt.Sprintf("Você só tem %d moedas livres.", livre))
+		return
+	}
+
+	anterior := players[a.Licitante]
+	copia := copiarJogadores(vendedor)
+	a.Lance = req.Valor
+	a.Licitante = player.Login
+	if err := registrarEvento(EventoLance, detalheAnuncio{Anuncio: a.ID, CartaID: a.CartaID, Licitante: player.Login, Valor: req.Valor}, vendedor); err != nil {
+		fmt.Printf("Erro ao salvar o lance de %s: %v\n", player.Login, err)
+		copia.desfazer()
+		enviarErro(sessao, protocolo.ErroGravacao, "Erro ao salvar o lance, tente novamente.")
+		return
+	}
+
+	info := anuncioProto(vendedor, a)
+	avisarMercado(player, protocolo.MercadoLance, info, false)
+	avisarMercado(vendedor, protocolo.MercadoLance, info, false)
+	if anterior != nil && anterior != player {
+		avisarMercado(anterior, protocolo.MercadoSuperado, info, false)
+	}
+}
+
+func handleMarketBuy(sessao *Sessao, data interface{}) {
+	var req protocolo.MarketBuyRequest
+	if err := mapToStruct(data, &req); err != nil {
+		enviarErro(sessao, protocolo.ErroMensagemInvalida, "Compra mal formada.")
+		return
+	}
+
 	mu.Lock()
 	defer mu.Unlock()
 
-	player, exists := players[data.Login]
-
-	if !exists {
-		// Usuário não existe
-		msg := protocolo.Message{
-			Type: "LOGIN",
-			Data: protocolo.LoginResponse{Status: "N_EXIST"},
-		}
-		sendJSON(conn, msg)
+	player := jogadorDaSessao(sessao)
+	if player == nil {
+		sendScreenMsg(sessao, "Usuário não encontrado.")
 		return
 	}
 
-	if player.Online {
-		// Usuário já está logado em outro lugar
-		msg := protocolo.Message{
-			Type: "LOGIN",
-			Data: protocolo.LoginResponse{Status: "ONLINE_JA"},
-		}
-		sendJSON(conn, msg)
+	vendedor, a := buscarAnuncio(req.Anuncio)
+	if a == nil || a.Tipo != protocolo.AnuncioVenda {
+		enviarErro(sessao, protocolo.ErroMercadoAnuncio, "Anúncio "+req.Anuncio+" não encontrado.")
 		return
 	}
-
-	// Usuário existe e não está online -> loga
-	player.Conn = conn
-	player.Online = true
-
-	// Converte inventário do servidor para protocolo
-	// #################################################
-	invProto := protocolo.Inventario{
-		Cartas: make([]protocolo.Carta, len(player.Inventario.Cartas)),
+	if vendedor == player {
+		enviarErro(sessao, protocolo.ErroMercadoAnuncio, "Você não pode comprar a sua própria carta.")
+		return
 	}
-	for i, c := range player.Inventario.Cartas {
-		invProto.Cartas[i] = protocolo.Carta{
-			Nome:        c.Nome,
-			Raridade:    c.Raridade,
-			Envergadura: c.Envergadura,
-			Velocidade:  c.Velocidade,
-			Altura:      c.Altura,
-			Passageiros: c.Passageiros,
-		}
+	if livre := saldoLivre(player); livre < a.Preco {
+		enviarErro(sessao, protocolo.ErroMercadoSaldo, fmt.Sprintf("Você só tem %d moedas livres.", livre))
+		return
 	}
-	// #################################################
 
-	// Resposta completa com status + inventário + moedas
-	msg := protocolo.Message{
-		Type: "LOGIN",
-		Data: protocolo.LoginResponse{
-			Status:     "LOGADO",
-			Inventario: invProto,
-			Saldo:      player.Moedas,
-		},
+	if err := concluirVenda(vendedor, a, player, a.Preco); err != nil {
+		enviarErro(sessao, protocolo.ErroGravacao, "Erro ao salvar a compra, tente novamente.")
 	}
-	sendJSON(conn, msg)
 }
-func cadastrarUser(conn net.Conn, data protocolo.SignInRequest) {
+
+func handleMarketCancel(sessao *Sessao, data interface{}) {
+	var req protocolo.MarketCancelRequest
+	if err := mapToStruct(data, &req); err != nil {
+		enviarErro(sessao, protocolo.ErroMensagemInvalida, "Cancelamento mal formado.")
+		return
+	}
+
 	mu.Lock()
 	defer mu.Unlock()
 
-	if _, exists := players[data.Login]; exists {
-		sendScreenMsg(conn, "Login já existe.")
+	player := jogadorDaSessao(sessao)
+	if player == nil {
+		sendScreenMsg(sessao, "Usuário não encontrado.")
 		return
 	}
 
-	players[data.Login] = &User{
-		Login:      data.Login,
-		Senha:      data.Senha,
-		Online:     false,
-		Conn:       nil,
-		Inventario: Inventario{},
-		Moedas:     50, // Player novo comeca com 50 moedas pra conseguir montar ao menos 1 deck
+	vendedor, a := buscarAnuncio(req.Anuncio)
+	if a == nil || vendedor != player {
+		enviarErro(sessao, protocolo.ErroMercadoAnuncio, "Anúncio "+req.Anuncio+" não encontrado.")
+		return
+	}
+	if a.Licitante != "" {
+		enviarErro(sessao, protocolo.ErroMercadoAnuncio, "O leilão já tem lance e não pode mais ser cancelado.")
+		return
 	}
 
-	sendScreenMsg(conn, "Cadastro realizado com sucesso!")
+	copia := copiarJogadores(player)
+	info := anuncioProto(player, a)
+	removerAnuncio(player, a.ID)
+	if err := registrarEvento(EventoAnuncioEncerrado, detalheAnuncio{Anuncio: info.ID, CartaID: info.Carta.ID, Motivo: protocolo.MercadoCancelado}, player); err != nil {
+		fmt.Printf("Erro ao salvar o cancelamento do anúncio %s: %v\n", info.ID, err)
+		copia.desfazer()
+		mercado[info.ID] = player
+		enviarErro(sessao, protocolo.ErroGravacao, "Erro ao salvar o cancelamento, tente novamente.")
+		return
+	}
+	avisarMercado(player, protocolo.MercadoCancelado, info, false)
 }
 
-// FUNCOES DE MENSAGENS
-func sendScreenMsg(conn net.Conn, text string) {
-	msg := protocolo.Message{
-		Type: "SCREEN_MSG",
-		Data: protocolo.ScreenMessage{Content: text},
+// OFICINA
+// Cartas repetidas podem ser desmontadas em fragmentos, e os fragmentos
+// usados pra criar qualquer carta do catálogo. Os valores de cada raridade
+// ficam na seção "oficina" da configuração.
+
+func handleDismantle(sessao *Sessao, data interface{}) {
+	var req protocolo.DismantleRequest
+	if err := mapToStruct(data, &req); err != nil || len(req.Cartas) == 0 {
+		enviarErro(sessao, protocolo.ErroMensagemInvalida, "Escolha pelo menos uma carta para desmontar.")
+		return
 	}
-	sendJSON(conn, msg)
-}
-func messageRouter(conn net.Conn, msg protocolo.ChatMessage) {
+
 	mu.Lock()
 	defer mu.Unlock()
-	room, ok := playersInRoom[conn.RemoteAddr().String()]
-	if !ok || room.Jogador2 == nil {
-		sendScreenMsg(conn, "Aguardando oponente.")
+
+	player := jogadorDaSessao(sessao)
+	if player == nil {
+		sendScreenMsg(sessao, "Usuário não encontrado.")
 		return
 	}
 
-	jsonMsg := protocolo.Message{
-		Type: "CHAT",
-		Data: msg,
-	}
-	if conn == room.Jogador1 {
-		sendJSON(room.Jogador2, jsonMsg)
-	} else if conn == room.Jogador2 {
-		sendJSON(room.Jogador1, jsonMsg)
-	}
-}
+	presas, _ := emCustodia(player.Login, nil)
+	noDeck := cartasDoDeck(player)
 
-// FUNCOES AUXILIARES
-func sendJSON(conn net.Conn, msg protocolo.Message) {
-	jsonData, _ := json.Marshal(msg)
-	conn.Write(jsonData)
-	conn.Write([]byte("\n"))
-}
-func mapToStruct(input interface{}, target interface{}) error {
-	bytes, err := json.Marshal(input)
-	if err != nil {
-		return err
-	}
-	return json.Unmarshal(bytes, target)
-}
-func randomGenerate() string {
-	const charset = "ACDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	var seededRand = rand.New(rand.NewSource(time.Now().UnixNano()))
-	b := make([]byte, 6)
-	for {
-		for i := range b {
-			b[i] = charset[seededRand.Intn(len(charset))]
+	// Confere tudo antes de mexer no inventário: ou desmonta todas, ou nenhuma
+	escolhidas := make(map[string]bool)
+	ganho := 0
+	for _, id := range req.Cartas {
+		i := indiceCarta(player, id)
+		if id == "" || i < 0 {
+			enviarErro(sessao, protocolo.ErroOficinaCarta, fmt.Sprintf("A carta %s não está no seu inventário.", id))
+			return
 		}
-		codigo := string(b)
-		if _, ok := salas[codigo]; !ok {
-			return codigo
+		carta := player.Inventario.Cartas[i]
+		switch {
+		case escolhidas[id]:
+			enviarErro(sessao, protocolo.ErroOficinaCarta, fmt.Sprintf("A carta %s foi escolhida mais de uma vez.", id))
+			return
+		case presas[id]:
+			enviarErro(sessao, protocolo.ErroOficinaCarta, fmt.Sprintf("%s (%s) está em uma troca ou à venda.", carta.Nome, id))
+			return
+		case noDeck[id]:
+			enviarErro(sessao, protocolo.ErroOficinaCarta, fmt.Sprintf("%s (%s) está no seu deck.", carta.Nome, id))
+			return
+		}
+		valor, ok := config.Oficina.Desmontar[carta.Raridade]
+		if !ok {
+			enviarErro(sessao, protocolo.ErroOficinaCarta, "Cartas "+carta.Raridade+" não podem ser desmontadas.")
+			return
 		}
+		escolhidas[id] = true
+		ganho += valor
 	}
-}
-func findPlayerByConn(conn net.Conn) *User {
-	for _, player := range players {
-		if player.Conn == conn {
-			return player
+
+	copia := copiarJogadores(player)
+	resp := protocolo.OficinaResponse{}
+	restantes := player.Inventario.Cartas[:0]
+	for _, c := range player.Inventario.Cartas {
+		if escolhidas[c.ID] {
+			resp.Cartas = append(resp.Cartas, cartaProto(c))
+			continue
 		}
+		restantes = append(restantes, c)
 	}
-	return nil
-}
+	player.Inventario.Cartas = restantes
+	player.Fragmentos += ganho
 
-// Funcao pra medir a latencia periodicamente usando um ping-pong
-func measureLatency(player *User) {
-	if player == nil || player.Conn == nil {
+	if err := registrarEvento(EventoCartasDesmontadas, detalheOficina{Cartas: req.Cartas, Fragmentos: ganho}, player); err != nil {
+		fmt.Printf("Erro ao salvar as cartas desmontadas por %s: %v\n", player.Login, err)
+		copia.desfazer()
+		enviarErro(sessao, protocolo.ErroGravacao, "Erro ao salvar a desmontagem, tente novamente.")
 		return
 	}
 
-	// Timestamp em nanossegundos
-	ts := time.Now().UnixNano()
+	resp.Fragmentos = player.Fragmentos
+	resp.Inventario = inventarioProto(player)
+	sessao.Enviar(protocolo.Message{
+		Type: "DISMANTLE_RESPONSE",
+		Data: resp,
+	})
+}
 
-	pingMsg := protocolo.Message{
-		Type: "PING",
-		Data: ts,
+func handleCraft(sessao *Sessao, data interface{}) {
+	var req protocolo.CraftRequest
+	if err := mapToStruct(data, &req); err != nil {
+		enviarErro(sessao, protocolo.ErroMensagemInvalida, "Pedido de criação mal formado.")
+		return
 	}
 
-	sendJSON(player.Conn, pingMsg)
-}
-
-// FUNCOES PRO MENU DO PLAYER
+	mu.Lock()
+	defer mu.Unlock()
 
-// Funcao pra buscar o json com cartas existentes no jogo
-func carregarCartas() error {
-	path := filepath.Join("data", "cartas.json")
-	file, err := os.Open(path)
-	if err != nil {
-		return err
+	player := jogadorDaSessao(sessao)
+	if player == nil {
+		sendScreenMsg(sessao, "Usuário não encontrado.")
+		return
 	}
-	defer file.Close()
 
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&cartas); err != nil {
-		return err
+	modelo, ok := catalogo[req.Nome]
+	if !ok {
+		enviarErro(sessao, protocolo.ErroOficinaCarta, "A carta "+req.Nome+" não existe no catálogo.")
+		return
 	}
-
-	fmt.Printf("Foram carregadas %d cartas do arquivo JSON.\n", len(cartas))
-	return nil
-}
-
-// Funcao pra adicionar cartas aleatórias na fila "storage".
-func fillCardStorage() {
-	if len(cartas) == 0 {
-		fmt.Println("Nenhuma carta cadastrada para preencher o storage.")
+	custo, ok := config.Oficina.Criar[modelo.Raridade]
+	if !ok {
+		enviarErro(sessao, protocolo.ErroOficinaCarta, "Cartas "+modelo.Raridade+" não podem ser criadas.")
+		return
+	}
+	if player.Fragmentos < custo {
+		enviarErro(sessao, protocolo.ErroOficinaSaldo, fmt.Sprintf("Criar %s custa %d fragmentos e você tem %d.", modelo.Nome, custo, player.Fragmentos))
 		return
 	}
 
-	idx := rand.Intn(len(cartas))
-	cartaEscolhida := cartas[idx]
+	copia := copiarJogadores(player)
+	carta := novaCopia(modelo, protocolo.OrigemCriacao)
+	player.Inventario.Cartas = append(player.Inventario.Cartas, carta)
+	player.Fragmentos -= custo
 
-	// Adiciona carta normalmente ao final da fila
-	storage = append(storage, cartaEscolhida)
+	if err := registrarEvento(EventoCartaCriada, detalheOficina{Cartas: []string{carta.ID}, Fragmentos: -custo}, player); err != nil {
+		fmt.Printf("Erro ao salvar a carta criada por %s: %v\n", player.Login, err)
+		copia.desfazer()
+		enviarErro(sessao, protocolo.ErroGravacao, "Erro ao salvar a carta criada, tente novamente.")
+		return
+	}
 
-	//fmt.Println("Carta do topo é: "+ storage[0].Nome) //Print de debug
+	sessao.Enviar(protocolo.Message{
+		Type: "CRAFT_RESPONSE",
+		Data: protocolo.OficinaResponse{
+			Cartas:     []protocolo.Carta{cartaProto(carta)},
+			Fragmentos: player.Fragmentos,
+			Inventario: inventarioProto(player),
+		},
+	})
 }
-func buyCard(player *User) *Carta {
-	carta := storage[0]   // pega a primeira carta
-	storage = storage[1:] // remove da fila
 
-	fillCardStorage() // adiciona uma nova carta no storage
-
-	player.Moedas -= 10 // desconta o valor da compra
-	return &carta
+// modalidadeEscolhida devolve o nome e as regras pedidas (vazio = a
+// modalidade padrão). Se não existir, avisa o jogador e devolve ok falso.
+func modalidadeEscolhida(sessao *Sessao, nome string) (string, game.MatchRules, bool) {
+	if nome == "" {
+		nome = config.Regras.Padrao
+	}
+	regras, ok := config.Regras.Modalidades[nome]
+	if !ok {
+		nomes := make([]string, 0, len(config.Regras.Modalidades))
+		for n := range config.Regras.Modalidades {
+			nomes = append(nomes, n)
+		}
+		sort.Strings(nomes)
+		enviarErro(sessao, protocolo.ErroRegrasInvalidas, fmt.Sprintf("Modalidade %q não existe. Modalidades: %s.", nome, strings.Join(nomes, ", ")))
+	}
+	return nome, regras, ok
 }
-func findRoom(conn net.Conn, mode string, roomCode string) {
+
+func findRoom(sessao *Sessao, mode string, roomCode string, modalidade string) {
 	mu.Lock()
 	defer mu.Unlock()
+	if !deixarSalaAnterior(sessao) {
+		return
+	}
 
 	if mode == "PUBLIC" {
-		if len(salasEmEspera) > 0 {
-			// Pega a primeira da fila e tira ela.
-			sala := salasEmEspera[0]
-			salasEmEspera = salasEmEspera[1:]
+		nome, regras, ok := modalidadeEscolhida(sessao, modalidade)
+		if !ok || !deckPronto(sessao, regras) {
+			return
+		}
+
+		// Pega a primeira da fila na mesma modalidade (o removeSala tira ela da fila)
+		var sala *Sala
+		for _, s := range salasEmEspera {
+			if s.Modalidade == nome {
+				sala = s
+				break
+			}
+		}
 
-			sala.Jogador2 = conn
+		if sala != nil {
+			sala.Jogador2 = sessao.Login
 			sala.Status = "Em_Jogo"
 
 			// Caminho duplo para chat (Sem uso no momento)
-			playersInRoom[sala.Jogador1.RemoteAddr().String()] = sala
-			playersInRoom[sala.Jogador2.RemoteAddr().String()] = sala
+			playersInRoom[sala.Jogador1] = sala
+			playersInRoom[sala.Jogador2] = sala
 
 			sendPairing(sala.Jogador1)
 			sendPairing(sala.Jogador2)
@@ -366,25 +2986,34 @@ func findRoom(conn net.Conn, mode string, roomCode string) {
 		} else {
 			codigo := randomGenerate()
 			novaSala := &Sala{
-				Jogador1:  conn,
-				ID:        codigo,
-				Status:    "Waiting_Player",
-				IsPrivate: false,
+				Jogador1:   sessao.Login,
+				ID:         codigo,
+				Status:     "Waiting_Player",
+				IsPrivate:  false,
+				Modalidade: nome,
+				Regras:     regras,
 			}
 			salas[codigo] = novaSala
 			salasEmEspera = append(salasEmEspera, novaSala)
-			playersInRoom[conn.RemoteAddr().String()] = novaSala
+			playersInRoom[sessao.Login] = novaSala
 		}
 	} else if roomCode != "" {
 		sala, ok := salas[roomCode]
 		if !ok {
-			sendScreenMsg(conn, "Código inválido.")
+			sendScreenMsg(sessao, "Código inválido.")
 			return
 		}
-		sala.Jogador2 = conn
+		if sala.Status != "Waiting_Player" {
+			sendScreenMsg(sessao, "Essa sala já está cheia.")
+			return
+		}
+		if !deckPronto(sessao, sala.Regras) {
+			return
+		}
+		sala.Jogador2 = sessao.Login
 		sala.Status = "Em_Jogo"
-		playersInRoom[sala.Jogador1.RemoteAddr().String()] = sala
-		playersInRoom[sala.Jogador2.RemoteAddr().String()] = sala
+		playersInRoom[sala.Jogador1] = sala
+		playersInRoom[sala.Jogador2] = sala
 
 		// Pareado
 		sendPairing(sala.Jogador1)
@@ -393,23 +3022,148 @@ func findRoom(conn net.Conn, mode string, roomCode string) {
 		// Inicia o Jogo
 		go startGame(sala)
 	} else {
-		sendScreenMsg(conn, "Opção inválida.")
+		sendScreenMsg(sessao, "Opção inválida.")
 	}
 }
-func createRoom(conn net.Conn) {
+func createRoom(sessao *Sessao, modalidade string, partidas int) {
 	mu.Lock()
 	defer mu.Unlock()
+	if !deixarSalaAnterior(sessao) {
+		return
+	}
+	if partidas == 0 {
+		partidas = 1
+	}
+	serie, err := game.NovaSerie(partidas)
+	if err != nil {
+		enviarErro(sessao, protocolo.ErroSerieInvalida, "Não dá pra criar a sala: "+err.Error()+".")
+		return
+	}
+	nome, regras, ok := modalidadeEscolhida(sessao, modalidade)
+	if !ok || !deckPronto(sessao, regras) {
+		return
+	}
 	codigo := randomGenerate()
 	novaSala := &Sala{
-		Jogador1:  conn,
-		ID:        codigo,
-		Status:    "Waiting_Player",
-		IsPrivate: true,
+		Jogador1:   sessao.Login,
+		ID:         codigo,
+		Status:     "Waiting_Player",
+		IsPrivate:  true,
+		Modalidade: nome,
+		Regras:     regras,
+		Serie:      serie,
 	}
 	salas[codigo] = novaSala
-	playersInRoom[conn.RemoteAddr().String()] = novaSala
-	sendScreenMsg(conn, "Código da sala: "+codigo)
+	playersInRoom[sessao.Login] = novaSala
+	if partidas > 1 {
+		nome = fmt.Sprintf("%s, melhor de %d", nome, partidas)
+	}
+	sendScreenMsg(sessao, "Código da sala: "+codigo+" (modalidade "+nome+")")
+}
+
+// tamanhosDeck lista, em ordem, os tamanhos de deck usados pelas modalidades.
+func tamanhosDeck() []int {
+	var tamanhos []int
+	vistos := make(map[int]bool)
+	for _, regras := range config.Regras.Modalidades {
+		if !vistos[regras.TamanhoDeck] {
+			vistos[regras.TamanhoDeck] = true
+			tamanhos = append(tamanhos, regras.TamanhoDeck)
+		}
+	}
+	sort.Ints(tamanhos)
+	return tamanhos
+}
+
+// montarDeck confere se as cópias pedidas (pelos IDs) estão no inventário
+// do jogador, cada uma usada uma vez só, e devolve o deck com os atributos
+// do catálogo. O deck precisa ter o tamanho de alguma modalidade. Chamar
+// com mu travado.
+func montarDeck(player *User, ids []string) ([]protocolo.Carta, error) {
+	tamanhos := tamanhosDeck()
+	valido := false
+	textos := make([]string, len(tamanhos))
+	for i, n := range tamanhos {
+		valido = valido || n == len(ids)
+		textos[i] = strconv.Itoa(n)
+	}
+	if !valido {
+		return nil, fmt.Errorf("o deck precisa ter um destes tamanhos: %s", strings.Join(textos, ", "))
+	}
+
+	possui := make(map[string]Carta, len(player.Inventario.Cartas))
+	for _, c := range player.Inventario.Cartas {
+		possui[c.ID] = c
+	}
+
+	usadas := make(map[string]bool)
+	deck := make([]protocolo.Carta, 0, len(ids))
+	for _, id := range ids {
+		copia, ok := possui[id]
+		if !ok || id == "" {
+			return nil, fmt.Errorf("a carta %s não está no seu inventário", id)
+		}
+		if usadas[id] {
+			return nil, fmt.Errorf("a carta %s (%s) foi escolhida mais de uma vez", copia.Nome, id)
+		}
+		usadas[id] = true
+
+		carta, ok := catalogo[copia.Nome]
+		if !ok {
+			return nil, fmt.Errorf("a carta %s não existe no catálogo", copia.Nome)
+		}
+		carta.ID, carta.Adquirida, carta.Origem = copia.ID, copia.Adquirida, copia.Origem
+		deck = append(deck, cartaProto(carta))
+	}
+	return deck, nil
+}
+
+// deckPronto confere, antes de entrar numa sala, se o jogador tem um deck
+// do tamanho que as regras da sala pedem e se ainda possui todas as cartas
+// dele. Avisa o jogador se não tiver. Chamar com mu travado.
+func deckPronto(sessao *Sessao, regras game.MatchRules) bool {
+	player := jogadorDaSessao(sessao)
+	if player == nil {
+		sendScreenMsg(sessao, "Usuário não encontrado.")
+		return false
+	}
+	if len(player.Deck) == 0 {
+		sendScreenMsg(sessao, fmt.Sprintf("Você precisa montar um deck de %d cartas primeiro!", regras.TamanhoDeck))
+		return false
+	}
+	if err := conferirDeck(player, regras); err != nil {
+		enviarErro(sessao, protocolo.ErroDeckInvalido, avisoDeck(err))
+		return false
+	}
+	return true
+}
+
+// conferirDeck é a parte do deckPronto que não depende da sessão, usada
+// também antes de cada nova partida de uma sala privada (o jogador pode ter
+// trocado o deck ou vendido cartas dele entre uma partida e outra).
+// Chamar com mu travado.
+func conferirDeck(player *User, regras game.MatchRules) error {
+	if len(player.Deck) != regras.TamanhoDeck {
+		return fmt.Errorf("a modalidade usa decks de %d cartas e o deck tem %d", regras.TamanhoDeck, len(player.Deck))
+	}
+
+	ids := make([]string, len(player.Deck))
+	for i, c := range player.Deck {
+		ids[i] = c.ID
+	}
+	deck, err := montarDeck(player, ids)
+	if err != nil {
+		return fmt.Errorf("deck inválido: %w", err)
+	}
+	player.Deck = deck // atributos atualizados com o catálogo
+	return nil
+}
+
+// avisoDeck é o texto mostrado ao jogador cujo deck não passou no conferirDeck.
+func avisoDeck(err error) string {
+	return fmt.Sprintf("Seu deck não serve para esta sala (%v). Monte outro.", err)
 }
+
 func removeSala(salaID string) {
 	for i, sala := range salasEmEspera {
 		if sala.ID == salaID {
@@ -418,272 +3172,689 @@ func removeSala(salaID string) {
 		}
 	}
 }
-func sendPairing(conn net.Conn) {
+func sendPairing(login string) {
 	msg := protocolo.Message{
 		Type: "PAREADO",
 		Data: protocolo.PairingMessage{Status: "PAREADO"},
 	}
-	sendJSON(conn, msg)
+	enviarPara(login, msg)
 }
 
 // LÓGICA DO JOGO
 //#######################################################
 func startGame(sala *Sala) {
 	mu.Lock()
-	p1 := findPlayerByConn(sala.Jogador1)
-	p2 := findPlayerByConn(sala.Jogador2)
-	mu.Unlock()
-
+	p1 := players[sala.Jogador1]
+	p2 := players[sala.Jogador2]
 	if p1 == nil || p2 == nil {
 		// Lógica de erro, um jogador desconectou antes de começar
+		cancelarPartida(sala, "jogador não encontrado")
+		mu.Unlock()
 		return
 	}
 
-	// Copia os decks para não modificar o deck original do jogador
-	deck1 := make([]protocolo.Carta, len(p1.Deck))
-	copy(deck1, p1.Deck)
-	deck2 := make([]protocolo.Carta, len(p2.Deck))
-	copy(deck2, p2.Deck)
+	// Os decks foram conferidos quando cada um entrou na sala, mas a mão é
+	// sorteada deles: confere de novo antes de sortear
+	if motivo := conferirDecksDaSala(sala); motivo != "" {
+		cancelarPartida(sala, motivo)
+		mu.Unlock()
+		return
+	}
 
-	sala.Game = &GameState{
-		Round:        1,
-		Player1Score: 0,
-		Player2Score: 0,
-		Player1Hand:  deck1,
-		Player2Hand:  deck2,
+	// As mãos são cópias, pra não modificar o deck original do jogador
+	mao1, err := sortearMao(p1.Deck, sala.Regras.TamanhoMao)
+	var mao2 []protocolo.Carta
+	if err == nil {
+		mao2, err = sortearMao(p2.Deck, sala.Regras.TamanhoMao)
+	}
+	if err != nil {
+		cancelarPartida(sala, err.Error())
+		mu.Unlock()
+		return
+	}
+	if sala.Regras.Classico {
+		// No clássico a mão é um monte, e ninguém escolhe a ordem das cartas
+		rand.Shuffle(len(mao1), func(i, j int) { mao1[i], mao1[j] = mao1[j], mao1[i] })
+		rand.Shuffle(len(mao2), func(i, j int) { mao2[i], mao2[j] = mao2[j], mao2[i] })
 	}
+	partida := &GameState{
+		Partida:  game.NovaPartida(sala.Regras, mao1, mao2),
+		ausentes: make(map[string]*time.Timer),
+	}
+	sala.Game = partida
+	mu.Unlock()
 
 	// Envia mensagem de início de jogo
-	sendJSON(sala.Jogador1, protocolo.Message{Type: "GAME_START", Data: protocolo.GameStartMessage{Opponent: p2.Login}})
-	sendJSON(sala.Jogador2, protocolo.Message{Type: "GAME_START", Data: protocolo.GameStartMessage{Opponent: p1.Login}})
+	enviarPara(sala.Jogador1, mensagemGameStart(sala, p2.Login))
+	enviarPara(sala.Jogador2, mensagemGameStart(sala, p1.Login))
+
+	// Alguém pode ter caído entre o pareamento e o início
+	for _, login := range []string{sala.Jogador1, sala.Jogador2} {
+		if sessaoDoJogador(login) == nil {
+			aguardarRetorno(sala, partida, login, false)
+		}
+	}
 
 	time.Sleep(1 * time.Second) // Pequena pausa
-	startRound(sala)
+
+	partida.GameMutex.Lock()
+	defer partida.GameMutex.Unlock()
+	if !partida.Encerrada() {
+		startRound(sala)
+	}
+}
+
+// mensagemGameStart monta o GAME_START com as regras da sala.
+func mensagemGameStart(sala *Sala, oponente string) protocolo.Message {
+	inicio := protocolo.GameStartMessage{
+		Opponent:     oponente,
+		Modalidade:   sala.Modalidade,
+		Rounds:       sala.Regras.Rounds,
+		Classico:     sala.Regras.Classico,
+		SuperTrunfo:  sala.Regras.SuperTrunfo,
+		ContraTrunfo: sala.Regras.ContraTrunfo,
+
+		Invertidos:     sala.Regras.Invertidos,
+		ChanceInversao: sala.Regras.ChanceInversao,
+
+		Serie: placarSerie(sala),
+	}
+	return protocolo.Message{Type: "GAME_START", Data: inicio}
+}
+
+// sortearMao copia n cartas do deck, sorteadas, na ordem em que estão no deck.
+func sortearMao(deck []protocolo.Carta, n int) ([]protocolo.Carta, error) {
+	if n > len(deck) {
+		return nil, fmt.Errorf("o deck tem %d cartas e a mão precisa de %d", len(deck), n)
+	}
+	escolhidas := make(map[int]bool, n)
+	for _, i := range rand.Perm(len(deck))[:n] {
+		escolhidas[i] = true
+	}
+	mao := make([]protocolo.Carta, 0, n)
+	for i, c := range deck {
+		if escolhidas[i] {
+			mao = append(mao, c)
+		}
+	}
+	return mao, nil
+}
+
+// cancelarPartida desfaz a sala quando a partida não pode começar e manda os
+// dois jogadores de volta pro menu. Numa série, que acaba junto, também manda
+// o SERIES_OVER. Chamar com mu travado.
+func cancelarPartida(sala *Sala, motivo string) {
+	fmt.Printf("Partida da sala %s cancelada: %s\n", sala.ID, motivo)
+	for _, login := range []string{sala.Jogador1, sala.Jogador2} {
+		enviarPara(login, protocolo.Message{Type: "ERRO", Data: protocolo.ErrorMessage{Codigo: protocolo.ErroPartidaCancelada, Mensagem: "A partida foi cancelada: " + motivo + "."}})
+	}
+	if sala.Serie != nil {
+		fimDaSerie(sala, "A série foi interrompida: "+motivo+".")
+	}
+	removeSala(sala.ID)
+	liberarSala(sala)
+}
+
+// startRound começa o round atual e dispara o prazo pra jogar. Chamar com GameMutex travado.
+func startRound(sala *Sala) {
+	partida := sala.Game
+	if err := partida.IniciarRound(); err != nil {
+		fmt.Printf("Sala %s: %v\n", sala.ID, err)
+		return
+	}
+
+	// Quando o prazo acaba o servidor joga por quem não jogou
+	partida.Prazo = time.Time{}
+	if config.Partida.TempoJogada > 0 {
+		tempo := time.Duration(config.Partida.TempoJogada) * time.Second
+		round := partida.Round
+		partida.Prazo = time.Now().Add(tempo)
+		partida.timer = time.AfterFunc(tempo, func() { expirarRound(sala, partida, round) })
+	}
+
+	// Envia o estado do round para cada jogador
+	enviarPara(sala.Jogador1, mensagemRoundStart(sala, game.LadoA))
+	enviarPara(sala.Jogador2, mensagemRoundStart(sala, game.LadoB))
+}
+
+// mensagemRoundStart monta o ROUND_START de um lado com o prazo do round atual.
+func mensagemRoundStart(sala *Sala, lado int) protocolo.Message {
+	partida := sala.Game
+	msg := protocolo.RoundStartMessage{Round: partida.Round, Hand: partida.Mao(lado), Invertidos: partida.RegrasDoRound().Invertidos}
+	if partida.Regras.Classico {
+		msg.Vez = sala.jogador(partida.Vez)
+	}
+	if !partida.Prazo.IsZero() {
+		msg.Prazo = partida.Prazo.UnixMilli()
+		msg.TempoJogada = int(time.Until(partida.Prazo).Round(time.Second) / time.Second)
+	}
+	return protocolo.Message{Type: "ROUND_START", Data: msg}
+}
+
+// expirarRound roda quando o prazo do round acaba. Quem ainda não jogou
+// recebe uma jogada automática ou perde o round (config.Partida.JogadaExpirada).
+func expirarRound(sala *Sala, partida *GameState, round int) {
+	partida.GameMutex.Lock()
+	defer partida.GameMutex.Unlock()
+
+	// O round pode ter sido resolvido enquanto o timer esperava o lock, e
+	// numa série a sala pode já estar em outra partida (com o mesmo round)
+	mu.Lock()
+	atual := sala.Game == partida
+	mu.Unlock()
+	if !atual || !partida.RoundAberto() || partida.Round != round {
+		return
+	}
+
+	for _, lado := range []int{game.LadoA, game.LadoB} {
+		if partida.Espera(lado) {
+			partida.Jogar(lado, jogadaAutomatica(partida.Mao(lado)))
+		}
+	}
+	processRound(sala)
+}
+
+func jogadaAutomatica(hand []protocolo.Carta) game.Jogada {
+	if config.Partida.JogadaExpirada == JogadaPerdeRound || len(hand) == 0 {
+		return game.Jogada{SemJogada: true}
+	}
+	return game.Jogada{
+		Carta:      rand.Intn(len(hand)),
+		Atributo:   game.Atributos[rand.Intn(len(game.Atributos))],
+		Automatica: true,
+	}
+}
+
+// aguardarRetorno dá a quem caiu no meio da partida um tempo pra voltar com
+// RESUME. Se não voltar, ou se saiu com QUIT, perde a partida por abandono.
+// partida é a que estava na sala quando ele caiu (lida com mu travado).
+func aguardarRetorno(sala *Sala, partida *GameState, login string, logout bool) {
+	partida.GameMutex.Lock()
+	defer partida.GameMutex.Unlock()
+
+	if partida.Encerrada() {
+		return
+	}
+	tolerancia := time.Duration(config.Partida.ToleranciaDesconexao) * time.Second
+	if logout || tolerancia <= 0 {
+		abandonarPartida(sala, login)
+		return
+	}
+
+	if t, ok := partida.ausentes[login]; ok {
+		t.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(tolerancia, func() {
+		partida.GameMutex.Lock()
+		defer partida.GameMutex.Unlock()
+		// Pode ter voltado (ou caído de novo, com outro timer) nesse meio tempo
+		if partida.Encerrada() || partida.ausentes[login] != timer {
+			return
+		}
+		abandonarPartida(sala, login)
+	})
+	partida.ausentes[login] = timer
+
+	oponente := sala.jogador(game.Outro(sala.lado(login)))
+	aviso := fmt.Sprintf("%s caiu. Se não voltar em %d segundos, você vence por abandono.", login, config.Partida.ToleranciaDesconexao)
+	enviarPara(oponente, protocolo.Message{Type: "SCREEN_MSG", Data: protocolo.ScreenMessage{Content: aviso}})
 }
-func startRound(sala *Sala) {
-	game := sala.Game
-	game.Player1Move = PlayerMove{Submitted: false}
-	game.Player2Move = PlayerMove{Submitted: false}
 
-	// Envia o estado do round para cada jogador
-	sendJSON(sala.Jogador1, protocolo.Message{Type: "ROUND_START", Data: protocolo.RoundStartMessage{Round: game.Round, Hand: game.Player1Hand}})
-	sendJSON(sala.Jogador2, protocolo.Message{Type: "ROUND_START", Data: protocolo.RoundStartMessage{Round: game.Round, Hand: game.Player2Hand}})
+// abandonarPartida encerra a partida com derrota de quem abandonou. Chamar com GameMutex travado.
+func abandonarPartida(sala *Sala, login string) {
+	fmt.Printf("Usuário %s abandonou a partida da sala %s\n", login, sala.ID)
+	sala.Game.Abandonar(sala.lado(login))
+	endGame(sala)
 }
-func handlePlayMove(conn net.Conn, data interface{}) {
+
+// handlePlayMove valida a jogada antes de aceitar: nada que o cliente mande
+// pode derrubar o processRound ou ser contado duas vezes.
+func handlePlayMove(sessao *Sessao, data interface{}) {
 	var req protocolo.PlayMoveRequest
-	_ = mapToStruct(data, &req)
+	if err := mapToStruct(data, &req); err != nil {
+		enviarErro(sessao, protocolo.ErroMensagemInvalida, "Jogada mal formada.")
+		return
+	}
 
+	// sala.Game é trocado (sob mu) a cada partida de uma série ou revanche
 	mu.Lock()
-	sala, ok := playersInRoom[conn.RemoteAddr().String()]
+	sala := playersInRoom[sessao.Login]
+	var partida *GameState
+	if sala != nil {
+		partida = sala.Game
+	}
 	mu.Unlock()
 
-	if !ok || sala.Game == nil {
-		sendScreenMsg(conn, "Você não está em um jogo ativo.")
+	if partida == nil {
+		enviarErro(sessao, protocolo.ErroSemPartida, "Você não está em um jogo ativo.")
 		return
 	}
 
-	sala.Game.GameMutex.Lock()
-	defer sala.Game.GameMutex.Unlock()
-
-	move := PlayerMove{CardIndex: req.CardIndex, Attribute: req.Attribute, Submitted: true}
+	partida.GameMutex.Lock()
+	defer partida.GameMutex.Unlock()
 
-	if conn == sala.Jogador1 {
-		sala.Game.Player1Move = move
-	} else {
-		sala.Game.Player2Move = move
+	lado := sala.lado(sessao.Login)
+	err := partida.Jogar(lado, game.Jogada{Carta: req.CardIndex, Atributo: req.Attribute})
+	switch err {
+	case nil:
+	case game.ErrEncerrada:
+		enviarErro(sessao, protocolo.ErroSemPartida, "A partida já terminou.")
+		return
+	case game.ErrForaDoRound:
+		enviarErro(sessao, protocolo.ErroForaDoRound, "Espere o próximo round começar para jogar.")
+		return
+	case game.ErrJogadaRepetida:
+		enviarErro(sessao, protocolo.ErroJogadaRepetida, "Você já jogou neste round.")
+		return
+	case game.ErrForaDaVez:
+		enviarErro(sessao, protocolo.ErroForaDaVez, fmt.Sprintf("É a vez de %s escolher o atributo.", sala.jogador(partida.Vez)))
+		return
+	case game.ErrCartaInvalida:
+		enviarErro(sessao, protocolo.ErroCartaInvalida, fmt.Sprintf("Carta inválida, escolha de 1 a %d.", len(partida.Mao(lado))))
+		return
+	case game.ErrAtributoInvalido:
+		enviarErro(sessao, protocolo.ErroAtributoInvalido, "Atributo inválido: "+req.Attribute)
+		return
+	default:
+		enviarErro(sessao, protocolo.ErroMensagemInvalida, err.Error())
+		return
 	}
 
 	// Se ambos os jogadores fizeram suas jogadas, processa o round
-	if sala.Game.Player1Move.Submitted && sala.Game.Player2Move.Submitted {
+	if partida.Completo() {
 		processRound(sala)
 	}
 }
-func getAttributeValue(card protocolo.Carta, attribute string) int {
-	switch attribute {
-	case "Envergadura":
-		return card.Envergadura
-	case "Velocidade":
-		return card.Velocidade
-	case "Altura":
-		return card.Altura
-	case "Passageiros":
-		return card.Passageiros
-	default:
-		return 0
-	}
-}
 
-// Retorna 1 se p1 ganha, 2 se p2 ganha, 0 para empate
-func compareAttributes(v1, v2 int) int {
-	if v1 > v2 {
-		return 1
+// processRound resolve o round com as duas jogadas e manda o resultado.
+// Chamar com GameMutex travado.
+func processRound(sala *Sala) {
+	partida := sala.Game
+	if partida.timer != nil {
+		partida.timer.Stop()
 	}
-	if v2 > v1 {
-		return 2
+
+	r, err := partida.ResolverRound()
+	if err != nil {
+		fmt.Printf("Sala %s: %v\n", sala.ID, err)
+		return
 	}
-	return 0
-}
-func processRound(sala *Sala) {
-	game := sala.Game
-
-	p1Move := game.Player1Move
-	p2Move := game.Player2Move
-
-	p1Card := game.Player1Hand[p1Move.CardIndex]
-	p2Card := game.Player2Hand[p2Move.CardIndex]
-
-	// Atributo escolhido pelo player 1
-	p1AttrValueP1Choice := getAttributeValue(p1Card, p1Move.Attribute)
-	p2AttrValueP1Choice := getAttributeValue(p2Card, p1Move.Attribute)
-
-	// Atributo escolhido pelo player 2
-	p1AttrValueP2Choice := getAttributeValue(p1Card, p2Move.Attribute)
-	p2AttrValueP2Choice := getAttributeValue(p2Card, p2Move.Attribute)
-
-	// Compara na característica escolhida por P1
-	resultP1Choice := compareAttributes(p1AttrValueP1Choice, p2AttrValueP1Choice)
-	// Compara na característica escolhida por P2
-	resultP2Choice := compareAttributes(p1AttrValueP2Choice, p2AttrValueP2Choice)
-
-	p1RoundPoints := 0
-	p2RoundPoints := 0
-
-	// Lógica de pontuação para o Jogador 1
-	if resultP1Choice == 1 && resultP2Choice == 1 { // Ganha nas duas
-		p1RoundPoints = 3
-	} else if (resultP1Choice == 1 && resultP2Choice == 2) || (resultP1Choice == 2 && resultP2Choice == 1) { // Ganha em uma, perde na outra
-		p1RoundPoints = 2
-	} else if (resultP1Choice == 1 && resultP2Choice == 0) || (resultP1Choice == 0 && resultP2Choice == 1) { // Ganha em uma, empata na outra
-		p1RoundPoints = 2
-	} else if resultP1Choice == 0 && resultP2Choice == 0 { // Empata nas duas
-		p1RoundPoints = 2
-	} else if (resultP1Choice == 2 && resultP2Choice == 0) || (resultP1Choice == 0 && resultP2Choice == 2) { // Perde em uma, empata na outra
-		p1RoundPoints = 1
-	} // Se perde nas duas (resultP1Choice == 2 && resultP2Choice == 2), p1RoundPoints = 0
-
-	// Lógica de pontuação para o Jogador 2 (é o inverso do jogador 1)
-	if resultP1Choice == 2 && resultP2Choice == 2 { // Ganha nas duas
-		p2RoundPoints = 3
-	} else if (resultP1Choice == 2 && resultP2Choice == 1) || (resultP1Choice == 1 && resultP2Choice == 2) {
-		p2RoundPoints = 2
-	} else if (resultP1Choice == 2 && resultP2Choice == 0) || (resultP1Choice == 0 && resultP2Choice == 2) {
-		p2RoundPoints = 2
-	} else if resultP1Choice == 0 && resultP2Choice == 0 {
-		p2RoundPoints = 2
-	} else if (resultP1Choice == 1 && resultP2Choice == 0) || (resultP1Choice == 0 && resultP2Choice == 1) {
-		p2RoundPoints = 1
-	}
-
-	// Adiciona os pontos de cada um no round
-	game.Player1Score += p1RoundPoints
-	game.Player2Score += p2RoundPoints
-
-	mu.Lock()
-	p1 := findPlayerByConn(sala.Jogador1)
-	p2 := findPlayerByConn(sala.Jogador2)
-	mu.Unlock()
 
 	// Envia o resultado do round
+	jogada := func(lado, valor int) protocolo.PlayerMoveInfo {
+		j := r.Jogadas[lado]
+		return protocolo.PlayerMoveInfo{
+			PlayerName: sala.jogador(lado), CardName: r.Cartas[lado].Nome, Attribute: j.Atributo, AttributeValue: valor,
+			Automatica: j.Automatica, SemJogada: j.SemJogada, MenorGanha: r.Regras.MenorGanha(j.Atributo),
+		}
+	}
 	resultMsg := protocolo.RoundResultMessage{
-		Round: game.Round,
-		Player1Move: protocolo.PlayerMoveInfo{
-			PlayerName: p1.Login, CardName: p1Card.Nome, Attribute: p1Move.Attribute, AttributeValue: p1AttrValueP1Choice,
-		},
-		Player2Move: protocolo.PlayerMoveInfo{
-			PlayerName: p2.Login, CardName: p2Card.Nome, Attribute: p2Move.Attribute, AttributeValue: p2AttrValueP2Choice,
-		},
-		RoundPointsP1: p1RoundPoints,
-		RoundPointsP2: p2RoundPoints,
-		TotalScoreP1:  game.Player1Score,
-		TotalScoreP2:  game.Player2Score,
-		ResultText:    fmt.Sprintf("Fim do Round %d!", game.Round),
+		Round:         r.Round,
+		Player1Move:   jogada(game.LadoA, r.ValorA),
+		Player2Move:   jogada(game.LadoB, r.ValorB),
+		RoundPointsP1: r.PontosA,
+		RoundPointsP2: r.PontosB,
+		TotalScoreP1:  partida.Placar[game.LadoA],
+		TotalScoreP2:  partida.Placar[game.LadoB],
+		ResultText:    fmt.Sprintf("Fim do Round %d!", r.Round),
+		Vencedor:      sala.jogador(r.Vencedor),
+		Invertidos:    r.Regras.Invertidos,
 	}
-
-	sendJSON(sala.Jogador1, protocolo.Message{Type: "ROUND_RESULT", Data: resultMsg})
-	sendJSON(sala.Jogador2, protocolo.Message{Type: "ROUND_RESULT", Data: resultMsg})
-
-	// Remove as cartas usadas das mãos
-	// Player 1
-	newHand1 := []protocolo.Carta{}
-	for i, card := range game.Player1Hand {
-		if i != p1Move.CardIndex {
-			newHand1 = append(newHand1, card)
+	if partida.Regras.Classico {
+		resultMsg.SuperTrunfo = r.SuperTrunfo
+		resultMsg.Mesa = len(partida.Mesa)
+		if !partida.Encerrada() {
+			resultMsg.Vez = sala.jogador(partida.Vez)
 		}
 	}
-	game.Player1Hand = newHand1
 
-	// Player 2
-	newHand2 := []protocolo.Carta{}
-	for i, card := range game.Player2Hand {
-		if i != p2Move.CardIndex {
-			newHand2 = append(newHand2, card)
-		}
-	}
-	game.Player2Hand = newHand2
+	enviarPara(sala.Jogador1, protocolo.Message{Type: "ROUND_RESULT", Data: resultMsg})
+	enviarPara(sala.Jogador2, protocolo.Message{Type: "ROUND_RESULT", Data: resultMsg})
 
 	// Proximo Round
-	game.Round++
-	if game.Round > 3 {
+	if partida.Encerrada() {
 		endGame(sala)
 	} else {
-		time.Sleep(3 * time.Second) // Tempo para os jogadores verem o resultado
-		startRound(sala)
+		// Tempo para os jogadores verem o resultado. Espera fora do lock, e
+		// jogadas que chegarem nesse meio tempo são recusadas (round fechado)
+		time.AfterFunc(3*time.Second, func() {
+			partida.GameMutex.Lock()
+			defer partida.GameMutex.Unlock()
+			if !partida.Encerrada() {
+				startRound(sala)
+			}
+		})
 	}
 }
+
+// endGame paga as moedas e desfaz a sala. Chamar com GameMutex travado e a
+// partida já encerrada.
 func endGame(sala *Sala) {
-	game := sala.Game
+	partida := sala.Game
+	if partida.timer != nil {
+		partida.timer.Stop()
+	}
+	for _, t := range partida.ausentes {
+		t.Stop()
+	}
+
 	mu.Lock()
-	p1 := findPlayerByConn(sala.Jogador1)
-	p2 := findPlayerByConn(sala.Jogador2)
+	p1 := players[sala.Jogador1]
+	p2 := players[sala.Jogador2]
 	mu.Unlock()
 
-	// Atribui moedas relativas aos pontos pra os dois jogadores
-	p1.Moedas += game.Player1Score
-	p2.Moedas += game.Player2Score
-
-	var winner string
-	if game.Player1Score > game.Player2Score {
-		winner = p1.Login
-	} else if game.Player2Score > game.Player1Score {
-		winner = p2.Login
-	} else {
+	winner := sala.jogador(partida.Vencedor())
+	if winner == "" {
 		winner = "EMPATE"
 	}
+	abandono := sala.jogador(partida.Abandono)
+
+	// Os pontos viram moedas pelas regras da sala; quem abandonou não ganha nada
+	ganhoP1 := partida.Moedas(game.LadoA)
+	ganhoP2 := partida.Moedas(game.LadoB)
+
+	// Atribui moedas relativas aos pontos pra os dois jogadores
+	mu.Lock()
+	copia := copiarJogadores(p1, p2)
+	movimentarMoedas(p1, ganhoP1, protocolo.MotivoPartida, sala.ID)
+	movimentarMoedas(p2, ganhoP2, protocolo.MotivoPartida, sala.ID)
+	credito := detalheCredito{
+		Sala:     sala.ID,
+		Valores:  map[string]int{p1.Login: ganhoP1, p2.Login: ganhoP2},
+		Abandono: abandono,
+	}
+	if err := registrarEvento(EventoMoedasCreditadas, credito, p1, p2); err != nil {
+		fmt.Printf("Erro ao salvar as moedas da partida %s: %v\n", sala.ID, err)
+		// O resultado vale, mas as moedas não foram creditadas
+		copia.desfazer()
+		ganhoP1, ganhoP2 = 0, 0
+		for _, login := range []string{sala.Jogador1, sala.Jogador2} {
+			enviarPara(login, protocolo.Message{Type: "ERRO", Data: protocolo.ErrorMessage{Codigo: protocolo.ErroGravacao, Mensagem: "Erro ao salvar as moedas da partida; elas não foram creditadas."}})
+		}
+	}
+
+	// Na sala privada a partida conta pra série, que continua depois de uma
+	// pausa ou, se acabou, abre o prazo pra revanche
+	var placar *protocolo.SeriesScore
+	continua, revanche := false, int64(0)
+	if sala.Serie != nil {
+		sala.Serie.Registrar(partida.Partida)
+		placar = placarSerie(sala)
+		continua = !sala.Serie.Encerrada()
+		if !continua && sala.Serie.Abandono == game.Nenhum && config.Partida.TempoRevanche > 0 {
+			revanche = time.Now().Add(time.Duration(config.Partida.TempoRevanche) * time.Second).UnixMilli()
+		}
+	}
+	mu.Unlock()
 
 	// Cria mensagens personalizadas para cada jogador ---
 
 	// Mensagem para o Jogador 1
 	gameOverMsgP1 := protocolo.GameOverMessage{
 		Winner:       winner,
-		FinalScoreP1: game.Player1Score,
-		FinalScoreP2: game.Player2Score,
-		CoinsEarned:  game.Player1Score, // Informa o ganho individual do P1
+		FinalScoreP1: partida.Placar[game.LadoA],
+		FinalScoreP2: partida.Placar[game.LadoB],
+		CoinsEarned:  ganhoP1, // Informa o ganho individual do P1
+		Abandono:     abandono,
+		Serie:        placar,
+		Continua:     continua,
+		Revanche:     revanche,
 	}
-	sendJSON(sala.Jogador1, protocolo.Message{Type: "GAME_OVER", Data: gameOverMsgP1})
+	enviarPara(sala.Jogador1, protocolo.Message{Type: "GAME_OVER", Data: gameOverMsgP1})
 
 	// Mensagem para o Jogador 2
 	gameOverMsgP2 := protocolo.GameOverMessage{
 		Winner:       winner,
-		FinalScoreP1: game.Player1Score,
-		FinalScoreP2: game.Player2Score,
-		CoinsEarned:  game.Player2Score, // Informa o ganho individual do P2
+		FinalScoreP1: partida.Placar[game.LadoA],
+		FinalScoreP2: partida.Placar[game.LadoB],
+		CoinsEarned:  ganhoP2, // Informa o ganho individual do P2
+		Abandono:     abandono,
+		Serie:        placar,
+		Continua:     continua,
+		Revanche:     revanche,
 	}
-	sendJSON(sala.Jogador2, protocolo.Message{Type: "GAME_OVER", Data: gameOverMsgP2})
+	enviarPara(sala.Jogador2, protocolo.Message{Type: "GAME_OVER", Data: gameOverMsgP2})
 
-	// Limpa a sala
 	mu.Lock()
-	delete(playersInRoom, sala.Jogador1.RemoteAddr().String())
-	delete(playersInRoom, sala.Jogador2.RemoteAddr().String())
+	defer mu.Unlock()
+	switch {
+	case continua:
+		sala.Status = "Intervalo"
+		time.AfterFunc(time.Duration(config.Partida.PausaSerie)*time.Second, func() { proximaDaSerie(sala) })
+	case revanche != 0:
+		fimDaSerie(sala, "")
+		abrirRevanche(sala)
+	default:
+		// Limpa a sala
+		if sala.Serie != nil {
+			fimDaSerie(sala, "")
+		}
+		liberarSala(sala)
+	}
+}
+
+// placarSerie é o placar da série da sala pras mensagens, ou nil se não é
+// série (sala pública ou partida avulsa).
+func placarSerie(sala *Sala) *protocolo.SeriesScore {
+	serie := sala.Serie
+	if serie == nil || serie.Partidas == 1 {
+		return nil
+	}
+	return &protocolo.SeriesScore{
+		Serie:      serie.Partidas,
+		Partidas:   serie.Jogadas,
+		VitoriasP1: serie.Vitorias[game.LadoA],
+		VitoriasP2: serie.Vitorias[game.LadoB],
+		Empates:    serie.Empates,
+	}
+}
+
+// fimDaSerie manda o SERIES_OVER com o placar final da série (nada numa
+// partida avulsa). motivo explica uma série interrompida antes de ser
+// decidida, que fica sem vencedor. Chamar com mu travado.
+func fimDaSerie(sala *Sala, motivo string) {
+	placar := placarSerie(sala)
+	if placar == nil {
+		return
+	}
+	winner := sala.jogador(sala.Serie.Vencedor())
+	if winner == "" {
+		winner = "EMPATE"
+	}
+	if motivo != "" {
+		winner = ""
+	}
+	msg := protocolo.SeriesOverMessage{
+		SeriesScore: *placar,
+		Jogador1:    sala.Jogador1,
+		Jogador2:    sala.Jogador2,
+		Winner:      winner,
+		Abandono:    sala.jogador(sala.Serie.Abandono),
+		Motivo:      motivo,
+	}
+	fmt.Printf("Série da sala %s encerrada: %s %d x %d %s\n", sala.ID, sala.Jogador1, placar.VitoriasP1, placar.VitoriasP2, sala.Jogador2)
+	enviarPara(sala.Jogador1, protocolo.Message{Type: "SERIES_OVER", Data: msg})
+	enviarPara(sala.Jogador2, protocolo.Message{Type: "SERIES_OVER", Data: msg})
+}
+
+// liberarSala tira a sala do servidor junto com os jogadores que ainda
+// estão nela. Chamar com mu travado.
+func liberarSala(sala *Sala) {
+	sala.Status = "Encerrada"
+	for _, login := range []string{sala.Jogador1, sala.Jogador2} {
+		if playersInRoom[login] == sala {
+			delete(playersInRoom, login)
+		}
+	}
 	delete(salas, sala.ID)
+}
+
+// conferirDecksDaSala confere o deck dos dois jogadores antes de mais uma
+// partida na mesma sala, avisando quem precisa montar outro. Devolve o
+// motivo pra não jogar, ou "" se os dois decks servem. Chamar com mu travado.
+func conferirDecksDaSala(sala *Sala) string {
+	for _, login := range []string{sala.Jogador1, sala.Jogador2} {
+		if err := conferirDeck(players[login], sala.Regras); err != nil {
+			enviarPara(login, protocolo.Message{Type: "ERRO", Data: protocolo.ErrorMessage{Codigo: protocolo.ErroDeckInvalido, Mensagem: avisoDeck(err)}})
+			return "o deck de " + login + " não serve mais para a modalidade " + sala.Modalidade
+		}
+	}
+	return ""
+}
+
+// proximaDaSerie começa, depois da pausa, a próxima partida da série.
+func proximaDaSerie(sala *Sala) {
+	mu.Lock()
+	if sala.Status != "Intervalo" {
+		mu.Unlock()
+		return
+	}
+	if motivo := conferirDecksDaSala(sala); motivo != "" {
+		fimDaSerie(sala, "A série foi interrompida: "+motivo+".")
+		liberarSala(sala)
+		mu.Unlock()
+		return
+	}
+	sala.Status = "Em_Jogo"
 	mu.Unlock()
+
+	startGame(sala)
+}
+
+// abrirRevanche deixa a sala privada esperando os dois jogadores pedirem
+// REMATCH. Se o prazo acabar antes, a sala é desfeita. Chamar com mu travado.
+func abrirRevanche(sala *Sala) {
+	sala.Status = "Revanche"
+	sala.revanche = make(map[string]bool)
+
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Duration(config.Partida.TempoRevanche)*time.Second, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		// A revanche pode ter começado (ou sido cancelada) enquanto o timer esperava o lock
+		if sala.Status != "Revanche" || sala.prazoRevanche != timer {
+			return
+		}
+		encerrarRevanche(sala, protocolo.RevancheExpirada, "O prazo para a revanche acabou.")
+	})
+	sala.prazoRevanche = timer
+}
+
+// encerrarRevanche fecha o prazo de revanche sem nova partida, avisa quem
+// ainda estava na sala e desfaz a sala. Chamar com mu travado.
+func encerrarRevanche(sala *Sala, status, motivo string) {
+	sala.prazoRevanche.Stop()
+	for _, login := range []string{sala.Jogador1, sala.Jogador2} {
+		if playersInRoom[login] != sala {
+			continue
+		}
+		resp := protocolo.RematchStatus{Status: status, Oponente: sala.jogador(game.Outro(sala.lado(login))), Motivo: motivo}
+		enviarPara(login, protocolo.Message{Type: "REMATCH_STATUS", Data: resp})
+	}
+	liberarSala(sala)
+}
+
+// deixarSalaAnterior roda antes de o jogador entrar em outra sala: quem
+// esperava oponente sai da sala, quem esperava revanche desiste dela, e quem
+// está jogando (ou no meio de uma série) não pode sair. Chamar com mu travado.
+func deixarSalaAnterior(sessao *Sessao) bool {
+	sala := playersInRoom[sessao.Login]
+	if sala == nil {
+		return true
+	}
+	switch sala.Status {
+	case "Waiting_Player":
+		removeSala(sala.ID)
+		liberarSala(sala)
+		sendScreenMsg(sessao, "Você saiu da sala "+sala.ID+".")
+	case "Revanche":
+		encerrarRevanche(sala, protocolo.RevancheCancelada, sessao.Login+" saiu da sala.")
+	case "Em_Jogo":
+		sendScreenMsg(sessao, "Você já está em uma partida. Termine-a antes de entrar em outra sala.")
+		return false
+	case "Intervalo":
+		sendScreenMsg(sessao, "Você está no meio de uma série. Aguarde a próxima partida.")
+		return false
+	}
+	return true
+}
+
+// handleRematch registra um pedido de revanche. Quando os dois jogadores
+// pedem dentro do prazo, uma nova partida (ou uma nova série, do mesmo
+// tamanho) começa na mesma sala, com mãos novas.
+func handleRematch(sessao *Sessao) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	sala := playersInRoom[sessao.Login]
+	if sala == nil || sala.Status != "Revanche" {
+		enviarErro(sessao, protocolo.ErroSemRevanche, "Não há partida de sala privada esperando revanche.")
+		return
+	}
+	oponente := sala.jogador(game.Outro(sala.lado(sessao.Login)))
+	if sala.revanche[sessao.Login] {
+		sendScreenMsg(sessao, "Você já pediu revanche. Aguardando "+oponente+"...")
+		return
+	}
+	sala.revanche[sessao.Login] = true
+
+	if !sala.revanche[oponente] {
+		sessao.Enviar(protocolo.Message{Type: "REMATCH_STATUS", Data: protocolo.RematchStatus{Status: protocolo.RevancheAguardando, Oponente: oponente}})
+		enviarPara(oponente, protocolo.Message{Type: "REMATCH_STATUS", Data: protocolo.RematchStatus{Status: protocolo.RevanchePedida, Oponente: sessao.Login}})
+		return
+	}
+
+	// Os dois pediram: confere os decks de novo, que podem ter mudado depois da partida
+	if motivo := conferirDecksDaSala(sala); motivo != "" {
+		encerrarRevanche(sala, protocolo.RevancheCancelada, "Revanche cancelada: "+motivo+".")
+		return
+	}
+	sala.prazoRevanche.Stop()
+	sala.Serie, _ = game.NovaSerie(sala.Serie.Partidas)
+	sala.Status = "Em_Jogo"
+	for _, login := range []string{sala.Jogador1, sala.Jogador2} {
+		resp := protocolo.RematchStatus{Status: protocolo.RevancheAceita, Oponente: sala.jogador(game.Outro(sala.lado(login)))}
+		enviarPara(login, protocolo.Message{Type: "REMATCH_STATUS", Data: resp})
+	}
+	fmt.Printf("Revanche na sala %s entre %s e %s\n", sala.ID, sala.Jogador1, sala.Jogador2)
+
+	go startGame(sala)
 }
 
 //#######################################################
 // FIM DA LÓGICA DO JOGO
 
+// CONSOLE DE ADMINISTRACAO
+// consoleAdmin lê os comandos digitados no terminal do servidor (com docker:
+// docker attach servidor).
+func consoleAdmin() {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		switch strings.TrimSpace(scanner.Text()) {
+		case "":
+		case "auditoria":
+			total, divergencias := auditarMoedas()
+			for _, d := range divergencias {
+				fmt.Println("  " + d)
+			}
+			fmt.Printf("Auditoria: %d jogadores conferidos, %d divergências.\n", total, len(divergencias))
+		case "recarregar":
+			if err := recarregarCartas(); err != nil {
+				fmt.Println("Erro ao recarregar o catálogo:", err)
+			}
+		case "ajuda":
+			fmt.Println("Comandos: auditoria (confere os saldos de moedas com os extratos), recarregar (lê data/cartas.json de novo), ajuda")
+		default:
+			fmt.Println("Comando desconhecido. Digite ajuda para ver os comandos.")
+		}
+	}
+}
+
 // Funcao que vai ser aberta pra gerenciar cada conexao em uma thread
 func handleConnection(conn net.Conn) {
-	defer conn.Close()
+	sessao := abrirSessao(conn)
+	defer fecharSessao(sessao)
 	reader := bufio.NewReader(conn)
 
 	for {
@@ -696,28 +3867,22 @@ func handleConnection(conn net.Conn) {
 				// Este erro é esperado quando a conexão é fechada, podemos ignorá-lo ou logar de forma mais branda
 				// fmt.Printf("Erro ao ler dados de %s: %v\n", conn.RemoteAddr(), err)
 			}
-			mu.Lock()
-			player := findPlayerByConn(conn)
-			if player != nil {
-				player.Online = false
-				player.Conn = nil
-				fmt.Printf("Usuário %s deslogou automaticamente\n", player.Login)
-			}
-			mu.Unlock()
+			desconectar(sessao, false)
 			return
 		}
 		
-		if !interpreter(conn, message) {
+		if !interpreter(sessao, message) {
+			desconectar(sessao, true)
 			break
 		}
 	}
 }
 
 // Funcao que recebe as requests interpreta e devolve uma response.
-func interpreter(conn net.Conn, fullMessage string) bool {
+func interpreter(sessao *Sessao, fullMessage string) bool {
 	var msg protocolo.Message
 	if err := json.Unmarshal([]byte(fullMessage), &msg); err != nil {
-		sendScreenMsg(conn, "Mensagem inválida.")
+		sendScreenMsg(sessao, "Mensagem inválida.")
 		return true
 	}
 
@@ -728,74 +3893,88 @@ func interpreter(conn net.Conn, fullMessage string) bool {
 		_ = mapToStruct(msg.Data, &data)
 		// Consigo pegar data.Login e data.Senha e criar um usuario novo.
 
-		cadastrarUser(conn, data)
+		cadastrarUser(sessao, data)
 
 	case "LOGIN":
 		var data protocolo.LoginRequest
 		_ = mapToStruct(msg.Data, &data)
 
-		loginUser(conn, data)
+		loginUser(sessao, data)
+
+	case "RESUME":
+		var data protocolo.ResumeRequest
+		_ = mapToStruct(msg.Data, &data)
+
+		resumeSession(sessao, data)
 
 	case "CREATE_ROOM":
-		player := findPlayerByConn(conn)
-		if len(player.Deck) < 4 {
-			sendScreenMsg(conn, "Você precisa montar um deck de 4 cartas primeiro!")
-			return true
-		}
-		createRoom(conn)
+		var data protocolo.RoomRequest
+		_ = mapToStruct(msg.Data, &data)
+		createRoom(sessao, data.Modalidade, data.Serie)
 
 	case "FIND_ROOM":
-		player := findPlayerByConn(conn)
-		if len(player.Deck) < 4 {
-			sendScreenMsg(conn, "Você precisa montar um deck de 4 cartas primeiro!")
-			return true
-		}
 		var data protocolo.RoomRequest
 		_ = mapToStruct(msg.Data, &data)
-		findRoom(conn, data.Mode, "")
+		findRoom(sessao, data.Mode, "", data.Modalidade)
 
 	case "PRIV_ROOM":
-		player := findPlayerByConn(conn)
-		if len(player.Deck) < 4 {
-			sendScreenMsg(conn, "Você precisa montar um deck de 4 cartas primeiro!")
-			return true
-		}
 		var data protocolo.RoomRequest
 		_ = mapToStruct(msg.Data, &data)
-		findRoom(conn, "", data.RoomCode)
+		findRoom(sessao, "", data.RoomCode, "")
+
+	case "REMATCH":
+		handleRematch(sessao)
 
 	case "CHAT":
 		var data protocolo.ChatMessage
 		_ = mapToStruct(msg.Data, &data)
-		messageRouter(conn, data)
+		messageRouter(sessao, data)
 
 	case "COMPRA":
 		mu.Lock()
 		defer mu.Unlock()
 
-		player := findPlayerByConn(conn) // encontra o player
+		player := jogadorDaSessao(sessao) // encontra o player
 
 		if player == nil {
-			sendScreenMsg(conn, "Usuário não encontrado.")
+			sendScreenMsg(sessao, "Usuário não encontrado.")
+			return true
+		}
+
+		var data protocolo.OpenPackageRequest
+		_ = mapToStruct(msg.Data, &data)
+
+		pacote := pacotePorTipo(data.Tipo)
+		if pacote == nil {
+			resp := protocolo.CompraResponse{
+				Status: "PACOTE_INVALIDO", // tipo que não está na LIST_PACKS
+				Pacote: data.Tipo,
+			}
+			sessao.Enviar(protocolo.Message{
+				Type: "COMPRA_RESPONSE",
+				Data: resp,
+			})
 			return true
 		}
 
-		if len(storage) == 0 {
+		if pacoteEsgotado(pacote) {
 			resp := protocolo.CompraResponse{
-				Status: "EMPTY_STORAGE", // sem carta no storage (isso nao é pra ocorrer nunca)
+				Status: "EMPTY_STORAGE", // o estoque não tem cartas pra esse pacote
+				Pacote: pacote.Tipo,
 			}
-			sendJSON(conn, protocolo.Message{
+			sessao.Enviar(protocolo.Message{
 				Type: "COMPRA_RESPONSE",
 				Data: resp,
 			})
 			return true
 		}
 
-		if player.Moedas < 10 {
+		if saldoLivre(player) < pacote.Preco {
 			resp := protocolo.CompraResponse{
 				Status: "NO_BALANCE", // saldo insuficiente
+				Pacote: pacote.Tipo,
 			}
-			sendJSON(conn, protocolo.Message{
+			sessao.Enviar(protocolo.Message{
 				Type: "COMPRA_RESPONSE",
 				Data: resp,
 			})
@@ -803,112 +3982,234 @@ func interpreter(conn net.Conn, fullMessage string) bool {
 		}
 
 		// Compra aprovada
-		carta := buyCard(player)
-		player.Inventario.Cartas = append(player.Inventario.Cartas, *carta)
+		copia := copiarJogadores(player)
+		noEstoque := make(map[string]int, len(estoque.Cartas))
+		for nome, n := range estoque.Cartas {
+			noEstoque[nome] = n
+		}
+		novas := abrirPacote(player, pacote)
+		detalhe := detalheCompra{Pacote: pacote.Tipo, Preco: pacote.Preco}
+		for _, c := range novas {
+			detalhe.Cartas = append(detalhe.Cartas, c.ID)
+		}
+		if err := gravarEstoque(); err != nil {
+			fmt.Printf("Erro ao salvar o estoque: %v\n", err)
+		}
+		if err := registrarEvento(EventoCartaComprada, detalhe, player); err != nil {
+			fmt.Printf("Erro ao salvar a compra de %s: %v\n", player.Login, err)
+			// As cartas voltam pro estoque e as moedas pro jogador
+			copia.desfazer()
+			estoque.Cartas = noEstoque
+			if err := gravarEstoque(); err != nil {
+				fmt.Printf("Erro ao salvar o estoque: %v\n", err)
+			}
+			enviarErro(sessao, protocolo.ErroGravacao, "Erro ao salvar a compra, tente novamente.")
+			return true
+		}
 
-		// Converte carta e inventário para o tipo protocolo
+		// Converte cartas e inventário para o tipo protocolo
 		// #################################################
-		cartaProto := &protocolo.Carta{
-			Nome:        carta.Nome,
-			Raridade:    carta.Raridade,
-			Envergadura: carta.Envergadura,
-			Velocidade:  carta.Velocidade,
-			Altura:      carta.Altura,
-			Passageiros: carta.Passageiros,
-		}
-
-		invProto := protocolo.Inventario{
-			Cartas: make([]protocolo.Carta, len(player.Inventario.Cartas)),
-		}
-
-		for i, c := range player.Inventario.Cartas {
-			invProto.Cartas[i] = protocolo.Carta{
-				Nome:        c.Nome,
-				Raridade:    c.Raridade,
-				Envergadura: c.Envergadura,
-				Velocidade:  c.Velocidade,
-				Altura:      c.Altura,
-				Passageiros: c.Passageiros,
-			}
+		cartasProto := make([]protocolo.Carta, 0, len(novas))
+		for _, c := range novas {
+			cartasProto = append(cartasProto, cartaProto(c))
 		}
+
+		invProto := inventarioProto(player)
 		// #################################################
 
 		resp := protocolo.CompraResponse{
 			Status:     "COMPRA_APROVADA",
-			CartaNova:  cartaProto,
+			Pacote:     pacote.Tipo,
+			Cartas:     cartasProto,
 			Inventario: invProto,
+			Pity:       progressoPity(player, *pacote),
 		}
 
-		sendJSON(conn, protocolo.Message{
+		sessao.Enviar(protocolo.Message{
 			Type: "COMPRA_RESPONSE",
 			Data: resp,
 		})
 
+	case "LIST_PACKS":
+		mu.Lock()
+		defer mu.Unlock()
+
+		player := jogadorDaSessao(sessao)
+		if player == nil {
+			sendScreenMsg(sessao, "Usuário não encontrado.")
+			return true
+		}
+
+		resp := protocolo.ListPacksResponse{}
+		for _, p := range pacotes {
+			info := protocolo.PacoteInfo{
+				Tipo:     p.Tipo,
+				Nome:     p.Nome,
+				Tamanho:  p.Tamanho,
+				Preco:    p.Preco,
+				Chances:  make(map[string]float64),
+				Garantia: p.Garantia,
+				Pity:     progressoPity(player, p),
+				Esgotado: pacoteEsgotado(&p),
+			}
+			for _, raridade := range loja.Raridades {
+				info.Chances[raridade] = p.Chance(raridade)
+			}
+			resp.Pacotes = append(resp.Pacotes, info)
+		}
+
+		sessao.Enviar(protocolo.Message{
+			Type: "LIST_PACKS_RESPONSE",
+			Data: resp,
+		})
+
 	case "CHECK_BALANCE":
-		player := findPlayerByConn(conn)
+		player := jogadorDaSessao(sessao)
 		if player == nil {
-			sendScreenMsg(conn, "Usuário não encontrado.")
+			sendScreenMsg(sessao, "Usuário não encontrado.")
 			return true
 		}
 
 		resp := protocolo.BalanceResponse{
-			Saldo: player.Moedas,
+			Saldo:      player.Moedas,
+			Fragmentos: player.Fragmentos,
 		}
 
-		sendJSON(conn, protocolo.Message{
+		sessao.Enviar(protocolo.Message{
 			Type: "BALANCE_RESPONSE",
 			Data: resp,
 		})
 
 	case "CHECK_LATENCY":
-		player := findPlayerByConn(conn)
+		mu.Lock()
+		player := jogadorDaSessao(sessao)
 		if player == nil {
-			sendScreenMsg(conn, "Usuário não encontrado.")
+			mu.Unlock()
+			sendScreenMsg(sessao, "Usuário não encontrado.")
 			return true
 		}
 
 		resp := protocolo.LatencyResponse{
 			Latencia: player.Latencia,
 		}
+		mu.Unlock()
 
-		sendJSON(conn, protocolo.Message{
+		sessao.Enviar(protocolo.Message{
 			Type: "LATENCY_RESPONSE",
 			Data: resp,
 		})
 
 	case "PONG":
-		player := findPlayerByConn(conn)
-		if player == nil {
-			return true
-		}
-
 		var ts int64
 		_ = mapToStruct(msg.Data, &ts) // timestamp original do PING
 
-		// Latência em milissegundos
-		player.Latencia = (time.Now().UnixNano() - ts) / int64(time.Millisecond)
+		// Latência em milissegundos. O perfil inteiro vai pro journal com mu
+		// travado, então mesmo esse campo só muda com mu
+		mu.Lock()
+		if player := jogadorDaSessao(sessao); player != nil {
+			player.Latencia = (time.Now().UnixNano() - ts) / int64(time.Millisecond)
+		}
+		mu.Unlock()
 
 	case "SET_DECK":
 		var req protocolo.SetDeckRequest
-		_ = mapToStruct(msg.Data, &req)
+		if err := mapToStruct(msg.Data, &req); err != nil {
+			enviarErro(sessao, protocolo.ErroMensagemInvalida, "Pedido de deck mal formado.")
+			return true
+		}
 
-		player := findPlayerByConn(conn)
+		player := jogadorDaSessao(sessao)
 		if player == nil {
-			sendScreenMsg(conn, "Usuário não encontrado para montar deck.")
+			sendScreenMsg(sessao, "Usuário não encontrado para montar deck.")
 			return true
 		}
 
-		player.Deck = req.Cartas
-		sendScreenMsg(conn, "Deck salvo com sucesso!")
+		// O deck só pode ter cartas do inventário, com os atributos do catálogo.
+		// Dentro de uma sala ele não muda: a mão da partida é sorteada dele
+		// (esperando revanche pode, que a revanche confere os decks de novo)
+		mu.Lock()
+		if sala := playersInRoom[player.Login]; sala != nil && sala.Status != "Revanche" {
+			mu.Unlock()
+			enviarErro(sessao, protocolo.ErroDeckEmSala, "Não dá pra trocar o deck dentro de uma sala.")
+			return true
+		}
+		deck, err := montarDeck(player, req.Cartas)
+		if err == nil {
+			// Carta em troca ou à venda pode mudar de dono a qualquer momento
+			presas, _ := emCustodia(player.Login, nil)
+			for _, c := range deck {
+				if presas[c.ID] {
+					err = fmt.Errorf("a carta %s (%s) está em uma troca ou à venda", c.Nome, c.ID)
+					break
+				}
+			}
+		}
+		if err != nil {
+			mu.Unlock()
+			enviarErro(sessao, protocolo.ErroDeckInvalido, "Deck inválido: "+err.Error()+".")
+			return true
+		}
+		anterior := player.Deck
+		player.Deck = deck
+		err = registrarEvento(EventoDeckDefinido, nil, player)
+		if err != nil {
+			player.Deck = anterior
+		}
+		mu.Unlock()
+		if err != nil {
+			fmt.Printf("Erro ao salvar o deck de %s: %v\n", player.Login, err)
+			sendScreenMsg(sessao, "Erro ao salvar o deck, tente novamente.")
+			return true
+		}
+		sendScreenMsg(sessao, "Deck salvo com sucesso!")
 
 	case "PLAY_MOVE":
-		handlePlayMove(conn, msg.Data)
+		handlePlayMove(sessao, msg.Data)
+
+	case "TRADE_OFFER":
+		handleTradeOffer(sessao, msg.Data)
+
+	case "TRADE_ACCEPT":
+		handleTradeAccept(sessao, msg.Data)
+
+	case "TRADE_CANCEL":
+		handleTradeCancel(sessao, msg.Data)
+
+	case "MARKET_LIST":
+		handleMarketList(sessao, msg.Data)
+
+	case "MARKET_BROWSE":
+		handleMarketBrowse(sessao, msg.Data)
+
+	case "MARKET_BID":
+		handleMarketBid(sessao, msg.Data)
+
+	case "MARKET_BUY":
+		handleMarketBuy(sessao, msg.Data)
+
+	case "MARKET_CANCEL":
+		handleMarketCancel(sessao, msg.Data)
+
+	case "COIN_HISTORY":
+		handleCoinHistory(sessao, msg.Data)
+
+	case "CLAIM_DAILY":
+		handleClaimDaily(sessao)
+
+	case "STORAGE_STATUS":
+		handleStorageStatus(sessao)
+
+	case "DISMANTLE":
+		handleDismantle(sessao, msg.Data)
+
+	case "CRAFT":
+		handleCraft(sessao, msg.Data)
 
 	case "QUIT":
 		return false
 		
 	default:
-		sendScreenMsg(conn, "Comando inválido.")
+		sendScreenMsg(sessao, "Comando inválido.")
 	}
 	return true
 }
@@ -916,24 +4217,89 @@ func interpreter(conn net.Conn, fullMessage string) bool {
 func main() {
 	rand.Seed(time.Now().UnixNano())
 
-	// Carrega os dados dos jogadores ao iniciar
-	loadPlayerData()
+	var err error
+	config, err = carregarConfig()
+	if err != nil {
+		fmt.Println("Erro ao carregar a configuração:", err)
+		return
+	}
+
+	// Abre o armazenamento escolhido na configuração e carrega os jogadores
+	store, err = persistencia.Abrir(config.Persistencia.Backend, config.Persistencia.Arquivo, config.Persistencia.Backups)
+	if err != nil {
+		fmt.Println("Erro ao abrir o armazenamento dos jogadores:", err)
+		return
+	}
+	// Reaplica o que ficou no journal se o servidor caiu da última vez
+	journal, err = persistencia.AbrirJournal(config.Persistencia.Journal)
+	if err != nil {
+		fmt.Println("Erro ao abrir o journal:", err)
+		return
+	}
+	if err := recuperarJournal(); err != nil {
+		fmt.Println("Erro ao recuperar o journal:", err)
+		return
+	}
+	if err := loadPlayerData(); err != nil {
+		fmt.Println("Erro ao carregar os jogadores:", err)
+		return
+	}
+	if migradas, err := migrarSenhas(); err != nil {
+		fmt.Println("Erro ao migrar as senhas:", err)
+		return
+	} else if migradas > 0 {
+		// Grava logo pra não precisar migrar de novo
+		if err := snapshotJogadores(); err != nil {
+			fmt.Println("Erro ao gravar as senhas migradas:", err)
+			return
+		}
+		fmt.Printf("%d senhas migradas.\n", migradas)
+	}
+	if migradas, err := migrarCartas(); err != nil {
+		fmt.Println("Erro ao migrar as cartas:", err)
+		return
+	} else if migradas > 0 {
+		if err := snapshotJogadores(); err != nil {
+			fmt.Println("Erro ao gravar as cartas migradas:", err)
+			return
+		}
+		fmt.Printf("%d cartas receberam ID.\n", migradas)
+	}
+	if migrados, err := migrarExtrato(); err != nil {
+		fmt.Println("Erro ao migrar os extratos:", err)
+		return
+	} else if migrados > 0 {
+		if err := snapshotJogadores(); err != nil {
+			fmt.Println("Erro ao gravar os extratos migrados:", err)
+			return
+		}
+		fmt.Printf("%d extratos abertos com o saldo inicial ou aparados.\n", migrados)
+	}
 
 	// Iniciando maps e listas
 	salas = make(map[string]*Sala)
 	salasEmEspera = make([]*Sala, 0)
 	playersInRoom = make(map[string]*Sala)
+	tokens = make(map[string]*User)
+	trocas = make(map[string]*Troca)
+	sessoesPorConn = make(map[net.Conn]*Sessao)
+	sessoesPorLogin = make(map[string]*Sessao)
 
 	// Chama a funcao pra carregar o Json de cartas cadastradas.
 	if err := carregarCartas(); err != nil {
 		fmt.Println("Erro ao carregar cartas:", err)
 		return
 	}
-	// Preenche a fila de pacotes de cartas.
-	for i := 0; i < 500; i++ {
-		fillCardStorage()
+	// Tipos de pacote vendidos no COMPRA
+	if err := carregarPacotes(); err != nil {
+		fmt.Println("Erro ao carregar pacotes:", err)
+		return
+	}
+	carregarMercado()
+	if err := carregarEstoque(); err != nil {
+		fmt.Println("Erro ao carregar o estoque:", err)
+		return
 	}
-	fmt.Println("Armazenamento preenchido com 500 cartas!")
 
 	// LÓGICA DE DESLIGAMENTO GRACIOSO
 	sigs := make(chan os.Signal, 1)
@@ -946,6 +4312,28 @@ func main() {
 	}()
 	// -----------------------------------------
 
+	// Snapshots periódicos do store (o journal cobre o intervalo entre eles)
+	if config.Persistencia.IntervaloSnapshot > 0 {
+		go snapshotPeriodico(time.Duration(config.Persistencia.IntervaloSnapshot) * time.Second)
+	}
+
+	if config.Rede.IntervaloMetricas > 0 {
+		go logMetricasPeriodico(time.Duration(config.Rede.IntervaloMetricas) * time.Second)
+	}
+
+	// Encerra os leilões vencidos
+	if config.Mercado.IntervaloLiquidacao > 0 {
+		go liquidacaoPeriodica(time.Duration(config.Mercado.IntervaloLiquidacao) * time.Second)
+	}
+
+	// Repõe o estoque de cartas dos pacotes
+	if config.Estoque.IntervaloReposicao > 0 {
+		go reposicaoPeriodica()
+	}
+
+	// Comandos de administração pelo terminal
+	go consoleAdmin()
+
 	// Funcao pra ficar monitorando o ping de TODOS os players. (altere o tempo do sleep pra aumentar a frequencia de leitura)
 	go func() {
 		for {
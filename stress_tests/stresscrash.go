@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"card_game/protocolo"
+)
+
+// ============== PARÂMETROS EDITÁVEIS ==============
+const (
+	// Quantos clientes compram ao mesmo tempo
+	numClients = 50
+
+	// Quantas compras cada cliente tenta fazer (50 moedas iniciais = 5 compras)
+	comprasPorCliente = 5
+
+	// Arquivo onde a fase de compra guarda o que o servidor confirmou
+	arquivoEsperado = "crash_esperado.json"
+
+	serverAddress = "127.0.0.1:8080"
+)
+
+// =================================================
+
+// Teste de kill -9: nenhuma compra confirmada pelo servidor pode sumir.
+//
+//  1. go run stress_tests/stresscrash.go compra
+//  2. kill -9 <pid do servidor> (ou docker kill servidor) e suba o servidor de novo
+//  3. go run stress_tests/stresscrash.go verifica
+
+type estadoEsperado struct {
+	Cartas int `json:"cartas"`
+	Saldo  int `json:"saldo"`
+}
+
+// comprarCliente cadastra, loga e compra, guardando o estado confirmado pelo servidor.
+func comprarCliente(id int, wg *sync.WaitGroup, esperado map[string]estadoEsperado, mu *sync.Mutex) {
+	defer wg.Done()
+
+	conn, err := net.DialTimeout("tcp", serverAddress, 5*time.Second)
+	if err != nil {
+		fmt.Printf("[Cliente %d] Erro ao conectar: %v\n", id, err)
+		return
+	}
+	defer conn.Close()
+
+	writer := bufio.NewWriter(conn)
+	reader := bufio.NewReader(conn)
+
+	login := "crash_user_" + strconv.Itoa(id)
+	senha := "password"
+
+	sendJSON(writer, protocolo.Message{Type: "CADASTRO", Data: protocolo.SignInRequest{Login: login, Senha: senha}})
+	esperar(reader, "SCREEN_MSG")
+	sendJSON(writer, protocolo.Message{Type: "LOGIN", Data: protocolo.LoginRequest{Login: login, Senha: senha}})
+
+	var loginResp protocolo.LoginResponse
+	if msg, ok := esperar(reader, "LOGIN"); ok {
+		mapToStruct(msg.Data, &loginResp)
+	}
+	if loginResp.Status != "LOGADO" {
+		fmt.Printf("[Cliente %d] Login falhou: %s\n", id, loginResp.Status)
+		return
+	}
+	cartas := len(loginResp.Inventario.Cartas)
+
+	for i := 0; i < comprasPorCliente; i++ {
+		sendJSON(writer, protocolo.Message{Type: "COMPRA", Data: protocolo.OpenPackageRequest{}})
+		msg, ok := esperar(reader, "COMPRA_RESPONSE")
+		if !ok {
+			return
+		}
+		var resp protocolo.CompraResponse
+		mapToStruct(msg.Data, &resp)
+		if resp.Status != "COMPRA_APROVADA" {
+			break
+		}
+		cartas = len(resp.Inventario.Cartas)
+	}
+
+	sendJSON(writer, protocolo.Message{Type: "CHECK_BALANCE", Data: protocolo.CheckBalance{}})
+	msg, ok := esperar(reader, "BALANCE_RESPONSE")
+	if !ok {
+		return
+	}
+	var saldo protocolo.BalanceResponse
+	mapToStruct(msg.Data, &saldo)
+
+	mu.Lock()
+	esperado[login] = estadoEsperado{Cartas: cartas, Saldo: saldo.Saldo}
+	mu.Unlock()
+}
+
+// verificarCliente loga de novo depois do crash e compara com o que foi confirmado.
+func verificarCliente(login string, esperado estadoEsperado) bool {
+	conn, err := net.DialTimeout("tcp", serverAddress, 5*time.Second)
+	if err != nil {
+		fmt.Printf("[%s] Erro ao conectar: %v\n", login, err)
+		return false
+	}
+	defer conn.Close()
+
+	writer := bufio.NewWriter(conn)
+	reader := bufio.NewReader(conn)
+
+	sendJSON(writer, protocolo.Message{Type: "LOGIN", Data: protocolo.LoginRequest{Login: login, Senha: "password"}})
+	msg, ok := esperar(reader, "LOGIN")
+	if !ok {
+		return false
+	}
+	var resp protocolo.LoginResponse
+	mapToStruct(msg.Data, &resp)
+
+	if resp.Status != "LOGADO" {
+		fmt.Printf("[%s] Login falhou: %s\n", login, resp.Status)
+		return false
+	}
+	if len(resp.Inventario.Cartas) != esperado.Cartas || resp.Saldo != esperado.Saldo {
+		fmt.Printf("[%s] PERDA: esperado %d cartas/%d moedas, servidor tem %d cartas/%d moedas\n",
+			login, esperado.Cartas, esperado.Saldo, len(resp.Inventario.Cartas), resp.Saldo)
+		return false
+	}
+	sendJSON(writer, protocolo.Message{Type: "QUIT"})
+	return true
+}
+
+func main() {
+	if len(os.Args) < 2 || (os.Args[1] != "compra" && os.Args[1] != "verifica") {
+		fmt.Println("Uso: go run stress_tests/stresscrash.go compra|verifica")
+		return
+	}
+
+	if os.Args[1] == "compra" {
+		fmt.Printf("Fase de compra com %d clientes...\n", numClients)
+		esperado := make(map[string]estadoEsperado)
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+
+		for i := 0; i < numClients; i++ {
+			wg.Add(1)
+			go comprarCliente(i, &wg, esperado, &mu)
+			time.Sleep(10 * time.Millisecond)
+		}
+		wg.Wait()
+
+		data, _ := json.MarshalIndent(esperado, "", "  ")
+		if err := os.WriteFile(arquivoEsperado, data, 0644); err != nil {
+			fmt.Println("Erro ao salvar o estado esperado:", err)
+			return
+		}
+		fmt.Printf("%d clientes confirmados e salvos em %s.\n", len(esperado), arquivoEsperado)
+		fmt.Println("Agora mate o servidor com kill -9, suba de novo e rode a fase 'verifica'.")
+		return
+	}
+
+	data, err := os.ReadFile(arquivoEsperado)
+	if err != nil {
+		fmt.Println("Erro ao ler o estado esperado (rode a fase 'compra' antes):", err)
+		return
+	}
+	var esperado map[string]estadoEsperado
+	if err := json.Unmarshal(data, &esperado); err != nil {
+		fmt.Println("Erro ao decodificar o estado esperado:", err)
+		return
+	}
+
+	ok := 0
+	for login, e := range esperado {
+		if verificarCliente(login, e) {
+			ok++
+		}
+	}
+	fmt.Printf("\n%d de %d jogadores com todas as compras intactas.\n", ok, len(esperado))
+	if ok != len(esperado) {
+		os.Exit(1)
+	}
+}
+
+// Funções auxiliares para o teste
+func sendJSON(writer *bufio.Writer, msg protocolo.Message) error {
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	writer.Write(jsonData)
+	writer.WriteString("\n")
+	return writer.Flush()
+}
+
+func mapToStruct(input interface{}, target interface{}) {
+	bytes, _ := json.Marshal(input)
+	json.Unmarshal(bytes, target)
+}
+
+// esperar lê mensagens até chegar uma do tipo pedido (ignora PING e afins).
+func esperar(reader *bufio.Reader, tipo string) (protocolo.Message, bool) {
+	for {
+		message, err := reader.ReadString('\n')
+		if err != nil {
+			return protocolo.Message{}, false
+		}
+		var msg protocolo.Message
+		if err := json.Unmarshal([]byte(message), &msg); err != nil {
+			continue
+		}
+		if msg.Type == tipo {
+			return msg, true
+		}
+	}
+}
@@ -42,12 +42,28 @@ func simulateMatchmakingClient(id int, wg *sync.WaitGroup, successCounter *int,
 	sendJSON(writer, protocolo.Message{Type: "CADASTRO", Data: protocolo.SignInRequest{Login: login, Senha: senha}})
 	time.Sleep(50 * time.Millisecond)
 	sendJSON(writer, protocolo.Message{Type: "LOGIN", Data: protocolo.LoginRequest{Login: login, Senha: senha}})
+	if _, ok := esperar(reader, "LOGIN"); !ok {
+		fmt.Printf("[Cliente %d] Sem resposta do login\n", id)
+		return
+	}
 	
-	// 2. Montar um deck falso
-	dummyDeck := []protocolo.Carta{
-		{Nome: "Carta1"}, {Nome: "Carta2"}, {Nome: "Carta3"}, {Nome: "Carta4"},
+	// 2. Comprar 4 cartas e montar o deck com elas (o servidor só aceita cartas do inventário)
+	deck := []string{}
+	for len(deck) < 4 {
+		sendJSON(writer, protocolo.Message{Type: "COMPRA", Data: protocolo.OpenPackageRequest{}})
+		msg, ok := esperar(reader, "COMPRA_RESPONSE")
+		if !ok {
+			return
+		}
+		var resp protocolo.CompraResponse
+		mapToStruct(msg.Data, &resp)
+		if resp.Status != "COMPRA_APROVADA" {
+			fmt.Printf("[Cliente %d] Compra falhou: %s\n", id, resp.Status)
+			return
+		}
+		deck = append(deck, resp.Cartas[0].ID)
 	}
-	sendJSON(writer, protocolo.Message{Type: "SET_DECK", Data: protocolo.SetDeckRequest{Cartas: dummyDeck}})
+	sendJSON(writer, protocolo.Message{Type: "SET_DECK", Data: protocolo.SetDeckRequest{Cartas: deck}})
 	time.Sleep(50 * time.Millisecond)
 
 	// 3. Buscar sala pública
@@ -125,4 +141,21 @@ func sendJSON(writer *bufio.Writer, msg protocolo.Message) error {
 func mapToStruct(input interface{}, target interface{}) {
 	bytes, _ := json.Marshal(input)
 	json.Unmarshal(bytes, target)
+}
+
+// esperar lê mensagens até chegar uma do tipo pedido (ignora PING e afins).
+func esperar(reader *bufio.Reader, tipo string) (protocolo.Message, bool) {
+	for {
+		message, err := reader.ReadString('\n')
+		if err != nil {
+			return protocolo.Message{}, false
+		}
+		var msg protocolo.Message
+		if err := json.Unmarshal([]byte(message), &msg); err != nil {
+			continue
+		}
+		if msg.Type == tipo {
+			return msg, true
+		}
+	}
 }
\ No newline at end of file